@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// Sessions lists all sessions of the client's namespace. It requires an
+// admin token.
+func (a *Client) Sessions() (ret *types.SessionsReturn, err error) {
+	err = nil
+
+	url := fmt.Sprintf("%s/admin/sessions", a.Url.String())
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.SessionsReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Locks lists the held locks and mutexes of the client's namespace with
+// their owners. It requires an admin token.
+func (a *Client) Locks() (ret *types.LocksReturn, err error) {
+	err = nil
+
+	url := fmt.Sprintf("%s/admin/locks", a.Url.String())
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.LocksReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ForceExpireSession expires a session regardless of its owner, releasing
+// everything it holds. It requires an admin token.
+func (a *Client) ForceExpireSession(sessionID string) (success bool, err error) {
+	return a.adminDelete(fmt.Sprintf("%s/admin/sessions/%s", a.Url.String(), sessionID))
+}
+
+// ForceRelease releases a key acquired with a session regardless of its
+// owner. It requires an admin token.
+func (a *Client) ForceRelease(key string) (success bool, err error) {
+	return a.adminDelete(fmt.Sprintf("%s/admin/locks/kv/%s", a.Url.String(), key))
+}
+
+// ForceUnlockMutex unlocks a mutex regardless of its owner. It requires an
+// admin token.
+func (a *Client) ForceUnlockMutex(key string) (success bool, err error) {
+	return a.adminDelete(fmt.Sprintf("%s/admin/locks/mutex/%s", a.Url.String(), key))
+}
+
+func (a *Client) adminDelete(url string) (success bool, err error) {
+	err = nil
+	success = false
+
+	req, err := http.NewRequest("DELETE", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := types.AdminReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+
+	return
+}
+
+// PurgePrefix deletes all keys starting with prefix from the client's
+// namespace and returns how many were deleted. It requires an admin token.
+func (a *Client) PurgePrefix(prefix string) (deleted int64, err error) {
+	err = nil
+	deleted = 0
+
+	url := fmt.Sprintf("%s/admin/keys?prefix=%s", a.Url.String(), url.QueryEscape(prefix))
+
+	req, err := http.NewRequest("DELETE", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := types.PurgeReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return
+	}
+
+	deleted = ret.Deleted
+
+	return
+}
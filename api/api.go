@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,14 +10,55 @@ import (
 	"strconv"
 	"time"
 
+	distlockpb "github.com/DENKweit/distlock/proto"
+	"github.com/DENKweit/distlock/trace"
 	"github.com/DENKweit/distlock/types"
+	"google.golang.org/grpc"
 )
 
 type Client struct {
 	Url *url.URL
+	// Token is sent as bearer token with every request if not empty.
+	Token string
+	// Namespace selects the namespace of every request, the server's
+	// default namespace is used if empty.
+	Namespace string
+	// HTTPClient is used for all requests, a default client is used if nil.
+	HTTPClient *http.Client
+	// Tracer creates a span for every request if not nil.
+	Tracer *trace.Tracer
+	// Retries is how often requests failing with a retryable error are
+	// sent again, waiting RetryDelay in between.
+	Retries    int
+	RetryDelay time.Duration
+
+	ctx context.Context
+
+	// grpc serves the calls of the gRPC service if the client was created
+	// with WithGRPC.
+	grpc     distlockpb.DistlockClient
+	grpcConn *grpc.ClientConn
 }
 
-func NewClient(endpoint string) (*Client, error) {
+type ClientOption func(*Client) error
+
+// WithToken authenticates all requests with the given API token.
+func WithToken(token string) ClientOption {
+	return func(c *Client) error {
+		c.Token = token
+		return nil
+	}
+}
+
+// WithNamespace makes all requests operate on the given namespace.
+func WithNamespace(namespace string) ClientOption {
+	return func(c *Client) error {
+		c.Namespace = namespace
+		return nil
+	}
+}
+
+func NewClient(endpoint string, options ...ClientOption) (*Client, error) {
 	url, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
@@ -25,9 +67,32 @@ func NewClient(endpoint string) (*Client, error) {
 		Url: url,
 	}
 
+	for _, option := range options {
+		if err := option(ret); err != nil {
+			return nil, err
+		}
+	}
+
 	return ret, nil
 }
 
+func (a *Client) do(req *http.Request) (*http.Response, error) {
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	if a.Namespace != "" {
+		req.Header.Set("X-Distlock-Namespace", a.Namespace)
+	}
+
+	client := a.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return a.doRetried(req, client)
+}
+
 func (a *Client) Status() (status types.StatusReturn, err error) {
 	err = nil
 	status = types.StatusReturn{}
@@ -40,13 +105,12 @@ func (a *Client) Status() (status types.StatusReturn, err error) {
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -61,7 +125,42 @@ func (a *Client) Status() (status types.StatusReturn, err error) {
 	return
 }
 
+// Ready reports whether the server accepts requests, it is false once the
+// server is shutting down.
+func (a *Client) Ready() (ready bool, err error) {
+	err = nil
+	ready = false
+
+	url := fmt.Sprintf("%s/readyz", a.Url.String())
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 503 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ready = resp.StatusCode == 200
+
+	return
+}
+
 func (a *Client) Acquire(key string, value string, duration time.Duration) (success bool, sessionID string, err error) {
+	if a.grpc != nil {
+		return a.grpcAcquire(key, value, duration)
+	}
+
 	err = nil
 	success = false
 	sessionID = ""
@@ -78,13 +177,12 @@ func (a *Client) Acquire(key string, value string, duration time.Duration) (succ
 	q.Add("value", value)
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -105,6 +203,10 @@ func (a *Client) Acquire(key string, value string, duration time.Duration) (succ
 }
 
 func (a *Client) Release(key string, sessionID string) (success bool, err error) {
+	if a.grpc != nil {
+		return a.grpcRelease(key, sessionID)
+	}
+
 	err = nil
 	success = false
 
@@ -116,13 +218,12 @@ func (a *Client) Release(key string, sessionID string) (success bool, err error)
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -142,6 +243,10 @@ func (a *Client) Release(key string, sessionID string) (success bool, err error)
 }
 
 func (a *Client) IntSet(key string, value int64, sessionID string) (ret *types.IntReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcIntOp(key, types.IntOpTypeSet, url.Values{"value": {strconv.FormatInt(value, 10)}}, sessionID)
+	}
+
 	err = nil
 	ret = &types.IntReturn{
 		Success: false,
@@ -161,13 +266,12 @@ func (a *Client) IntSet(key string, value int64, sessionID string) (ret *types.I
 	q.Add("op", string(types.IntOpTypeSet))
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -183,6 +287,10 @@ func (a *Client) IntSet(key string, value int64, sessionID string) (ret *types.I
 }
 
 func (a *Client) IntGet(key string, sessionID string) (ret *types.IntReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcIntOp(key, types.IntOpTypeGet, url.Values{}, sessionID)
+	}
+
 	err = nil
 	ret = &types.IntReturn{
 		Success: false,
@@ -201,13 +309,12 @@ func (a *Client) IntGet(key string, sessionID string) (ret *types.IntReturn, err
 	q.Add("op", string(types.IntOpTypeGet))
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -223,6 +330,10 @@ func (a *Client) IntGet(key string, sessionID string) (ret *types.IntReturn, err
 }
 
 func (a *Client) LockMutex(key string, timeout *time.Duration) (success bool, err error) {
+	if a.grpc != nil {
+		return a.grpcLockMutex(key, timeout)
+	}
+
 	err = nil
 	success = false
 
@@ -240,13 +351,12 @@ func (a *Client) LockMutex(key string, timeout *time.Duration) (success bool, er
 		req.URL.RawQuery = q.Encode()
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -266,6 +376,10 @@ func (a *Client) LockMutex(key string, timeout *time.Duration) (success bool, er
 }
 
 func (a *Client) UnlockMutex(key string) (success bool, err error) {
+	if a.grpc != nil {
+		return a.grpcUnlockMutex(key)
+	}
+
 	err = nil
 	success = false
 
@@ -277,13 +391,12 @@ func (a *Client) UnlockMutex(key string) (success bool, err error) {
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -303,6 +416,10 @@ func (a *Client) UnlockMutex(key string) (success bool, err error) {
 }
 
 func (a *Client) IntInc(key string, sessionID string) (ret *types.IntReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcIntOp(key, types.IntOpTypeInc, url.Values{}, sessionID)
+	}
+
 	err = nil
 	ret = &types.IntReturn{
 		Success: false,
@@ -321,13 +438,12 @@ func (a *Client) IntInc(key string, sessionID string) (ret *types.IntReturn, err
 	q.Add("op", string(types.IntOpTypeInc))
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -343,6 +459,10 @@ func (a *Client) IntInc(key string, sessionID string) (ret *types.IntReturn, err
 }
 
 func (a *Client) IntDec(key string, sessionID string) (ret *types.IntReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcIntOp(key, types.IntOpTypeDec, url.Values{}, sessionID)
+	}
+
 	err = nil
 	ret = &types.IntReturn{
 		Success: false,
@@ -361,13 +481,12 @@ func (a *Client) IntDec(key string, sessionID string) (ret *types.IntReturn, err
 	q.Add("op", string(types.IntOpTypeDec))
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -383,6 +502,10 @@ func (a *Client) IntDec(key string, sessionID string) (ret *types.IntReturn, err
 }
 
 func (a *Client) Set(key string, value string, sessionID string) (success bool, err error) {
+	if a.grpc != nil {
+		return a.grpcSet(key, value, sessionID)
+	}
+
 	err = nil
 	success = false
 
@@ -399,13 +522,12 @@ func (a *Client) Set(key string, value string, sessionID string) (success bool,
 	q.Add("sessionId", sessionID)
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -424,7 +546,57 @@ func (a *Client) Set(key string, value string, sessionID string) (success bool,
 	return
 }
 
+// Delete deletes the key. Locked keys can only be deleted with the session
+// holding the lock.
+func (a *Client) Delete(key string, sessionID string) (success bool, err error) {
+	if a.grpc != nil {
+		return a.grpcDelete(key, sessionID)
+	}
+
+	err = nil
+	success = false
+
+	url := fmt.Sprintf("%s/kv/delete/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("sessionId", sessionID)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.DeleteReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+
+	return
+}
+
 func (a *Client) Get(key string) (ret *types.GetReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcGet(key)
+	}
+
 	err = nil
 
 	url := fmt.Sprintf("%s/kv/get/%s", a.Url.String(), key)
@@ -435,13 +607,12 @@ func (a *Client) Get(key string) (ret *types.GetReturn, err error) {
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -486,13 +657,12 @@ func (a *Client) SetM(entries []types.KeyValue, sessionID string) (success bool,
 
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -532,13 +702,12 @@ func (a *Client) GetM(keys []string) (ret *types.GetMReturn, err error) {
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -555,8 +724,22 @@ func (a *Client) GetM(keys []string) (ret *types.GetMReturn, err error) {
 	return
 }
 
+// RenewSession extends the session's TTL to duration. It returns
+// ErrSessionNotFound if the session has expired or was destroyed. Earlier
+// versions returned nil in that case, callers that treat any error of a
+// renewal as fatal should check for ErrSessionNotFound with errors.Is.
 func (a *Client) RenewSession(sessionID string, duration time.Duration) (err error) {
+	_, err = a.renewSession(sessionID, duration)
+	return
+}
+
+func (a *Client) renewSession(sessionID string, duration time.Duration) (ret *types.RenewReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcRenewSession(sessionID, duration)
+	}
+
 	err = nil
+	ret = nil
 
 	url := fmt.Sprintf("%s/session/renew/%s/%d", a.Url.String(), sessionID, duration)
 
@@ -566,23 +749,37 @@ func (a *Client) RenewSession(sessionID string, duration time.Duration) (err err
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
 		return
 	}
 
+	ret = &types.RenewReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	if !ret.Success {
+		err = ErrSessionNotFound
+	}
+
 	return
 }
 
 func (a *Client) DestroySession(sessionID string) (err error) {
+	if a.grpc != nil {
+		return a.grpcDestroySession(sessionID)
+	}
+
 	err = nil
 	url := fmt.Sprintf("%s/session/destroy/%s", a.Url.String(), sessionID)
 
@@ -592,13 +789,12 @@ func (a *Client) DestroySession(sessionID string) (err error) {
 		return
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -638,6 +834,10 @@ func (a *Client) RenewSessionPeriodic(sessionID string, interval time.Duration,
 }
 
 func (a *Client) Keys(prefix string) (keys []string, err error) {
+	if a.grpc != nil {
+		return a.grpcKeys(prefix)
+	}
+
 	err = nil
 	keys = []string{}
 
@@ -653,13 +853,12 @@ func (a *Client) Keys(prefix string) (keys []string, err error) {
 	q.Add("prefix", prefix)
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		err = fmt.Errorf("error: %s", resp.Status)
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// closeCounter counts the response bodies that were not closed.
+type closeCounter struct {
+	open int32
+}
+
+func (c *closeCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&c.open, 1)
+	resp.Body = &countedBody{ReadCloser: resp.Body, counter: c}
+	return resp, nil
+}
+
+type countedBody struct {
+	io.ReadCloser
+	counter *closeCounter
+	closed  bool
+}
+
+func (b *countedBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		atomic.AddInt32(&b.counter.open, -1)
+	}
+	return b.ReadCloser.Close()
+}
+
+func TestResponseBodiesClosed(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"success":true}`))
+		}))
+		defer ts.Close()
+
+		client, err := NewClient(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter := &closeCounter{}
+		client.HTTPClient = &http.Client{Transport: counter}
+
+		client.Status()
+		client.Delete("k", "")
+		client.Get("k")
+		client.Set("k", "v", "")
+		client.RenewSession("s", 0)
+		client.DestroySession("s")
+
+		if open := atomic.LoadInt32(&counter.open); open != 0 {
+			t.Errorf("status %d: %d response bodies were not closed", status, open)
+		}
+	}
+}
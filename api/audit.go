@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// Audit returns up to limit of the most recent audit entries for key,
+// newest first. primitive restricts the entries to kv, int, mutex or queue
+// if not empty.
+func (a *Client) Audit(key string, primitive string, limit int) (ret *types.AuditReturn, err error) {
+	err = nil
+
+	url := fmt.Sprintf("%s/audit/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	if primitive != "" {
+		q.Add("primitive", primitive)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.AuditReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
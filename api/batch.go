@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// Batch collects operations sent to the server in one request by Run.
+type Batch struct {
+	client  *Client
+	request types.BatchRequest
+}
+
+func (a *Client) Batch() *Batch {
+	return &Batch{client: a}
+}
+
+// SessionOf refers to the session acquired by the idx-th operation of the
+// same batch, usable wherever an operation takes a session id.
+func SessionOf(idx int) string {
+	return "$" + strconv.Itoa(idx)
+}
+
+// Atomic makes the batch all or none: it stops at the first failed
+// operation and undoes the ones before it.
+func (b *Batch) Atomic() *Batch {
+	b.request.Atomic = true
+	return b
+}
+
+func (b *Batch) add(op types.BatchOp) *Batch {
+	b.request.Ops = append(b.request.Ops, op)
+	return b
+}
+
+func (b *Batch) Acquire(key string, value string, duration time.Duration) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpAcquire, Key: key, Value: value, TTL: strconv.FormatInt(int64(duration), 10)})
+}
+
+func (b *Batch) Release(key string, sessionID string) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpRelease, Key: key, SessionID: sessionID})
+}
+
+func (b *Batch) Renew(sessionID string, duration time.Duration) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpRenew, SessionID: sessionID, TTL: strconv.FormatInt(int64(duration), 10)})
+}
+
+func (b *Batch) Get(key string) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpGet, Key: key})
+}
+
+func (b *Batch) Set(key string, value string, sessionID string) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpSet, Key: key, Value: value, SessionID: sessionID})
+}
+
+func (b *Batch) Delete(key string, sessionID string) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpDelete, Key: key, SessionID: sessionID})
+}
+
+// Int adds a counter operation, params holds its operands.
+func (b *Batch) Int(key string, op types.IntOpType, params types.IntRequest) *Batch {
+	return b.add(types.BatchOp{Op: types.BatchOpInt, Key: key, IntOp: op, Int: &params})
+}
+
+// Run sends the batch. The result of the idx-th operation is
+// ret.Results[idx], decode it with DecodeResult.
+func (b *Batch) Run() (ret *types.BatchReturn, err error) {
+	err = nil
+	ret = nil
+
+	url := fmt.Sprintf("%s/batch", b.client.Url.String())
+
+	messageBytes, err := json.Marshal(b.request)
+
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(messageBytes))
+
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.BatchReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// DecodeResult decodes the response of an operation, e.g. into a
+// types.AcquireReturn for an acquire.
+func DecodeResult(result types.BatchResult, out interface{}) error {
+	if result.Status != 200 {
+		return fmt.Errorf("error: %d %s", result.Status, result.Error)
+	}
+	return json.Unmarshal(result.Result, out)
+}
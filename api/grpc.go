@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	distlockpb "github.com/DENKweit/distlock/proto"
+	"github.com/DENKweit/distlock/trace"
+	"github.com/DENKweit/distlock/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrGRPCRequired is returned by calls that are only served over gRPC when
+// the client was created without WithGRPC.
+var ErrGRPCRequired = errors.New("call requires a gRPC connection, see WithGRPC")
+
+// WithGRPC sends the calls the gRPC service offers to the server's gRPC
+// listener at target instead of the HTTP endpoint. The other calls keep
+// using HTTP. Without transport credentials in opts the connection is not
+// encrypted. Close releases the connection.
+func WithGRPC(target string, opts ...grpc.DialOption) ClientOption {
+	return func(c *Client) error {
+		conn, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			return err
+		}
+		c.grpcConn = conn
+		c.grpc = distlockpb.NewDistlockClient(conn)
+		return nil
+	}
+}
+
+// Close closes the gRPC connection of the client, if it has one.
+func (a *Client) Close() error {
+	if a.grpcConn == nil {
+		return nil
+	}
+	return a.grpcConn.Close()
+}
+
+// grpcContext returns the context of a call with the token, namespace and
+// trace context as metadata.
+func (a *Client) grpcContext() context.Context {
+	ctx := a.context()
+
+	pairs := []string{}
+	if a.Token != "" {
+		pairs = append(pairs, "authorization", "Bearer "+a.Token)
+	}
+	if a.Namespace != "" {
+		pairs = append(pairs, "x-distlock-namespace", a.Namespace)
+	}
+
+	header := http.Header{}
+	trace.Inject(ctx, header)
+	if traceparent := header.Get(trace.TraceparentHeader); traceparent != "" {
+		pairs = append(pairs, trace.TraceparentHeader, traceparent)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// grpcError converts a failed call, so a server shutting down is reported
+// as ErrShuttingDown like over HTTP.
+func grpcError(err error) error {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.Unavailable && s.Message() == ErrShuttingDown.Error() {
+		return ErrShuttingDown
+	}
+	return err
+}
+
+var grpcIntOps = map[types.IntOpType]distlockpb.IntOp{
+	types.IntOpTypeGet:    distlockpb.IntOp_INT_OP_GET,
+	types.IntOpTypeInc:    distlockpb.IntOp_INT_OP_INC,
+	types.IntOpTypeDec:    distlockpb.IntOp_INT_OP_DEC,
+	types.IntOpTypeAdd:    distlockpb.IntOp_INT_OP_ADD,
+	types.IntOpTypeSet:    distlockpb.IntOp_INT_OP_SET,
+	types.IntOpTypeGetSet: distlockpb.IntOp_INT_OP_GETSET,
+	types.IntOpTypeCAS:    distlockpb.IntOp_INT_OP_CAS,
+	types.IntOpTypeReset:  distlockpb.IntOp_INT_OP_RESET,
+	types.IntOpTypeCreate: distlockpb.IntOp_INT_OP_CREATE,
+	types.IntOpTypeBounds: distlockpb.IntOp_INT_OP_BOUNDS,
+}
+
+var grpcIntModes = map[types.IntMode]distlockpb.IntMode{
+	types.IntModePublic:  distlockpb.IntMode_INT_MODE_PUBLIC,
+	types.IntModeLock:    distlockpb.IntMode_INT_MODE_LOCK,
+	types.IntModeSession: distlockpb.IntMode_INT_MODE_SESSION,
+}
+
+var grpcValueKinds = map[distlockpb.ValueKind]types.ValueKind{
+	distlockpb.ValueKind_VALUE_KIND_STRING: types.ValueKindString,
+	distlockpb.ValueKind_VALUE_KIND_INT:    types.ValueKindInt,
+	distlockpb.ValueKind_VALUE_KIND_JSON:   types.ValueKindJSON,
+	distlockpb.ValueKind_VALUE_KIND_BYTES:  types.ValueKindBytes,
+}
+
+func stringValue(value string) *distlockpb.Value {
+	return &distlockpb.Value{Kind: distlockpb.ValueKind_VALUE_KIND_STRING, Data: []byte(value)}
+}
+
+// getReturn converts a value like the HTTP API returns it, bytes are
+// base64 encoded.
+func getReturn(key string, exists bool, value *distlockpb.Value, locked bool) *types.GetReturn {
+	ret := &types.GetReturn{Success: exists, Key: key, Locked: locked}
+	if exists && value != nil {
+		kind := grpcValueKinds[value.Kind]
+		ret.Kind = string(kind)
+		ret.Value = string(value.Data)
+		if kind == types.ValueKindBytes {
+			ret.Value = base64.StdEncoding.EncodeToString(value.Data)
+		}
+	}
+	return ret
+}
+
+func (a *Client) grpcGet(key string) (*types.GetReturn, error) {
+	resp, err := a.grpc.Get(a.grpcContext(), &distlockpb.GetRequest{Key: key})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return getReturn(key, resp.Success, resp.Value, resp.Locked), nil
+}
+
+func (a *Client) grpcSet(key string, value string, sessionID string) (bool, error) {
+	resp, err := a.grpc.Set(a.grpcContext(), &distlockpb.SetRequest{Key: key, Value: stringValue(value), SessionId: sessionID})
+	if err != nil {
+		return false, grpcError(err)
+	}
+	return resp.Success, nil
+}
+
+func (a *Client) grpcDelete(key string, sessionID string) (bool, error) {
+	resp, err := a.grpc.Delete(a.grpcContext(), &distlockpb.DeleteRequest{Key: key, SessionId: sessionID})
+	if err != nil {
+		return false, grpcError(err)
+	}
+	return resp.Success, nil
+}
+
+func (a *Client) grpcKeys(prefix string) ([]string, error) {
+	resp, err := a.grpc.ListKeys(a.grpcContext(), &distlockpb.ListKeysRequest{Prefix: prefix})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if resp.Keys == nil {
+		return []string{}, nil
+	}
+	return resp.Keys, nil
+}
+
+func (a *Client) grpcAcquire(key string, value string, duration time.Duration) (bool, string, error) {
+	resp, err := a.grpc.Acquire(a.grpcContext(), &distlockpb.AcquireRequest{Key: key, Ttl: durationpb.New(duration), Value: stringValue(value)})
+	if err != nil {
+		return false, "", grpcError(err)
+	}
+	return resp.Success, resp.SessionId, nil
+}
+
+func (a *Client) grpcRelease(key string, sessionID string) (bool, error) {
+	resp, err := a.grpc.Release(a.grpcContext(), &distlockpb.ReleaseRequest{Key: key, SessionId: sessionID})
+	if err != nil {
+		return false, grpcError(err)
+	}
+	return resp.Success, nil
+}
+
+func (a *Client) grpcRenewSession(sessionID string, duration time.Duration) (*types.RenewReturn, error) {
+	resp, err := a.grpc.Renew(a.grpcContext(), &distlockpb.RenewRequest{SessionId: sessionID, Ttl: durationpb.New(duration)})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return renewReturn(resp.Success, resp.ExpiresAt.AsTime(), resp.Keys)
+}
+
+func renewReturn(success bool, expiresAt time.Time, keys []string) (*types.RenewReturn, error) {
+	if !success {
+		return &types.RenewReturn{}, ErrSessionNotFound
+	}
+	return &types.RenewReturn{Success: true, ExpiresAt: &expiresAt, Keys: keys}, nil
+}
+
+func (a *Client) grpcDestroySession(sessionID string) error {
+	_, err := a.grpc.DestroySession(a.grpcContext(), &distlockpb.DestroySessionRequest{SessionId: sessionID})
+	return grpcError(err)
+}
+
+func (a *Client) grpcLockMutex(key string, timeout *time.Duration) (bool, error) {
+	req := &distlockpb.LockRequest{Key: key}
+	if timeout != nil {
+		req.Timeout = durationpb.New(*timeout)
+	}
+	resp, err := a.grpc.Lock(a.grpcContext(), req)
+	if err != nil {
+		return false, grpcError(err)
+	}
+	return resp.Success, nil
+}
+
+func (a *Client) grpcUnlockMutex(key string) (bool, error) {
+	resp, err := a.grpc.Unlock(a.grpcContext(), &distlockpb.UnlockRequest{Key: key})
+	if err != nil {
+		return false, grpcError(err)
+	}
+	return resp.Success, nil
+}
+
+// grpcIntOp sends a counter operation with the query parameters of the
+// HTTP API.
+func (a *Client) grpcIntOp(key string, op types.IntOpType, params url.Values, sessionID string) (*types.IntReturn, error) {
+	req := &distlockpb.IntRequest{
+		Key:       key,
+		Op:        grpcIntOps[op],
+		Mode:      grpcIntModes[types.IntMode(params.Get("mode"))],
+		SessionId: sessionID,
+	}
+
+	for name, field := range map[string]**int64{"value": &req.Value, "delta": &req.Delta, "expected": &req.Expected, "min": &req.Min, "max": &req.Max} {
+		if params.Has(name) {
+			n, err := strconv.ParseInt(params.Get(name), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			*field = &n
+		}
+	}
+	if params.Has("ttl") {
+		n, err := strconv.ParseInt(params.Get("ttl"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.Ttl = durationpb.New(time.Duration(n))
+	}
+
+	resp, err := a.grpc.Int(a.grpcContext(), req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	ret := &types.IntReturn{Success: resp.Success, Value: resp.Value, Previous: resp.Previous, Op: string(op)}
+	for mode, protoMode := range grpcIntModes {
+		if protoMode == resp.Mode {
+			ret.Mode = string(mode)
+		}
+	}
+	return ret, nil
+}
+
+// grpcRenewer renews sessions over a KeepAlive stream, opening a new
+// stream when the last one failed.
+type grpcRenewer struct {
+	client *Client
+	ctx    context.Context
+	stream distlockpb.Distlock_KeepAliveClient
+}
+
+func (r *grpcRenewer) renew(sessionID string, ttl time.Duration) (*types.RenewReturn, error) {
+	if r.stream == nil {
+		stream, err := r.client.grpc.KeepAlive(r.ctx)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		r.stream = stream
+	}
+
+	err := r.stream.Send(&distlockpb.KeepAliveRequest{SessionId: sessionID, Ttl: durationpb.New(ttl)})
+	if err != nil {
+		r.stream = nil
+		return nil, grpcError(err)
+	}
+	resp, err := r.stream.Recv()
+	if err != nil {
+		r.stream = nil
+		return nil, grpcError(err)
+	}
+	return renewReturn(resp.Success, resp.ExpiresAt.AsTime(), resp.Keys)
+}
+
+// Watch sends the state of key on the returned channel, first the current
+// one and then every change, until doneCh is closed or the stream fails.
+// The channel is closed then and the error channel reports why, or nil if
+// doneCh was closed. Watch requires WithGRPC.
+func (a *Client) Watch(key string, doneCh <-chan struct{}) (<-chan *types.GetReturn, <-chan error, error) {
+	if a.grpc == nil {
+		return nil, nil, ErrGRPCRequired
+	}
+
+	ctx, cancel := context.WithCancel(a.grpcContext())
+	stream, err := a.grpc.Watch(ctx, &distlockpb.WatchRequest{Key: key})
+	if err != nil {
+		cancel()
+		return nil, nil, grpcError(err)
+	}
+
+	events := make(chan *types.GetReturn)
+	errs := make(chan error, 1)
+
+	go func() {
+		select {
+		case <-doneCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				if status.Code(err) == codes.Canceled {
+					err = nil
+				}
+				errs <- grpcError(err)
+				return
+			}
+
+			select {
+			case events <- getReturn(key, event.Exists, event.Value, event.Locked):
+			case <-ctx.Done():
+				errs <- nil
+				return
+			}
+		}
+	}()
+
+	return events, errs, nil
+}
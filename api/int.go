@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func (a *Client) IntAdd(key string, delta int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("delta", strconv.FormatInt(delta, 10))
+	return a.intOp(key, types.IntOpTypeAdd, params, sessionID)
+}
+
+// IntCAS sets the counter to value if it currently equals expected.
+func (a *Client) IntCAS(key string, expected int64, value int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("expected", strconv.FormatInt(expected, 10))
+	params.Add("value", strconv.FormatInt(value, 10))
+	return a.intOp(key, types.IntOpTypeCAS, params, sessionID)
+}
+
+// IntGetSet sets the counter to value and reports the old value in
+// ret.Previous.
+func (a *Client) IntGetSet(key string, value int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("value", strconv.FormatInt(value, 10))
+	return a.intOp(key, types.IntOpTypeGetSet, params, sessionID)
+}
+
+// IntIncBounded increments the counter unless it would exceed max. The
+// bound applies to this call only, see IntSetBounds for lasting bounds.
+func (a *Client) IntIncBounded(key string, max int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("max", strconv.FormatInt(max, 10))
+	return a.intOp(key, types.IntOpTypeInc, params, sessionID)
+}
+
+// IntDecBounded decrements the counter unless it would drop below min. The
+// bound applies to this call only, see IntSetBounds for lasting bounds.
+func (a *Client) IntDecBounded(key string, min int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("min", strconv.FormatInt(min, 10))
+	return a.intOp(key, types.IntOpTypeDec, params, sessionID)
+}
+
+// IntSetBounds sets the bounds every later operation on the counter must
+// keep, a nil limit removes it. It fails if the current value lies outside.
+func (a *Client) IntSetBounds(key string, min *int64, max *int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	if min != nil {
+		params.Add("min", strconv.FormatInt(*min, 10))
+	}
+	if max != nil {
+		params.Add("max", strconv.FormatInt(*max, 10))
+	}
+	return a.intOp(key, types.IntOpTypeBounds, params, sessionID)
+}
+
+// IntReset sets the counter to value. If ttl is not nil the counter is
+// removed after ttl, so it reads as zero again.
+func (a *Client) IntReset(key string, value int64, ttl *time.Duration, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("value", strconv.FormatInt(value, 10))
+	if ttl != nil {
+		params.Add("ttl", strconv.FormatInt(int64(*ttl), 10))
+	}
+	return a.intOp(key, types.IntOpTypeReset, params, sessionID)
+}
+
+func (a *Client) intOp(key string, op types.IntOpType, params url.Values, sessionID string) (ret *types.IntReturn, err error) {
+	if a.grpc != nil {
+		return a.grpcIntOp(key, op, params, sessionID)
+	}
+
+	err = nil
+	ret = &types.IntReturn{
+		Success: false,
+	}
+
+	url := fmt.Sprintf("%s/int/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	params.Add("sessionId", sessionID)
+	params.Add("op", string(op))
+	req.URL.RawQuery = params.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// IntCreate creates a counter with the given mode and initial value. It
+// fails if the key already exists. Session owned counters are bound to
+// sessionID.
+func (a *Client) IntCreate(key string, mode types.IntMode, value int64, sessionID string) (ret *types.IntReturn, err error) {
+	params := url.Values{}
+	params.Add("mode", string(mode))
+	params.Add("value", strconv.FormatInt(value, 10))
+	return a.intOp(key, types.IntOpTypeCreate, params, sessionID)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// GetJSON decodes the JSON value of key into out. If path is not empty only
+// the part of the document selected by the JSON path (e.g. $.a.b[0]) is
+// decoded. found is false if the key does not exist, is not a JSON value
+// or the path does not match.
+func (a *Client) GetJSON(key string, path string, out interface{}) (found bool, err error) {
+	err = nil
+	found = false
+
+	url := fmt.Sprintf("%s/kv/get/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	if path != "" {
+		q := req.URL.Query()
+		q.Add("path", path)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.GetReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	if !ret.Success || types.ValueKind(ret.Kind) != types.ValueKindJSON {
+		return
+	}
+
+	err = json.Unmarshal([]byte(ret.Value), out)
+	if err != nil {
+		return
+	}
+
+	found = true
+
+	return
+}
+
+// SetJSON stores v encoded as a JSON value.
+func (a *Client) SetJSON(key string, v interface{}, sessionID string) (success bool, err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return a.SetTyped(key, types.ValueKindJSON, data, sessionID)
+}
+
+// MergePatch applies patch to the JSON value of key as a RFC 7386 merge
+// patch.
+func (a *Client) MergePatch(key string, patch interface{}, sessionID string) (ret *types.PatchReturn, err error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	return a.patch(key, "application/merge-patch+json", data, sessionID)
+}
+
+// JSONPatch applies ops to the JSON value of key as a RFC 6902 JSON patch.
+// Either all operations are applied or none.
+func (a *Client) JSONPatch(key string, ops []types.JSONPatchOp, sessionID string) (ret *types.PatchReturn, err error) {
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return a.patch(key, "application/json-patch+json", data, sessionID)
+}
+
+func (a *Client) patch(key string, contentType string, data []byte, sessionID string) (ret *types.PatchReturn, err error) {
+	err = nil
+	ret = &types.PatchReturn{
+		Success: false,
+	}
+
+	url := fmt.Sprintf("%s/kv/patch/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("sessionId", sessionID)
+	req.URL.RawQuery = q.Encode()
+
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSessionNotFound is returned when renewing a session that has expired
+// or was destroyed, which means any lock it held is lost.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrSessionExpiring is returned when a session could not be renewed and
+// will expire within one renew interval.
+var ErrSessionExpiring = errors.New("session could not be renewed in time")
+
+// ErrLockLost is returned when the session is alive but no longer holds
+// the lock, because it was force-released or the key was deleted.
+var ErrLockLost = errors.New("lock lost")
+
+// KeepAlive renews the session to ttl every third of ttl until doneCh is
+// closed. Failed renewals are retried, but once the session would expire
+// within one renew interval KeepAlive gives up and returns
+// ErrSessionExpiring, leaving the caller that interval to stop using the
+// lock. It returns ErrSessionNotFound if the session is gone and nil when
+// doneCh is closed, leaving the session alive.
+func (a *Client) KeepAlive(sessionID string, ttl time.Duration, doneCh <-chan struct{}) error {
+	return a.keepAlive(sessionID, "", ttl, doneCh)
+}
+
+// KeepLock works like KeepAlive and also returns ErrLockLost once the
+// session no longer holds key.
+func (a *Client) KeepLock(key string, sessionID string, ttl time.Duration, doneCh <-chan struct{}) error {
+	return a.keepAlive(sessionID, key, ttl, doneCh)
+}
+
+func (a *Client) keepAlive(sessionID string, key string, ttl time.Duration, doneCh <-chan struct{}) error {
+	renew := a.renewSession
+	if a.grpc != nil {
+		// over gRPC all renewals share one KeepAlive stream
+		ctx, cancel := context.WithCancel(a.grpcContext())
+		defer cancel()
+		renew = (&grpcRenewer{client: a, ctx: ctx}).renew
+	}
+
+	interval := ttl / 3
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// deadline fires one interval before the session expires.
+	deadline := time.NewTimer(ttl - interval)
+	defer deadline.Stop()
+
+	var lastErr error
+
+	for {
+		select {
+		case <-ticker.C:
+			started := time.Now()
+			ret, err := renew(sessionID, ttl)
+			if err != nil {
+				if errors.Is(err, ErrSessionNotFound) {
+					return err
+				}
+				lastErr = err
+				continue
+			}
+			if key != "" && !contains(ret.Keys, key) {
+				return ErrLockLost
+			}
+
+			lastErr = nil
+			if !deadline.Stop() {
+				select {
+				case <-deadline.C:
+				default:
+				}
+			}
+			deadline.Reset(ttl - interval - time.Since(started))
+		case <-deadline.C:
+			if lastErr != nil {
+				return fmt.Errorf("%w: %v", ErrSessionExpiring, lastErr)
+			}
+			return ErrSessionExpiring
+		case <-doneCh:
+			return nil
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// newRenewServer answers renewals with ret until fail is set, then with
+// an internal server error.
+func newRenewServer(t *testing.T, ret types.RenewReturn, fail *int32) *Client {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(fail) != 0 {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(ret)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestKeepAliveGivesUpBeforeExpiry(t *testing.T) {
+	var fail int32
+	client := newRenewServer(t, types.RenewReturn{Success: true}, &fail)
+
+	ttl := 300 * time.Millisecond
+	time.AfterFunc(150*time.Millisecond, func() { atomic.StoreInt32(&fail, 1) })
+
+	started := time.Now()
+	err := client.KeepAlive("s", ttl, nil)
+	if !errors.Is(err, ErrSessionExpiring) {
+		t.Fatalf("got %v, want ErrSessionExpiring", err)
+	}
+
+	// the last renewal happened at 100ms, so the session lives until 400ms
+	if elapsed := time.Since(started); elapsed >= 400*time.Millisecond {
+		t.Fatalf("loss reported after %v, the session had already expired", elapsed)
+	}
+}
+
+func TestKeepLockDetectsLostLock(t *testing.T) {
+	var fail int32
+	client := newRenewServer(t, types.RenewReturn{Success: true, Keys: []string{"other"}}, &fail)
+
+	if err := client.KeepLock("k", "s", 30*time.Millisecond, nil); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("got %v, want ErrLockLost", err)
+	}
+}
+
+func TestRenewMissingSession(t *testing.T) {
+	var fail int32
+	client := newRenewServer(t, types.RenewReturn{Success: false}, &fail)
+
+	if err := client.RenewSession("s", time.Second); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("got %v, want ErrSessionNotFound", err)
+	}
+	if err := client.KeepAlive("s", 30*time.Millisecond, nil); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("keepalive got %v, want ErrSessionNotFound", err)
+	}
+}
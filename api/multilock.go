@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// AcquireAll locks all keys under one session, all or none. It waits until
+// all keys are free or ctx is done, which returns ctx's error. Missing keys
+// are created empty. The session holds all keys, release them together
+// with ReleaseAll.
+func (a *Client) AcquireAll(ctx context.Context, keys []string, duration time.Duration) (success bool, sessionID string, err error) {
+	err = nil
+	success = false
+	sessionID = ""
+
+	url := fmt.Sprintf("%s/kv/acquireall/%d", a.Url.String(), duration)
+
+	message := types.AcquireAllRequest{
+		Keys: keys,
+		Wait: true,
+	}
+
+	messageBytes, err := json.Marshal(message)
+
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(messageBytes))
+
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.WithContext(ctx).do(req)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.AcquireAllReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+	sessionID = ret.SessionID
+
+	return
+}
+
+// ReleaseAll releases all keys locked by the session and destroys it.
+func (a *Client) ReleaseAll(sessionID string) (success bool, err error) {
+	err = nil
+	success = false
+
+	url := fmt.Sprintf("%s/kv/releaseall/%s", a.Url.String(), sessionID)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.ReleaseAllReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+
+	return
+}
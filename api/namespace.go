@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// Namespaces lists all namespaces with their quotas and usage. It requires
+// an admin token.
+func (a *Client) Namespaces() (ret *types.NamespacesReturn, err error) {
+	err = nil
+
+	url := fmt.Sprintf("%s/admin/namespaces", a.Url.String())
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.NamespacesReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// CreateNamespace creates the namespace or updates the quota of an
+// existing one. It requires an admin token.
+func (a *Client) CreateNamespace(name string, quota types.NamespaceQuota) (ret *types.NamespaceReturn, err error) {
+	err = nil
+
+	url := fmt.Sprintf("%s/admin/namespaces/%s", a.Url.String(), name)
+
+	messageBytes, err := json.Marshal(quota)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(messageBytes))
+
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.NamespaceReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// DeleteNamespace deletes the namespace with all its state. Requests
+// blocked on it fail. It requires an admin token.
+func (a *Client) DeleteNamespace(name string) (success bool, err error) {
+	err = nil
+	success = false
+
+	url := fmt.Sprintf("%s/admin/namespaces/%s", a.Url.String(), name)
+
+	req, err := http.NewRequest("DELETE", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.NamespaceReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+
+	return
+}
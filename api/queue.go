@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func (a *Client) QueuePush(queue string, value string) (id string, err error) {
+	err = nil
+	id = ""
+
+	url := fmt.Sprintf("%s/queue/push/%s", a.Url.String(), queue)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("value", value)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.QueuePushReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	id = ret.ID
+
+	return
+}
+
+// QueuePop leases the next item of the queue for duration. A nil timeout
+// blocks until an item is available, a zero timeout returns immediately.
+// If sessionID is not empty the item is also returned to the queue when
+// that session expires or is destroyed.
+func (a *Client) QueuePop(queue string, duration time.Duration, timeout *time.Duration, sessionID string) (ret *types.QueuePopReturn, err error) {
+	err = nil
+	ret = &types.QueuePopReturn{
+		Success: false,
+	}
+
+	url := fmt.Sprintf("%s/queue/pop/%s/%d", a.Url.String(), queue, duration)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	if timeout != nil {
+		q.Add("timeout", strconv.FormatInt(int64(*timeout), 10))
+	}
+	if sessionID != "" {
+		q.Add("sessionId", sessionID)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// QueueAck removes a leased item from the queue. receipt is the one
+// returned by the QueuePop that leased it.
+func (a *Client) QueueAck(queue string, id string, receipt string) (success bool, err error) {
+	return a.queueSettle("ack", queue, id, receipt)
+}
+
+// QueueNack returns a leased item to the front of the queue.
+func (a *Client) QueueNack(queue string, id string, receipt string) (success bool, err error) {
+	return a.queueSettle("nack", queue, id, receipt)
+}
+
+func (a *Client) queueSettle(op string, queue string, id string, receipt string) (success bool, err error) {
+	err = nil
+	success = false
+
+	url := fmt.Sprintf("%s/queue/%s/%s/%s", a.Url.String(), op, queue, id)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("receipt", receipt)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.QueueAckReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+
+	return
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// AcquireReentrant acquires a reentrant lock. If sessionID holds the lock
+// already, or it is empty and the lock is held by the same identity, the
+// lock is acquired again and ret.Holds counts the acquisitions. Each one
+// is undone by ReleaseHold.
+func (a *Client) AcquireReentrant(key string, value string, duration time.Duration, sessionID string) (ret *types.AcquireReturn, err error) {
+	err = nil
+	ret = nil
+
+	url := fmt.Sprintf("%s/kv/acquire/%s/%d", a.Url.String(), key, duration)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("value", value)
+	q.Add("reentrant", "true")
+	if sessionID != "" {
+		q.Add("sessionId", sessionID)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret = &types.AcquireReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ReleaseHold undoes one acquisition of a reentrant lock, holds is the
+// number still held. The lock is free once it is zero.
+func (a *Client) ReleaseHold(key string, sessionID string) (success bool, holds int64, err error) {
+	err = nil
+	success = false
+	holds = 0
+
+	url := fmt.Sprintf("%s/kv/release/%s/%s", a.Url.String(), key, sessionID)
+
+	req, err := http.NewRequest("POST", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.ReleaseReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+	holds = ret.Holds
+
+	return
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// ErrShuttingDown is returned if the server aborted a request because it is
+// shutting down. The request can be retried, e.g. against a restarted
+// server.
+var ErrShuttingDown = errors.New("server shutting down")
+
+// IsRetryable reports whether a request that failed with err can be sent
+// again.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrShuttingDown)
+}
+
+// WithRetry retries requests that failed with a retryable error up to
+// attempts times, waiting delay before each retry.
+func WithRetry(attempts int, delay time.Duration) ClientOption {
+	return func(c *Client) error {
+		if attempts < 0 {
+			return errors.New("attempts must be >= 0")
+		}
+		c.Retries = attempts
+		c.RetryDelay = delay
+		return nil
+	}
+}
+
+func isShuttingDown(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get(types.HeaderError) == types.ErrorShuttingDown
+}
+
+// doRetried sends req until it succeeds, fails with an error that is not
+// retryable or the client's retries are used up.
+func (a *Client) doRetried(req *http.Request, client *http.Client) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := a.doTraced(req, client)
+		if err == nil && isShuttingDown(resp) {
+			resp.Body.Close()
+			err = ErrShuttingDown
+		}
+
+		if err == nil {
+			return resp, nil
+		}
+
+		// a server that is shutting down refuses connections until it is
+		// restarted, so that is no reason to stop retrying
+		var urlErr *url.Error
+		retryable := IsRetryable(err) || (attempt > 0 && errors.As(err, &urlErr))
+
+		if !retryable || attempt >= a.Retries || (req.Body != nil && req.GetBody == nil) {
+			if attempt > 0 && !IsRetryable(err) {
+				return nil, fmt.Errorf("%w, retry failed: %v", ErrShuttingDown, err)
+			}
+			return nil, err
+		}
+
+		time.Sleep(a.RetryDelay)
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// tlsConfig returns the TLS configuration of the client's transport,
+// creating the client and transport if needed.
+func (c *Client) tlsConfig() (*tls.Config, error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
+	}
+
+	if c.HTTPClient.Transport == nil {
+		c.HTTPClient.Transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	transport, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("TLS options require an *http.Transport")
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	return transport.TLSClientConfig, nil
+}
+
+// WithCABundle trusts the CA certificates in the PEM encoded bundle
+// instead of the system roots.
+func WithCABundle(pem []byte) ClientOption {
+	return func(c *Client) error {
+		config, err := c.tlsConfig()
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in CA bundle")
+		}
+		config.RootCAs = pool
+
+		return nil
+	}
+}
+
+// WithCAFile works like WithCABundle but reads the bundle from a file.
+func WithCAFile(path string) ClientOption {
+	return func(c *Client) error {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return WithCABundle(pem)(c)
+	}
+}
+
+// WithClientCert presents the certificate to servers requiring mutual TLS.
+func WithClientCert(certFile string, keyFile string) ClientOption {
+	return func(c *Client) error {
+		config, err := c.tlsConfig()
+		if err != nil {
+			return err
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+
+		return nil
+	}
+}
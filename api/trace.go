@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DENKweit/distlock/trace"
+)
+
+// WithTracer creates a client span for every request and propagates it to
+// the server in the traceparent header.
+func WithTracer(tracer *trace.Tracer) ClientOption {
+	return func(c *Client) error {
+		c.Tracer = tracer
+		return nil
+	}
+}
+
+// WithContext returns a copy of the client whose requests use ctx. Spans
+// in ctx become the parents of the client spans, or are propagated to the
+// server directly if the client has no tracer.
+func (a *Client) WithContext(ctx context.Context) *Client {
+	ret := *a
+	ret.ctx = ctx
+	return &ret
+}
+
+func (a *Client) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// operationName names a request after the first two segments of its path
+// relative to the client's URL, e.g. kv.acquire.
+func (a *Client) operationName(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(a.Url.Path, "/"))
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 2 {
+		segments = segments[:2]
+	}
+	return strings.Join(segments, ".")
+}
+
+// doTraced sends req inside a client span if the client has a tracer.
+func (a *Client) doTraced(req *http.Request, client *http.Client) (*http.Response, error) {
+	ctx := a.context()
+
+	if a.Tracer == nil {
+		trace.Inject(ctx, req.Header)
+		return client.Do(req.WithContext(ctx))
+	}
+
+	ctx, span := a.Tracer.Start(ctx, "distlock "+a.operationName(req), trace.SpanKindClient)
+	defer span.End()
+
+	span.SetAttribute("http.method", req.Method)
+	// the query is left out as it may carry values
+	u := *req.URL
+	u.RawQuery = ""
+	span.SetAttribute("http.url", u.String())
+	if a.Namespace != "" {
+		span.SetAttribute("distlock.namespace", a.Namespace)
+	}
+
+	trace.Inject(ctx, req.Header)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// DecodeValue returns the raw bytes of a value reported in a JSON response.
+func DecodeValue(kind string, value string) ([]byte, error) {
+	if types.ValueKind(kind) == types.ValueKindBytes {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return []byte(value), nil
+}
+
+// SetTyped works like Set but sends data in the request body tagged with
+// kind, so binary and large values can be stored.
+func (a *Client) SetTyped(key string, kind types.ValueKind, data []byte, sessionID string) (success bool, err error) {
+	err = nil
+	success = false
+
+	url := fmt.Sprintf("%s/kv/set/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("kind", string(kind))
+	q.Add("sessionId", sessionID)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	ret := &types.SetReturn{}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return
+	}
+
+	success = ret.Success
+
+	return
+}
+
+// GetRaw returns the value of key as stored, without any JSON encoding.
+// found is false if the key does not exist.
+func (a *Client) GetRaw(key string) (kind types.ValueKind, data []byte, found bool, err error) {
+	err = nil
+	found = false
+
+	url := fmt.Sprintf("%s/kv/get/%s", a.Url.String(), key)
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return
+	}
+
+	q := req.URL.Query()
+	q.Add("raw", "true")
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := a.do(req)
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("error: %s", resp.Status)
+		return
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	kind = types.ValueKind(resp.Header.Get(types.HeaderValueKind))
+	found = true
+
+	return
+}
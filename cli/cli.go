@@ -0,0 +1,323 @@
+// Package cli implements the distlock client subcommands on top of
+// api.Client.
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DENKweit/distlock/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	outputHuman = "human"
+	outputJSON  = "json"
+)
+
+// errUsage is returned by commands called with invalid arguments, the
+// usage has already been printed.
+var errUsage = errors.New("usage")
+
+// errUnsuccessful is returned by commands whose request was answered but
+// did not succeed, e.g. because the lock was held.
+type errUnsuccessful string
+
+func (e errUnsuccessful) Error() string {
+	return string(e)
+}
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var groups = map[string]map[string]command{
+	"kv": {
+		"get":    {"kv get [flags] KEY", kvGet},
+		"set":    {"kv set [flags] KEY VALUE", kvSet},
+		"list":   {"kv list [flags]", kvList},
+		"delete": {"kv delete [flags] KEY", kvDelete},
+	},
+	"lock": {
+		"acquire": {"lock acquire [flags] KEY", lockAcquire},
+		"release": {"lock release [flags] KEY SESSION", lockRelease},
+	},
+	"int": {
+		"get": {"int get [flags] KEY", intGet},
+		"set": {"int set [flags] KEY VALUE", intSet},
+		"inc": {"int inc [flags] KEY", intInc},
+		"dec": {"int dec [flags] KEY", intDec},
+		"add": {"int add [flags] KEY DELTA", intAdd},
+	},
+	"session": {
+		"list":    {"session list [flags]", sessionList},
+		"renew":   {"session renew [flags] SESSION", sessionRenew},
+		"destroy": {"session destroy [flags] SESSION", sessionDestroy},
+	},
+}
+
+var commands = map[string]command{
+	"watch": {"watch [flags] KEY", watch},
+	"exec":  {"exec [flags] -key KEY -- COMMAND [ARGS...]", execLocked},
+}
+
+// Usage prints the available subcommands.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: distlock COMMAND [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  server [flags]")
+	fmt.Fprintln(w, "  config check [flags]")
+
+	lines := []string{}
+	for _, group := range groups {
+		for _, cmd := range group {
+			lines = append(lines, cmd.usage)
+		}
+	}
+	for _, cmd := range commands {
+		lines = append(lines, cmd.usage)
+	}
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		fmt.Fprintln(w, "  "+line)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run distlock COMMAND -h for the flags of a command.")
+}
+
+// Run runs the client subcommand given by args and returns the exit code:
+// 0 on success, 1 if the command failed and 2 on invalid usage. exec
+// returns the exit code of its command instead.
+func Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		Usage(os.Stdout)
+		return 0
+	}
+
+	var cmd command
+	var rest []string
+
+	if group, ok := groups[args[0]]; ok {
+		if len(args) < 2 {
+			Usage(os.Stderr)
+			return 2
+		}
+		cmd, ok = group[args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command: %s %s\n", args[0], args[1])
+			return 2
+		}
+		rest = args[2:]
+	} else if c, ok := commands[args[0]]; ok {
+		cmd = c
+		rest = args[1:]
+	} else {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+		Usage(os.Stderr)
+		return 2
+	}
+
+	err := cmd.run(rest)
+
+	var unsuccessful errUnsuccessful
+	var code exitCode
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &code):
+		return int(code)
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &unsuccessful):
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	default:
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+}
+
+// clientFlags are shared by all client commands. Their defaults are taken
+// from the DISTLOCK_ADDR, DISTLOCK_GRPC_ADDR, DISTLOCK_TOKEN and
+// DISTLOCK_NAMESPACE environment variables.
+type clientFlags struct {
+	flags *flag.FlagSet
+	usage string
+
+	addr      string
+	grpcAddr  string
+	token     string
+	namespace string
+	caFile    string
+	certFile  string
+	keyFile   string
+	output    string
+
+	rest []string
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func newClientFlags(usage string) *clientFlags {
+	c := &clientFlags{
+		flags: flag.NewFlagSet(strings.Fields(usage)[0], flag.ContinueOnError),
+		usage: usage,
+	}
+
+	c.flags.StringVar(&c.addr, "addr", envOr("DISTLOCK_ADDR", "http://localhost:9876"), "server URL")
+	c.flags.StringVar(&c.grpcAddr, "grpc", os.Getenv("DISTLOCK_GRPC_ADDR"), "gRPC address of the server, e.g. localhost:9877, to send the calls it serves there")
+	c.flags.StringVar(&c.token, "token", os.Getenv("DISTLOCK_TOKEN"), "API token")
+	c.flags.StringVar(&c.namespace, "namespace", os.Getenv("DISTLOCK_NAMESPACE"), "namespace, the server's default if empty")
+	c.flags.StringVar(&c.caFile, "ca-file", "", "CA bundle (PEM) to verify the server with")
+	c.flags.StringVar(&c.certFile, "cert", "", "client certificate (PEM) for mutual TLS")
+	c.flags.StringVar(&c.keyFile, "cert-key", "", "client private key (PEM) for mutual TLS")
+	c.flags.StringVar(&c.output, "o", outputHuman, "output format, human or json")
+
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "usage: distlock %s\n\nflags:\n", c.usage)
+		c.flags.PrintDefaults()
+	}
+
+	return c
+}
+
+// parse parses flags anywhere between the positional arguments and checks
+// that there are exactly nargs of them, any number if nargs is negative.
+// Arguments after -- are not parsed and kept in rest.
+func (c *clientFlags) parse(args []string, nargs int) ([]string, error) {
+	positional := []string{}
+
+	for len(args) > 0 {
+		if args[0] == "--" {
+			c.rest = args[1:]
+			break
+		}
+
+		if !strings.HasPrefix(args[0], "-") || args[0] == "-" || isNumber(args[0]) {
+			positional = append(positional, args[0])
+			args = args[1:]
+			continue
+		}
+
+		// the flag package has printed the error and the usage already
+		if err := c.flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		} else if err != nil {
+			return nil, errUsage
+		}
+
+		remaining := c.flags.Args()
+		if consumed := len(args) - len(remaining); consumed > 0 && args[consumed-1] == "--" {
+			c.rest = remaining
+			break
+		}
+		args = remaining
+	}
+
+	if c.output != outputHuman && c.output != outputJSON {
+		fmt.Fprintf(c.flags.Output(), "unknown output format: %s\n", c.output)
+		return nil, errUsage
+	}
+
+	if nargs >= 0 && len(positional) != nargs {
+		c.flags.Usage()
+		return nil, errUsage
+	}
+
+	return positional, nil
+}
+
+// isNumber tells negative numbers apart from flags.
+func isNumber(arg string) bool {
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+func (c *clientFlags) client() (*api.Client, error) {
+	options := []api.ClientOption{}
+
+	if c.token != "" {
+		options = append(options, api.WithToken(c.token))
+	}
+	if c.namespace != "" {
+		options = append(options, api.WithNamespace(c.namespace))
+	}
+	if c.caFile != "" {
+		options = append(options, api.WithCAFile(c.caFile))
+	}
+	if c.certFile != "" || c.keyFile != "" {
+		options = append(options, api.WithClientCert(c.certFile, c.keyFile))
+	}
+	if c.grpcAddr != "" {
+		creds, err := c.grpcCredentials()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, api.WithGRPC(c.grpcAddr, grpc.WithTransportCredentials(creds)))
+	}
+
+	return api.NewClient(c.addr, options...)
+}
+
+// grpcCredentials uses TLS for gRPC if the server is reached over HTTPS,
+// the gRPC listener shares the server's TLS configuration.
+func (c *clientFlags) grpcCredentials() (credentials.TransportCredentials, error) {
+	if !strings.HasPrefix(c.addr, "https://") {
+		return insecure.NewCredentials(), nil
+	}
+
+	config := &tls.Config{}
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+		config.RootCAs = pool
+	}
+	if c.certFile != "" || c.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+// print writes v as JSON or calls human to write it for humans.
+func (c *clientFlags) print(v interface{}, human func(w io.Writer)) error {
+	if c.output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	human(os.Stdout)
+	return nil
+}
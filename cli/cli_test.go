@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// fakeServer answers the requests of the client commands. The key held
+// is locked by someone else, renewals of sessions holding the key lost
+// report that the lock is gone.
+type fakeServer struct {
+	lock     sync.Mutex
+	requests []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	f.requests = append(f.requests, r.URL.Path)
+	f.lock.Unlock()
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	var ret interface{}
+	switch strings.Join(path[:2], "/") {
+	case "kv/get":
+		switch path[2] {
+		case "fail":
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		case "missing":
+			ret = types.GetReturn{Key: path[2]}
+		default:
+			ret = types.GetReturn{Success: true, Key: path[2], Value: "v"}
+		}
+	case "kv/acquire":
+		ret = types.AcquireReturn{Success: path[2] != "held", SessionID: "s-" + path[2]}
+	case "kv/release":
+		ret = types.ReleaseReturn{Success: true}
+	case "session/renew":
+		keys := []string{strings.TrimPrefix(path[2], "s-")}
+		if keys[0] == "lost" {
+			keys = nil
+		}
+		ret = types.RenewReturn{Success: true, Keys: keys}
+	case "session/destroy":
+		ret = struct{}{}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+// sent returns the paths requested so far.
+func (f *fakeServer) sent() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]string{}, f.requests...)
+}
+
+// newFakeServer points the client commands at a fakeServer.
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	f := &fakeServer{}
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+
+	t.Setenv("DISTLOCK_ADDR", ts.URL)
+	t.Setenv("DISTLOCK_GRPC_ADDR", "")
+	return f
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		args       []string
+		nargs      int
+		positional []string
+		rest       []string
+		output     string
+	}{
+		{[]string{"k"}, 1, []string{"k"}, nil, outputHuman},
+		{[]string{"k", "-o", "json"}, 1, []string{"k"}, nil, outputJSON},
+		{[]string{"-o", "json", "k", "v"}, 2, []string{"k", "v"}, nil, outputJSON},
+		{[]string{"k", "-o=json", "v"}, 2, []string{"k", "v"}, nil, outputJSON},
+		{[]string{"k", "-5"}, 2, []string{"k", "-5"}, nil, outputHuman},
+		{[]string{"k", "-"}, 2, []string{"k", "-"}, nil, outputHuman},
+		{[]string{"k", "--", "-o", "json"}, -1, []string{"k"}, []string{"-o", "json"}, outputHuman},
+		{[]string{"-o", "json", "--", "cmd", "-x"}, 0, []string{}, []string{"cmd", "-x"}, outputJSON},
+	} {
+		c := newClientFlags("test [flags]")
+		positional, err := c.parse(tc.args, tc.nargs)
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, tc.positional) || !reflect.DeepEqual(c.rest, tc.rest) || c.output != tc.output {
+			t.Errorf("%v: got %v, rest %v, output %s", tc.args, positional, c.rest, c.output)
+		}
+	}
+
+	for _, tc := range []struct {
+		args  []string
+		nargs int
+		want  error
+	}{
+		{[]string{}, 1, errUsage},
+		{[]string{"k", "v"}, 1, errUsage},
+		{[]string{"-o", "xml", "k"}, 1, errUsage},
+		{[]string{"-nosuch", "k"}, 1, errUsage},
+		{[]string{"k", "-o"}, 1, errUsage},
+		{[]string{"-h"}, 1, flag.ErrHelp},
+	} {
+		c := newClientFlags("test [flags]")
+		c.flags.SetOutput(io.Discard)
+		if _, err := c.parse(tc.args, tc.nargs); !errors.Is(err, tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.args, err, tc.want)
+		}
+	}
+}
+
+func TestClientFlagDefaults(t *testing.T) {
+	t.Setenv("DISTLOCK_ADDR", "http://distlock:1")
+	t.Setenv("DISTLOCK_TOKEN", "secret")
+	t.Setenv("DISTLOCK_NAMESPACE", "team")
+	t.Setenv("DISTLOCK_GRPC_ADDR", "distlock:2")
+
+	c := newClientFlags("test [flags]")
+	if c.addr != "http://distlock:1" || c.token != "secret" || c.namespace != "team" || c.grpcAddr != "distlock:2" {
+		t.Fatalf("defaults %+v", c)
+	}
+
+	// flags override the environment
+	if _, err := c.parse([]string{"-addr", "http://other:1", "-token", "t"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	client, err := c.client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if client.Url.String() != "http://other:1" || client.Token != "t" || client.Namespace != "team" {
+		t.Fatalf("client %+v", client)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	f := newFakeServer(t)
+
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"help"}, 0},
+		{[]string{"nosuch"}, 2},
+		{[]string{"kv"}, 2},
+		{[]string{"kv", "nosuch"}, 2},
+		{[]string{"kv", "get"}, 2},
+		{[]string{"kv", "get", "-h"}, 0},
+		{[]string{"kv", "get", "-nosuch", "k"}, 2},
+		{[]string{"kv", "get", "-o", "xml", "k"}, 2},
+		{[]string{"kv", "get", "k"}, 0},
+		{[]string{"kv", "get", "-o", "json", "k"}, 0},
+		{[]string{"kv", "get", "missing"}, 1},
+		{[]string{"kv", "get", "fail"}, 1},
+		{[]string{"lock", "acquire", "k"}, 0},
+		{[]string{"lock", "acquire", "held"}, 1},
+		{[]string{"lock", "release", "k", "s-k"}, 0},
+		{[]string{"kv", "get", "-addr", "http://[::1", "k"}, 1},
+	} {
+		if code := Run(tc.args); code != tc.want {
+			t.Errorf("%v: got exit code %d, want %d", tc.args, code, tc.want)
+		}
+	}
+
+	// invalid usage is caught before a request is sent
+	want := []string{"/kv/get/k", "/kv/get/k", "/kv/get/missing", "/kv/get/fail", "/kv/acquire/k/30000000000", "/kv/acquire/held/30000000000", "/kv/release/k/s-k"}
+	if got := f.sent(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// killGracePeriod is how long the child may take to exit after SIGTERM
+// when the lock was lost, before it is killed.
+const killGracePeriod = 5 * time.Second
+
+// exitCode makes Run exit with the code of a child process.
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(e))
+}
+
+// execLocked runs a command while holding a lock. The session is kept
+// alive while the command runs and the lock is released once the command
+// exits. The command is terminated if the lock is force-released or
+// deleted, or if the session could not be renewed and has only a third of
+// its TTL left.
+func execLocked(args []string) error {
+	c := newClientFlags("exec [flags] -key KEY -- COMMAND [ARGS...]")
+	key := c.flags.String("key", "", "key to lock")
+	ttl := c.flags.Duration("ttl", 30*time.Second, "session TTL, the session is renewed every third of it")
+	value := c.flags.String("value", "", "value to store if the key does not exist yet")
+	wait := c.flags.Bool("wait", false, "wait for the lock if it is held")
+	timeout := c.flags.Duration("timeout", 0, "give up waiting after this long, 0 waits forever")
+	if _, err := c.parse(args, 0); err != nil {
+		return err
+	}
+
+	if *key == "" || len(c.rest) == 0 {
+		c.flags.Usage()
+		return errUsage
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	success, sessionID, err := acquireLock(client, *key, *value, *ttl, *wait, *timeout)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return errUnsuccessful(fmt.Sprintf("key %s is locked", *key))
+	}
+
+	release := func() {
+		if _, err := client.Release(*key, sessionID); err != nil {
+			fmt.Fprintln(os.Stderr, "releasing lock failed:", err)
+		}
+		if err := client.DestroySession(sessionID); err != nil {
+			fmt.Fprintln(os.Stderr, "destroying session failed:", err)
+		}
+	}
+
+	child := exec.Command(c.rest[0], c.rest[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+
+	if err := child.Start(); err != nil {
+		release()
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	done := make(chan struct{})
+	lost := make(chan error, 1)
+	go func() {
+		if err := client.KeepLock(*key, sessionID, *ttl, done); err != nil {
+			lost <- err
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- child.Wait()
+	}()
+
+	var lockErr error
+	var kill <-chan time.Time
+
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			child.Process.Signal(sig)
+		case lockErr = <-lost:
+			fmt.Fprintf(os.Stderr, "lock on %s lost, terminating %s: %v\n", *key, c.rest[0], lockErr)
+			if err := child.Process.Signal(syscall.SIGTERM); err != nil {
+				child.Process.Kill()
+			}
+			kill = time.After(killGracePeriod)
+		case <-kill:
+			child.Process.Kill()
+		case err = <-exited:
+			break wait
+		}
+	}
+
+	close(done)
+
+	if lockErr == nil {
+		release()
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			code = 128 + int(status.Signal())
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if lockErr != nil && code == 0 {
+		code = 1
+	}
+
+	if code != 0 {
+		return exitCode(code)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExecExitCodes(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		want     int
+		released bool
+	}{
+		{[]string{"exec", "--", "true"}, 2, false},
+		{[]string{"exec", "-key", "k"}, 2, false},
+		{[]string{"exec", "-key", "k", "--", "sh", "-c", "exit 0"}, 0, true},
+		{[]string{"exec", "-key", "k", "--", "sh", "-c", "exit 3"}, 3, true},
+		{[]string{"exec", "-key", "k", "--", "sh", "-c", "kill -TERM $$"}, 143, true},
+		{[]string{"exec", "-key", "k", "--", "/no/such/command"}, 1, true},
+		{[]string{"exec", "-key", "held", "--", "true"}, 1, false},
+		// the lock is gone, so it is not released
+		{[]string{"exec", "-key", "lost", "-ttl", "150ms", "--", "sh", "-c", "exec sleep 10"}, 143, false},
+	} {
+		f := newFakeServer(t)
+		if code := Run(tc.args); code != tc.want {
+			t.Errorf("%v: got exit code %d, want %d", tc.args, code, tc.want)
+		}
+
+		released := false
+		for _, path := range f.sent() {
+			released = released || strings.HasPrefix(path, "/kv/release/")
+		}
+		if released != tc.released {
+			t.Errorf("%v: released %v, want %v", tc.args, released, tc.released)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+// intCommand runs an int operation taking a key and nargs further
+// arguments.
+func intCommand(usage string, nargs int, args []string, op func(client *api.Client, key string, args []int64, sessionID string) (*types.IntReturn, error)) error {
+	c := newClientFlags(usage)
+	sessionID := c.flags.String("session", "", "session owning the counter, if it is not public")
+	positional, err := c.parse(args, nargs+1)
+	if err != nil {
+		return err
+	}
+
+	values := make([]int64, nargs)
+	for idx := range values {
+		values[idx], err = strconv.ParseInt(positional[idx+1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(c.flags.Output(), "invalid integer: %s\n", positional[idx+1])
+			return errUsage
+		}
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	ret, err := op(client, positional[0], values, *sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.print(ret, func(w io.Writer) {
+		if ret.Success {
+			fmt.Fprintln(w, ret.Value)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if !ret.Success {
+		return errUnsuccessful(fmt.Sprintf("%s on %s failed", ret.Op, positional[0]))
+	}
+
+	return nil
+}
+
+func intGet(args []string) error {
+	return intCommand("int get [flags] KEY", 0, args, func(client *api.Client, key string, args []int64, sessionID string) (*types.IntReturn, error) {
+		return client.IntGet(key, sessionID)
+	})
+}
+
+func intSet(args []string) error {
+	return intCommand("int set [flags] KEY VALUE", 1, args, func(client *api.Client, key string, args []int64, sessionID string) (*types.IntReturn, error) {
+		return client.IntSet(key, args[0], sessionID)
+	})
+}
+
+func intInc(args []string) error {
+	return intCommand("int inc [flags] KEY", 0, args, func(client *api.Client, key string, args []int64, sessionID string) (*types.IntReturn, error) {
+		return client.IntInc(key, sessionID)
+	})
+}
+
+func intDec(args []string) error {
+	return intCommand("int dec [flags] KEY", 0, args, func(client *api.Client, key string, args []int64, sessionID string) (*types.IntReturn, error) {
+		return client.IntDec(key, sessionID)
+	})
+}
+
+func intAdd(args []string) error {
+	return intCommand("int add [flags] KEY DELTA", 1, args, func(client *api.Client, key string, args []int64, sessionID string) (*types.IntReturn, error) {
+		return client.IntAdd(key, args[0], sessionID)
+	})
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func kvGet(args []string) error {
+	c := newClientFlags("kv get [flags] KEY")
+	raw := c.flags.Bool("raw", false, "print the value without a trailing newline")
+	positional, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	ret, err := client.Get(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if !ret.Success {
+		if c.output == outputJSON {
+			c.print(ret, nil)
+		}
+		return errUnsuccessful(fmt.Sprintf("key %s does not exist", positional[0]))
+	}
+
+	return c.print(ret, func(w io.Writer) {
+		if *raw {
+			fmt.Fprint(w, ret.Value)
+		} else {
+			fmt.Fprintln(w, ret.Value)
+		}
+	})
+}
+
+func kvSet(args []string) error {
+	c := newClientFlags("kv set [flags] KEY VALUE")
+	sessionID := c.flags.String("session", "", "session holding the key's lock, required to overwrite a key")
+	positional, err := c.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	success, err := client.Set(positional[0], positional[1], *sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.print(types.SetReturn{Success: success}, func(w io.Writer) {}); err != nil {
+		return err
+	}
+
+	if !success {
+		if *sessionID == "" {
+			return errUnsuccessful(fmt.Sprintf("key %s already exists, overwriting it requires the session holding its lock", positional[0]))
+		}
+		return errUnsuccessful(fmt.Sprintf("session %s does not hold key %s", *sessionID, positional[0]))
+	}
+
+	return nil
+}
+
+func kvList(args []string) error {
+	c := newClientFlags("kv list [flags]")
+	prefix := c.flags.String("prefix", "", "only list keys starting with prefix")
+	if _, err := c.parse(args, 0); err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	keys, err := client.Keys(*prefix)
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	return c.print(keys, func(w io.Writer) {
+		for _, key := range keys {
+			fmt.Fprintln(w, key)
+		}
+	})
+}
+
+func kvDelete(args []string) error {
+	c := newClientFlags("kv delete [flags] KEY")
+	sessionID := c.flags.String("session", "", "session holding the key's lock, required to delete a locked key")
+	positional, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	success, err := client.Delete(positional[0], *sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.print(types.DeleteReturn{Success: success}, func(w io.Writer) {}); err != nil {
+		return err
+	}
+
+	if !success {
+		return errUnsuccessful(fmt.Sprintf("key %s does not exist or is locked", positional[0]))
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+// lockRetryInterval is how often a held lock is tried again when waiting
+// for it.
+const lockRetryInterval = 500 * time.Millisecond
+
+// acquireLock acquires key, trying again until timeout has passed if wait
+// is set. A timeout of zero waits forever.
+func acquireLock(client *api.Client, key string, value string, ttl time.Duration, wait bool, timeout time.Duration) (success bool, sessionID string, err error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		success, sessionID, err = client.Acquire(key, value, ttl)
+		if err != nil || success || !wait {
+			return
+		}
+		if timeout > 0 && time.Now().Add(lockRetryInterval).After(deadline) {
+			return
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func lockAcquire(args []string) error {
+	c := newClientFlags("lock acquire [flags] KEY")
+	ttl := c.flags.Duration("ttl", 30*time.Second, "session TTL, the lock is released unless the session is renewed in time")
+	value := c.flags.String("value", "", "value to store if the key does not exist yet")
+	wait := c.flags.Bool("wait", false, "wait for the lock if it is held")
+	timeout := c.flags.Duration("timeout", 0, "give up waiting after this long, 0 waits forever")
+	positional, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	success, sessionID, err := acquireLock(client, positional[0], *value, *ttl, *wait, *timeout)
+	if err != nil {
+		return err
+	}
+
+	ret := types.AcquireReturn{Success: success}
+	if success {
+		ret.SessionID = sessionID
+	}
+
+	if err := c.print(ret, func(w io.Writer) {
+		if success {
+			fmt.Fprintln(w, sessionID)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if !success {
+		return errUnsuccessful(fmt.Sprintf("key %s is locked", positional[0]))
+	}
+
+	return nil
+}
+
+func lockRelease(args []string) error {
+	c := newClientFlags("lock release [flags] KEY SESSION")
+	positional, err := c.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	success, err := client.Release(positional[0], positional[1])
+	if err != nil {
+		return err
+	}
+
+	if err := c.print(types.ReleaseReturn{Success: success}, func(w io.Writer) {}); err != nil {
+		return err
+	}
+
+	if !success {
+		return errUnsuccessful(fmt.Sprintf("session %s does not hold key %s", positional[1], positional[0]))
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func sessionList(args []string) error {
+	c := newClientFlags("session list [flags]")
+	if _, err := c.parse(args, 0); err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	ret, err := client.Sessions()
+	if err != nil {
+		return err
+	}
+
+	return c.print(ret, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SESSION\tKEY\tOWNER\tCREATED\tTTL")
+		for _, s := range ret.Sessions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.ID, s.Key, s.Owner, s.CreatedAt.Local().Format(time.RFC3339), s.TTLRemaining.Round(time.Second))
+		}
+		tw.Flush()
+	})
+}
+
+func sessionRenew(args []string) error {
+	c := newClientFlags("session renew [flags] SESSION")
+	ttl := c.flags.Duration("ttl", 30*time.Second, "new session TTL")
+	positional, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if err := client.RenewSession(positional[0], *ttl); err != nil {
+		return err
+	}
+
+	return c.print(types.AdminReturn{Success: true}, func(w io.Writer) {})
+}
+
+func sessionDestroy(args []string) error {
+	c := newClientFlags("session destroy [flags] SESSION")
+	positional, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if err := client.DestroySession(positional[0]); err != nil {
+		return err
+	}
+
+	return c.print(types.AdminReturn{Success: true}, func(w io.Writer) {})
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+// watch prints the value of a key whenever it changes. With -grpc the
+// server streams every change, otherwise the key is polled and changes
+// between two polls are missed.
+func watch(args []string) error {
+	c := newClientFlags("watch [flags] KEY")
+	interval := c.flags.Duration("interval", time.Second, "poll interval, unused with -grpc")
+	positional, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var last *types.GetReturn
+	show := func(ret *types.GetReturn) error {
+		if last != nil && *last == *ret {
+			return nil
+		}
+		last = ret
+		return c.print(ret, func(w io.Writer) {
+			now := time.Now().Format(time.RFC3339)
+			if ret.Success {
+				fmt.Fprintf(w, "%s %s\n", now, ret.Value)
+			} else {
+				fmt.Fprintf(w, "%s (deleted)\n", now)
+			}
+		})
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	events, errs, err := client.Watch(positional[0], done)
+	if errors.Is(err, api.ErrGRPCRequired) {
+		return poll(client, positional[0], *interval, interrupt, show)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ret, ok := <-events:
+			if !ok {
+				return <-errs
+			}
+			if err := show(ret); err != nil {
+				return err
+			}
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// poll gets key every interval and passes it to show until interrupted.
+func poll(client *api.Client, key string, interval time.Duration, interrupt <-chan os.Signal, show func(ret *types.GetReturn) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ret, err := client.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := show(ret); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			return nil
+		}
+	}
+}
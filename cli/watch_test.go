@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+func TestWatchPollsWithoutGRPC(t *testing.T) {
+	f := newFakeServer(t)
+	client, err := newClientFlags("watch [flags] KEY").client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.Watch("k", nil); err != api.ErrGRPCRequired {
+		t.Fatalf("watch without gRPC: %v", err)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	shown := []*types.GetReturn{}
+	err = poll(client, "k", time.Millisecond, interrupt, func(ret *types.GetReturn) error {
+		shown = append(shown, ret)
+		if len(shown) == 3 {
+			interrupt <- os.Interrupt
+		}
+		return nil
+	})
+	// ticks due together with the interrupt may still poll again
+	if err != nil || len(shown) < 3 || shown[0].Value != "v" {
+		t.Fatalf("shown %v: %v", shown, err)
+	}
+	if sent := f.sent(); len(sent) != len(shown) || sent[0] != "/kv/get/k" {
+		t.Fatalf("sent %v", sent)
+	}
+
+	if err := poll(client, "fail", time.Millisecond, interrupt, nil); err == nil {
+		t.Fatal("failed get did not end the watch")
+	}
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+func newClient(t *testing.T, ts *httptest.Server, token string) *api.Client {
+	t.Helper()
+
+	client, err := api.NewClient(ts.URL, api.WithToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAdminListings(t *testing.T) {
+	ts := newAuthTestServer(t)
+	alice := newClient(t, ts, "t-alice")
+	admin := newClient(t, ts, "t-root")
+
+	_, first, err := alice.Acquire("a-1", "", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := alice.AcquireAll(context.Background(), []string{"a-3", "a-2"}, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := alice.LockMutex("m-1", nil); err != nil || !ok {
+		t.Fatalf("mutex lock failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/mutex/lock/m-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer t-bob")
+	go func() {
+		if resp, err := ts.Client().Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	status := types.StatusReturn{}
+	for deadline := time.Now().Add(5 * time.Second); status.BlockedWaiters != 1 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		callAs(t, ts, "t-root", http.MethodGet, "/status", "", &status)
+	}
+
+	sessions, err := admin.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions.Sessions) != 2 || sessions.Sessions[0].ID != first || sessions.Sessions[1].ID != second {
+		t.Fatalf("sessions not listed by creation: %+v", sessions)
+	}
+	for _, s := range sessions.Sessions {
+		if s.Owner != "alice" || s.TTLRemaining <= 0 || s.TTLRemaining > 10*time.Second || s.ExpiresAt.Sub(s.CreatedAt).Round(time.Second) != 10*time.Second {
+			t.Errorf("session %+v", s)
+		}
+	}
+	if keys := sessions.Sessions[1].Keys; !reflect.DeepEqual(keys, []string{"a-2", "a-3"}) {
+		t.Errorf("acquireall session lists %v", keys)
+	}
+
+	locks, err := admin.Locks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.LockInfo{
+		{Primitive: "kv", Key: "a-1", Owner: "alice", SessionID: first, Holds: 1},
+		{Primitive: "kv", Key: "a-2", Owner: "alice", SessionID: second, Holds: 1},
+		{Primitive: "kv", Key: "a-3", Owner: "alice", SessionID: second, Holds: 1},
+		{Primitive: "mutex", Key: "m-1", Owner: "alice", Waiters: 1},
+	}
+	if !reflect.DeepEqual(locks.Locks, want) {
+		t.Fatalf("got %+v, want %+v", locks.Locks, want)
+	}
+}
+
+func TestAdminForce(t *testing.T) {
+	ts := newAuthTestServer(t)
+	alice := newClient(t, ts, "t-alice")
+	bob := newClient(t, ts, "t-bob")
+	admin := newClient(t, ts, "t-root")
+
+	_, first, _ := alice.Acquire("a-1", "", 10*time.Second)
+	_, second, _ := alice.AcquireAll(context.Background(), []string{"a-2", "a-3"}, 10*time.Second)
+	alice.LockMutex("m-1", nil)
+
+	if ok, err := admin.ForceRelease("a-1"); err != nil || !ok {
+		t.Fatalf("force release failed: %v", err)
+	}
+	if ok, _ := admin.ForceRelease("a-1"); ok {
+		t.Fatal("force release of an unlocked key succeeded")
+	}
+	if ok, _ := alice.Release("a-1", first); ok {
+		t.Fatal("holder released a force-released lock")
+	}
+	if ok, _, err := bob.Acquire("a-1", "", 10*time.Second); err != nil || !ok {
+		t.Fatalf("force-released lock could not be acquired: %v", err)
+	}
+
+	if ok, err := admin.ForceExpireSession(second); err != nil || !ok {
+		t.Fatalf("force expire failed: %v", err)
+	}
+	if ok, _ := admin.ForceExpireSession(second); ok {
+		t.Fatal("force expire of a missing session succeeded")
+	}
+	if err := alice.RenewSession(second, 10*time.Second); err == nil {
+		t.Fatal("force-expired session was renewed")
+	}
+	for _, key := range []string{"a-2", "a-3"} {
+		if ret, _ := alice.Get(key); ret.Locked {
+			t.Fatalf("%s is still locked by the expired session", key)
+		}
+	}
+
+	timeout := 100 * time.Millisecond
+	if ok, _ := bob.LockMutex("m-1", &timeout); ok {
+		t.Fatal("locked mutex was locked again")
+	}
+	if ok, err := admin.ForceUnlockMutex("m-1"); err != nil || !ok {
+		t.Fatalf("force unlock failed: %v", err)
+	}
+	if ok, err := bob.LockMutex("m-1", &timeout); err != nil || !ok {
+		t.Fatalf("force-unlocked mutex could not be locked: %v", err)
+	}
+	if ok, _ := alice.UnlockMutex("m-1"); ok {
+		t.Fatal("former owner unlocked the mutex")
+	}
+
+	entries := types.AuditReturn{}
+	callAs(t, ts, "t-root", http.MethodGet, "/audit/a-1", "", &entries)
+	if len(entries.Entries) < 2 || entries.Entries[1].Action != types.AuditActionForceRelease || entries.Entries[1].Identity != "root" {
+		t.Fatalf("force release was not audited: %+v", entries.Entries)
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	ts := newAuthTestServer(t)
+	admin := newClient(t, ts, "t-root")
+
+	for _, key := range []string{"p-1", "p-2", "q-1"} {
+		admin.Set(key, "v", "")
+	}
+	_, sessionID, _ := admin.Acquire("p-3", "", 10*time.Second)
+
+	deleted, err := admin.PurgePrefix("p-")
+	if err != nil || deleted != 3 {
+		t.Fatalf("purged %d: %v", deleted, err)
+	}
+	if keys, _ := admin.Keys(""); !reflect.DeepEqual(keys, []string{"q-1"}) {
+		t.Fatalf("keys left: %v", keys)
+	}
+	if locks, _ := admin.Locks(); len(locks.Locks) != 0 {
+		t.Fatalf("purged key is still locked: %+v", locks.Locks)
+	}
+	if ok, _ := admin.Release("p-3", sessionID); ok {
+		t.Fatal("purged key was released")
+	}
+
+	if _, err := admin.PurgePrefix(""); err == nil {
+		t.Fatal("purging everything was accepted")
+	}
+}
+
+func TestAdminRequiresAdmin(t *testing.T) {
+	ts := newAuthTestServer(t)
+	alice := newClient(t, ts, "t-alice")
+
+	if _, err := alice.Sessions(); err == nil {
+		t.Error("sessions listed without admin")
+	}
+	if _, err := alice.Locks(); err == nil {
+		t.Error("locks listed without admin")
+	}
+	if _, err := alice.ForceRelease("a-1"); err == nil {
+		t.Error("force release without admin")
+	}
+	if _, err := alice.ForceExpireSession("s"); err == nil {
+		t.Error("force expire without admin")
+	}
+	if _, err := alice.ForceUnlockMutex("m-1"); err == nil {
+		t.Error("force unlock without admin")
+	}
+	if _, err := alice.PurgePrefix("a-"); err == nil {
+		t.Error("purge without admin")
+	}
+
+	for _, path := range []string{"/admin/sessions/s", "/admin/locks/kv/a-1", "/admin/locks/mutex/m-1", "/admin/keys?prefix=a-"} {
+		if code := callAs(t, ts, "t-alice", http.MethodDelete, path, "", nil); code != http.StatusForbidden {
+			t.Errorf("%s: got %d", path, code)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+const auditLogSize = 10000
+
+// auditLog writes every ownership change as a JSON line and keeps the most
+// recent entries in memory for /audit queries.
+type auditLog struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	recent  []types.AuditEntry
+	next    int
+	// watchers are notified of the entries of their key.
+	watchers map[auditKey]map[chan struct{}]bool
+}
+
+type auditKey struct {
+	namespace string
+	key       string
+}
+
+// newAuditLog appends to the file at path, writes to stdout if path is "-"
+// and only keeps entries in memory if path is empty.
+func newAuditLog(path string) (*auditLog, error) {
+	var out io.Writer
+	var file *os.File
+
+	switch path {
+	case "":
+	case "-":
+		out = os.Stdout
+	default:
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+		file = f
+	}
+
+	ret := &auditLog{
+		file:     file,
+		recent:   make([]types.AuditEntry, 0, auditLogSize),
+		watchers: map[auditKey]map[chan struct{}]bool{},
+	}
+
+	if out != nil {
+		ret.encoder = json.NewEncoder(out)
+	}
+
+	return ret, nil
+}
+
+// close syncs and closes the audit log file, if any.
+func (a *auditLog) close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+
+	a.encoder = nil
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+func (a *auditLog) record(entry types.AuditEntry) {
+	entry.Time = time.Now().UTC()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.encoder != nil {
+		a.encoder.Encode(entry)
+	}
+
+	if len(a.recent) < auditLogSize {
+		a.recent = append(a.recent, entry)
+	} else {
+		a.recent[a.next] = entry
+	}
+	a.next = (a.next + 1) % auditLogSize
+
+	for ch := range a.watchers[auditKey{entry.Namespace, entry.Key}] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch returns a channel that receives a value once an entry for key is
+// recorded, as every change of a key is, and a function to stop watching.
+// Entries recorded while the value was not received yet are merged.
+func (a *auditLog) watch(namespace string, key string) (<-chan struct{}, func()) {
+	k := auditKey{namespace, key}
+	ch := make(chan struct{}, 1)
+
+	a.lock.Lock()
+	if a.watchers[k] == nil {
+		a.watchers[k] = map[chan struct{}]bool{}
+	}
+	a.watchers[k][ch] = true
+	a.lock.Unlock()
+
+	return ch, func() {
+		a.lock.Lock()
+		delete(a.watchers[k], ch)
+		if len(a.watchers[k]) == 0 {
+			delete(a.watchers, k)
+		}
+		a.lock.Unlock()
+	}
+}
+
+// recordRequest records an action of the client that sent r.
+func (a *auditLog) recordRequest(r *http.Request, action types.AuditAction, p primitive, key string, sessionID string, detail string) {
+	a.record(types.AuditEntry{
+		Action:     action,
+		Namespace:  requestNamespace(r).Name,
+		Primitive:  string(p),
+		Key:        key,
+		SessionID:  sessionID,
+		Identity:   identity(r),
+		RemoteAddr: r.RemoteAddr,
+		Detail:     detail,
+	})
+}
+
+// query returns up to limit of the most recent entries for key whose
+// primitive passes filter, newest first.
+func (a *auditLog) query(namespace string, key string, limit int, filter func(p primitive) bool) []types.AuditEntry {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	ret := []types.AuditEntry{}
+	for i := 1; i <= len(a.recent) && len(ret) < limit; i++ {
+		entry := a.recent[(a.next-i+len(a.recent))%len(a.recent)]
+		if entry.Namespace != namespace || entry.Key != key {
+			continue
+		}
+		if !filter(primitive(entry.Primitive)) {
+			continue
+		}
+		ret = append(ret, entry)
+	}
+	return ret
+}
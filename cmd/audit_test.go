@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func auditActions(entries []types.AuditEntry) []types.AuditAction {
+	ret := []types.AuditAction{}
+	for _, entry := range entries {
+		ret = append(ret, entry.Action)
+	}
+	return ret
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	config := DefaultConfig()
+	config.AuditLog = path
+	config.AuthFile = writeACL(t, testACL)
+	ts := newTestServer(t, config)
+
+	acquired := types.AcquireReturn{}
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/acquire/a-1/10s", "", &acquired)
+	sessionID := acquired.SessionID
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/set/a-1?value=v&sessionId="+sessionID, "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/session/renew/"+sessionID+"/20s", "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/release/a-1/"+sessionID, "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/delete/a-1", "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/set/a-2?value=v", "", nil)
+
+	ret := types.AuditReturn{}
+	callAs(t, ts, "t-bob", http.MethodGet, "/audit/a-1", "", &ret)
+
+	want := []types.AuditAction{types.AuditActionDelete, types.AuditActionRelease, types.AuditActionRenew, types.AuditActionSet, types.AuditActionAcquire}
+	if got := auditActions(ret.Entries); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v newest first", got, want)
+	}
+	for _, entry := range ret.Entries {
+		if entry.Identity != "alice" || entry.Namespace != defaultNamespace || entry.Primitive != string(primitiveKV) || entry.Key != "a-1" || entry.RemoteAddr == "" || entry.Time.IsZero() {
+			t.Errorf("incomplete entry: %+v", entry)
+		}
+		if entry.Action != types.AuditActionDelete && entry.SessionID != sessionID {
+			t.Errorf("entry without the session: %+v", entry)
+		}
+	}
+	if ret.Entries[2].Detail != "20s" {
+		t.Errorf("renew does not record the TTL: %+v", ret.Entries[2])
+	}
+
+	// the file holds the same entries as JSON lines, oldest first
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	logged := []types.AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := types.AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: %v", scanner.Bytes(), err)
+		}
+		logged = append(logged, entry)
+	}
+	if len(logged) != 6 || logged[0].Action != types.AuditActionAcquire || logged[5].Key != "a-2" {
+		t.Fatalf("audit file holds %+v", logged)
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthFile = writeACL(t, testACL)
+	ts := newTestServer(t, config)
+
+	callAs(t, ts, "t-root", http.MethodPost, "/kv/set/m-1?value=v", "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/mutex/lock/m-1", "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/mutex/unlock/m-1", "", nil)
+	callAs(t, ts, "t-alice", http.MethodPost, "/mutex/lock/m-1", "", nil)
+
+	ret := types.AuditReturn{}
+	callAs(t, ts, "t-root", http.MethodGet, "/audit/m-1", "", &ret)
+	if len(ret.Entries) != 4 {
+		t.Fatalf("got %+v", ret.Entries)
+	}
+
+	ret = types.AuditReturn{}
+	callAs(t, ts, "t-root", http.MethodGet, "/audit/m-1?primitive=mutex&limit=2", "", &ret)
+	want := []types.AuditAction{types.AuditActionAcquire, types.AuditActionRelease}
+	if got := auditActions(ret.Entries); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// entries are only shown with the read right on their primitive, alice
+	// may lock the mutex but not read it
+	ret = types.AuditReturn{}
+	callAs(t, ts, "t-alice", http.MethodGet, "/audit/m-1", "", &ret)
+	if len(ret.Entries) != 0 {
+		t.Fatalf("alice reads %+v", ret.Entries)
+	}
+
+	for _, limit := range []string{"0", "-1", "x"} {
+		if code := callAs(t, ts, "t-root", http.MethodGet, "/audit/m-1?limit="+limit, "", nil); code != http.StatusBadRequest {
+			t.Errorf("limit %s got %d", limit, code)
+		}
+	}
+}
+
+func TestAuditExpiry(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	createNamespace(t, ts, "team", "")
+
+	acquired := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/ns/team/kv/acquire/k/100ms", "", &acquired)
+
+	// the key was created by the acquire and is deleted with the session
+	want := []types.AuditAction{types.AuditActionDelete, types.AuditActionExpire, types.AuditActionAcquire}
+	ret := types.AuditReturn{}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		call(t, ts, http.MethodGet, "/ns/team/audit/k", "", &ret)
+		if len(ret.Entries) == len(want) {
+			break
+		}
+	}
+	if got := auditActions(ret.Entries); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if expired := ret.Entries[1]; expired.SessionID != acquired.SessionID {
+		t.Fatalf("incomplete expiry: %+v", expired)
+	}
+
+	// entries are kept per namespace
+	ret = types.AuditReturn{}
+	call(t, ts, http.MethodGet, "/audit/k", "", &ret)
+	if len(ret.Entries) != 0 {
+		t.Fatalf("default namespace shows %+v", ret.Entries)
+	}
+}
+
+func TestAuditLogWraps(t *testing.T) {
+	audit, err := newAuditLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < auditLogSize+5; i++ {
+		audit.record(types.AuditEntry{Namespace: defaultNamespace, Key: "k", Detail: strconv.Itoa(i)})
+	}
+
+	all := func(p primitive) bool { return true }
+	entries := audit.query(defaultNamespace, "k", auditLogSize+5, all)
+	if len(entries) != auditLogSize {
+		t.Fatalf("kept %d entries, want %d", len(entries), auditLogSize)
+	}
+	if entries[0].Detail != strconv.Itoa(auditLogSize+4) || entries[auditLogSize-1].Detail != "5" {
+		t.Fatalf("kept %s to %s", entries[auditLogSize-1].Detail, entries[0].Detail)
+	}
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+type primitive string
+
+const (
+	primitiveKV    primitive = "kv"
+	primitiveInt   primitive = "int"
+	primitiveMutex primitive = "mutex"
+	primitiveQueue primitive = "queue"
+)
+
+type right string
+
+const (
+	rightRead  right = "read"
+	rightWrite right = "write"
+	rightLock  right = "lock"
+)
+
+// aclPolicy grants rights on all keys of a primitive starting with Prefix.
+// An empty namespace or primitive matches every namespace or primitive.
+type aclPolicy struct {
+	Namespace string    `json:"namespace"`
+	Primitive primitive `json:"primitive"`
+	Prefix    string    `json:"prefix"`
+	Rights    []right   `json:"rights"`
+}
+
+type authToken struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+	// Admin grants access to the /admin endpoints.
+	Admin    bool        `json:"admin"`
+	Policies []aclPolicy `json:"policies"`
+}
+
+type authFile struct {
+	Tokens []authToken `json:"tokens"`
+}
+
+type acl struct {
+	tokens map[string]*authToken
+	names  map[string]*authToken
+}
+
+type authContextKey struct{}
+
+type identityContextKey struct{}
+
+// loadACL reads the tokens and their policies from a JSON file:
+//
+//	{"tokens": [{"token": "s3cr3t", "name": "deployer", "policies": [
+//	    {"primitive": "kv", "prefix": "deploy/", "rights": ["read", "lock"]}
+//	]}]}
+func loadACL(path string) (*acl, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := authFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	ret := &acl{
+		tokens: map[string]*authToken{},
+		names:  map[string]*authToken{},
+	}
+
+	for idx := range file.Tokens {
+		token := &file.Tokens[idx]
+		if token.Token == "" {
+			return nil, fmt.Errorf("%s: token %d is empty", path, idx)
+		}
+		if _, ok := ret.tokens[token.Token]; ok {
+			return nil, fmt.Errorf("%s: token %d is not unique", path, idx)
+		}
+		if token.Name == "" {
+			token.Name = fmt.Sprintf("token-%d", idx)
+		}
+		if _, ok := ret.names[token.Name]; ok {
+			return nil, fmt.Errorf("%s: name %s is not unique", path, token.Name)
+		}
+		for _, policy := range token.Policies {
+			for _, r := range policy.Rights {
+				if r != rightRead && r != rightWrite && r != rightLock {
+					return nil, fmt.Errorf("%s: unknown right %q for %s", path, r, token.Name)
+				}
+			}
+		}
+		ret.tokens[token.Token] = token
+		ret.names[token.Name] = token
+	}
+
+	return ret, nil
+}
+
+func (t *authToken) allowed(ns string, p primitive, key string, r right) bool {
+	for _, policy := range t.Policies {
+		if policy.Namespace != "" && policy.Namespace != ns {
+			continue
+		}
+		if policy.Primitive != "" && policy.Primitive != p {
+			continue
+		}
+		if !strings.HasPrefix(key, policy.Prefix) {
+			continue
+		}
+		for _, granted := range policy.Rights {
+			if granted == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// certIdentity returns the common name of a verified client certificate.
+func certIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	return ""
+}
+
+// authenticate rejects requests without a known bearer token or a client
+// certificate whose common name matches the name of a token. It lets
+// everything through if authentication is disabled, and the health probes
+// always.
+func (a *acl) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if a == nil {
+			if name := certIdentity(r); name != "" {
+				logFields(r, "identity", name)
+				r = r.WithContext(context.WithValue(r.Context(), identityContextKey{}, name))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var token *authToken
+
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			var ok bool
+			token, ok = a.tokens[strings.TrimPrefix(header, "Bearer ")]
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+		} else if name := certIdentity(r); name != "" {
+			token = a.names[name]
+		}
+
+		if token == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		logFields(r, "identity", token.Name)
+
+		ctx := context.WithValue(r.Context(), authContextKey{}, token)
+		ctx = context.WithValue(ctx, identityContextKey{}, token.Name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorize checks the right on the key taken from the URL parameter
+// keyParam. Routes operating on several keys check them with allowed in the
+// handler instead.
+func authorize(p primitive, keyParam string, rt right) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed(r, p, chi.URLParam(r, keyParam), rt) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func allowed(r *http.Request, p primitive, key string, rt right) bool {
+	token, ok := r.Context().Value(authContextKey{}).(*authToken)
+	if !ok {
+		// authentication is disabled
+		return true
+	}
+	return token.allowed(requestNamespace(r).Name, p, key, rt)
+}
+
+// requireAdmin rejects requests not made with an admin token. Everyone is
+// an admin if authentication is disabled.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := r.Context().Value(authContextKey{}).(*authToken); ok && !token.Admin {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identity returns the name of the token or client certificate the request
+// was made with, or an empty string if the client is anonymous.
+func identity(r *http.Request) string {
+	if name, ok := r.Context().Value(identityContextKey{}).(string); ok {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+const testACL = `{"tokens": [
+	{"token": "t-alice", "name": "alice", "policies": [
+		{"primitive": "kv", "prefix": "a-", "rights": ["read", "write", "lock"]},
+		{"primitive": "mutex", "prefix": "m-", "rights": ["lock"]},
+		{"primitive": "int", "prefix": "c-", "rights": ["read", "write"]}
+	]},
+	{"token": "t-bob", "name": "bob", "policies": [
+		{"primitive": "kv", "prefix": "a-", "rights": ["read", "lock"]},
+		{"primitive": "mutex", "prefix": "m-", "rights": ["lock"]},
+		{"primitive": "int", "prefix": "c-", "rights": ["read"]}
+	]},
+	{"token": "t-root", "name": "root", "admin": true, "policies": [
+		{"rights": ["read", "write", "lock"]}
+	]}
+]}`
+
+func writeACL(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "auth.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newAuthTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.AuthFile = writeACL(t, testACL)
+	return newTestServer(t, config)
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newAuthTestServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/kv/get/a-1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("token %q: got %d with WWW-Authenticate %q", token, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	// a token of another scheme is not a bearer token
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/kv/get/a-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Basic dC1hbGljZQ==")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("basic authentication got %d", resp.StatusCode)
+	}
+
+	// the probes need no token
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code := call(t, ts, http.MethodGet, path, "", nil); code != http.StatusOK {
+			t.Errorf("%s without a token got %d", path, code)
+		}
+	}
+
+	if code := callAs(t, ts, "t-alice", http.MethodGet, "/kv/get/a-1", "", nil); code != http.StatusOK {
+		t.Fatalf("valid token got %d", code)
+	}
+}
+
+func TestACL(t *testing.T) {
+	ts := newAuthTestServer(t)
+
+	for _, tc := range []struct {
+		token, method, path string
+		want                int
+	}{
+		{"t-alice", http.MethodPost, "/kv/set/a-1?value=v", http.StatusOK},
+		{"t-alice", http.MethodPost, "/kv/set/b-1?value=v", http.StatusForbidden},
+		{"t-alice", http.MethodGet, "/kv/get/b-1", http.StatusForbidden},
+		{"t-bob", http.MethodGet, "/kv/get/a-1", http.StatusOK},
+		{"t-bob", http.MethodPost, "/kv/set/a-1?value=w", http.StatusForbidden},
+		{"t-bob", http.MethodPost, "/kv/delete/a-1", http.StatusForbidden},
+		{"t-bob", http.MethodPost, "/kv/acquire/b-1/10s", http.StatusForbidden},
+		{"t-alice", http.MethodPost, "/mutex/lock/a-1", http.StatusForbidden},
+		{"t-alice", http.MethodPost, "/int/c-1?op=inc", http.StatusOK},
+		{"t-bob", http.MethodPost, "/int/c-1?op=get", http.StatusOK},
+		{"t-bob", http.MethodPost, "/int/c-1?op=inc", http.StatusForbidden},
+		{"t-alice", http.MethodPost, "/queue/push/q?value=v", http.StatusForbidden},
+		{"t-root", http.MethodPost, "/kv/set/b-1?value=v", http.StatusOK},
+		{"t-alice", http.MethodGet, "/admin/sessions", http.StatusForbidden},
+		{"t-alice", http.MethodGet, "/metrics", http.StatusForbidden},
+		{"t-root", http.MethodGet, "/admin/sessions", http.StatusOK},
+	} {
+		if code := callAs(t, ts, tc.token, tc.method, tc.path, "", nil); code != tc.want {
+			t.Errorf("%s %s %s: got %d, want %d", tc.token, tc.method, tc.path, code, tc.want)
+		}
+	}
+
+	// listings only show what the token may read
+	keys := []string{}
+	callAs(t, ts, "t-bob", http.MethodGet, "/kv/keys", "", &keys)
+	if !reflect.DeepEqual(keys, []string{"a-1"}) {
+		t.Fatalf("bob lists %v", keys)
+	}
+
+	// every key of a multi-key request is checked
+	if code := callAs(t, ts, "t-alice", http.MethodPost, "/kv/setm", `{"entries":[{"key":"a-2","value":"v"},{"key":"b-2","value":"v"}]}`, nil); code != http.StatusForbidden {
+		t.Fatalf("setm with a forbidden key got %d", code)
+	}
+	if code := callAs(t, ts, "t-alice", http.MethodPost, "/kv/acquireall/10s", `{"keys":["a-3","b-3"]}`, nil); code != http.StatusForbidden {
+		t.Fatalf("acquireall with a forbidden key got %d", code)
+	}
+	get := types.GetReturn{}
+	callAs(t, ts, "t-root", http.MethodGet, "/kv/get/a-2", "", &get)
+	if get.Success {
+		t.Fatal("refused setm wrote a key")
+	}
+}
+
+func TestACLProtectsOtherHolders(t *testing.T) {
+	ts := newAuthTestServer(t)
+
+	acquired := types.AcquireReturn{}
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/acquire/a-lock/10s", "", &acquired)
+	if !acquired.Success {
+		t.Fatal("alice could not acquire")
+	}
+	sessionID := acquired.SessionID
+
+	// bob knows the session but does not own it
+	if code := callAs(t, ts, "t-bob", http.MethodPost, "/session/destroy/"+sessionID, "", nil); code != http.StatusForbidden {
+		t.Errorf("destroying another's session got %d", code)
+	}
+	if code := callAs(t, ts, "t-bob", http.MethodPost, "/session/renew/"+sessionID+"/10s", "", nil); code != http.StatusForbidden {
+		t.Errorf("renewing another's session got %d", code)
+	}
+	released := types.ReleaseReturn{}
+	callAs(t, ts, "t-bob", http.MethodPost, "/kv/release/a-lock/"+sessionID, "", &released)
+	if released.Success {
+		t.Error("bob released alice's lock")
+	}
+
+	get := types.GetReturn{}
+	callAs(t, ts, "t-bob", http.MethodGet, "/kv/get/a-lock", "", &get)
+	if !get.Locked {
+		t.Fatal("alice lost her lock")
+	}
+
+	mutex := types.MutexReturn{}
+	callAs(t, ts, "t-alice", http.MethodPost, "/mutex/lock/m-1", "", &mutex)
+	if !mutex.Success {
+		t.Fatal("alice could not lock the mutex")
+	}
+	if code := callAs(t, ts, "t-bob", http.MethodPost, "/mutex/unlock/m-1", "", nil); code != http.StatusForbidden {
+		t.Errorf("unlocking another's mutex got %d", code)
+	}
+	if code := callAs(t, ts, "t-alice", http.MethodPost, "/mutex/unlock/m-1", "", nil); code != http.StatusOK {
+		t.Errorf("unlocking her own mutex got %d", code)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	ts := newAuthTestServer(t)
+
+	anonymous, err := api.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymous.Set("a-1", "v", ""); err == nil {
+		t.Fatal("set without a token succeeded")
+	}
+
+	client, err := api.NewClient(ts.URL, api.WithToken("t-alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := client.Set("a-1", "v", ""); err != nil || !ok {
+		t.Fatalf("set with a token failed: %v", err)
+	}
+	if _, err := client.Set("b-1", "v", ""); err == nil {
+		t.Fatal("set outside the token's prefix succeeded")
+	}
+}
+
+func TestLoadACLErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"tokens": [{"token": ""}]}`,
+		`{"tokens": [{"token": "a"}, {"token": "a"}]}`,
+		`{"tokens": [{"token": "a", "name": "x"}, {"token": "b", "name": "x"}]}`,
+		`{"tokens": [{"token": "a", "policies": [{"rights": ["admin"]}]}]}`,
+		`{"tokens": `,
+	} {
+		if _, err := loadACL(writeACL(t, data)); err == nil {
+			t.Errorf("%s: want an error", data)
+		}
+	}
+
+	if _, err := loadACL(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file was accepted")
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// maxBatchOps limits the operations of a batch, as an atomic batch blocks
+// all other key-value requests while it runs.
+const maxBatchOps = 100
+
+type atomicBatchContextKey struct{}
+
+// inAtomicBatch tells whether r is an operation of an atomic batch, which
+// holds the key-value lock while its operations run.
+func inAtomicBatch(r *http.Request) bool {
+	return r.Context().Value(atomicBatchContextKey{}) != nil
+}
+
+// batchSession resolves a $N reference to the session acquired by an
+// earlier operation.
+func batchSession(sessionID string, results []types.BatchResult) (string, error) {
+	if !strings.HasPrefix(sessionID, "$") {
+		return sessionID, nil
+	}
+
+	idx, err := strconv.Atoi(sessionID[1:])
+	if err != nil || idx < 0 || idx >= len(results) {
+		return "", fmt.Errorf("invalid session reference %s", sessionID)
+	}
+
+	ret := types.AcquireReturn{}
+	if err := json.Unmarshal(results[idx].Result, &ret); err != nil || ret.SessionID == "" || !ret.Success {
+		return "", fmt.Errorf("operation %d acquired no session", idx)
+	}
+	return ret.SessionID, nil
+}
+
+// legacyBatchOp returns the legacy request serving op.
+func legacyBatchOp(op types.BatchOp, results []types.BatchResult, atomic bool) (legacyRequest, error) {
+	sessionID, err := batchSession(op.SessionID, results)
+	if err != nil {
+		return legacyRequest{}, err
+	}
+
+	if op.Op != types.BatchOpRenew {
+		if err := required("key", op.Key); err != nil {
+			return legacyRequest{}, err
+		}
+	}
+
+	switch op.Op {
+	case types.BatchOpAcquire:
+		query := url.Values{"value": {op.Value}, "kind": {op.Kind}}
+		return legacyRequest{method: http.MethodPost, path: []string{"kv", "acquire", op.Key, op.TTL}, query: query}, required("ttl", op.TTL)
+	case types.BatchOpRelease:
+		return legacyRequest{method: http.MethodPost, path: []string{"kv", "release", op.Key, sessionID}}, required("sessionId", sessionID)
+	case types.BatchOpRenew:
+		if err := required("ttl", op.TTL); err != nil {
+			return legacyRequest{}, err
+		}
+		return legacyRequest{method: http.MethodPost, path: []string{"session", "renew", sessionID, op.TTL}}, required("sessionId", sessionID)
+	case types.BatchOpGet:
+		return legacyRequest{method: http.MethodGet, path: []string{"kv", "get", op.Key}}, nil
+	case types.BatchOpSet:
+		query := url.Values{"value": {op.Value}, "kind": {op.Kind}, "sessionId": {sessionID}}
+		return legacyRequest{method: http.MethodPost, path: []string{"kv", "set", op.Key}, query: query}, nil
+	case types.BatchOpDelete:
+		return legacyRequest{method: http.MethodPost, path: []string{"kv", "delete", op.Key}, query: url.Values{"sessionId": {sessionID}}}, nil
+	case types.BatchOpInt:
+		req := types.IntRequest{}
+		if op.Int != nil {
+			req = *op.Int
+		}
+		if req.SessionID == "" {
+			req.SessionID = op.SessionID
+		}
+		if req.TTL != "" && atomic {
+			// the expiry timer cannot be restored if the batch fails
+			return legacyRequest{}, errors.New("int ttl is not supported in atomic batches")
+		}
+		intSessionID, err := batchSession(req.SessionID, results)
+		if err != nil {
+			return legacyRequest{}, err
+		}
+		query := url.Values{"op": {string(op.IntOp)}, "ttl": {req.TTL}, "mode": {string(req.Mode)}, "sessionId": {intSessionID}}
+		for name, value := range map[string]*int64{"value": req.Value, "delta": req.Delta, "expected": req.Expected, "min": req.Min, "max": req.Max} {
+			if value != nil {
+				query.Set(name, strconv.FormatInt(*value, 10))
+			}
+		}
+		return legacyRequest{method: http.MethodPost, path: []string{"int", op.Key}, query: query}, required("intOp", string(op.IntOp))
+	}
+
+	return legacyRequest{}, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// readOnly tells whether op only reads. Reads report no success for
+// missing keys, which does not fail the batch.
+func readOnly(op types.BatchOp) bool {
+	return op.Op == types.BatchOpGet || op.Op == types.BatchOpInt && op.IntOp == types.IntOpTypeGet
+}
+
+// runBatch runs the operations with router. An atomic batch stops at the
+// first failure.
+func runBatch(router http.Handler, r *http.Request, req types.BatchRequest) types.BatchReturn {
+	ctx := r.Context()
+	if req.Atomic {
+		ctx = context.WithValue(ctx, atomicBatchContextKey{}, true)
+	}
+
+	ret := types.BatchReturn{
+		Success: true,
+		Results: []types.BatchResult{},
+	}
+
+	for idx, op := range req.Ops {
+		result := types.BatchResult{}
+
+		legacy, err := legacyBatchOp(op, ret.Results, req.Atomic)
+		if err != nil {
+			result.Status = http.StatusBadRequest
+			result.Error = fmt.Sprintf("operation %d: %s", idx, err)
+		} else {
+			query := url.Values{}
+			for name, values := range legacy.query {
+				if values[0] != "" {
+					query[name] = values
+				}
+			}
+
+			opReq := legacy.request(ctx, r, query)
+			opReq.Body = http.NoBody
+			opReq.ContentLength = 0
+			opReq.Header.Del("Content-Type")
+
+			buffer := newResponseBuffer()
+			router.ServeHTTP(buffer, opReq)
+			buffer.WriteHeader(http.StatusOK)
+
+			result.Status = buffer.status
+			if buffer.status == http.StatusOK {
+				status := struct {
+					Success *bool `json:"success"`
+				}{}
+				if buffer.body.Len() > 0 {
+					result.Result = json.RawMessage(buffer.body.Bytes())
+					json.Unmarshal(buffer.body.Bytes(), &status)
+				}
+				result.Success = status.Success == nil || *status.Success
+			} else {
+				result.Error = strings.TrimSpace(buffer.body.String())
+			}
+		}
+
+		ret.Results = append(ret.Results, result)
+
+		if !result.Success && (result.Status != http.StatusOK || !readOnly(op)) {
+			ret.Success = false
+			if req.Atomic {
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// batchSnapshot keeps the state an atomic batch may change so that it can
+// be restored if the batch fails. It is taken and restored while holding
+// the key-value lock.
+type batchSnapshot struct {
+	keys     map[string]*lockableValue
+	values   map[string]lockableValue
+	sessions map[string]*session
+	expires  map[string]time.Time
+}
+
+func snapshotBatch(ns *namespace, ops []types.BatchOp) *batchSnapshot {
+	s := &batchSnapshot{
+		keys:     map[string]*lockableValue{},
+		values:   map[string]lockableValue{},
+		sessions: map[string]*session{},
+		expires:  map[string]time.Time{},
+	}
+
+	for _, op := range ops {
+		if v, ok := ns.KVs[op.Key]; ok {
+			s.keys[op.Key] = v
+			s.values[op.Key] = *v
+		} else {
+			s.keys[op.Key] = nil
+		}
+	}
+
+	for id, sess := range ns.Sessions {
+		s.sessions[id] = sess
+		s.expires[id] = sess.ExpiresAt
+	}
+
+	return s
+}
+
+// restore undoes the changes of a failed atomic batch. Sessions it
+// acquired are removed, renewed ones get their previous expiry back.
+func (s *batchSnapshot) restore(ns *namespace, restart func(sess *session, ttl time.Duration), audit *auditLog) {
+	for id, sess := range ns.Sessions {
+		if _, ok := s.sessions[id]; !ok {
+			if sess.Timer != nil {
+				sess.Timer.Stop()
+			}
+			delete(ns.Sessions, id)
+		}
+	}
+
+	for id, sess := range s.sessions {
+		if sess.ExpiresAt != s.expires[id] {
+			restart(sess, time.Until(s.expires[id]))
+		}
+	}
+
+	for key, v := range s.keys {
+		if current, ok := ns.KVs[key]; ok && current != v && current.Timer != nil {
+			current.Timer.Stop()
+		}
+
+		if v == nil {
+			delete(ns.KVs, key)
+		} else {
+			*v = s.values[key]
+			ns.KVs[key] = v
+		}
+
+		audit.record(types.AuditEntry{
+			Action:    types.AuditActionRollback,
+			Namespace: ns.Name,
+			Primitive: string(primitiveKV),
+			Key:       key,
+			Detail:    "batch",
+		})
+	}
+}
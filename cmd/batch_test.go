@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func TestAtomicBatchRollback(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	held := acquire(t, ts, "held")
+
+	ret := types.BatchReturn{}
+	call(t, ts, http.MethodPost, "/batch", `{"atomic":true,"ops":[
+		{"op":"acquire","key":"a","ttl":"10s","value":"1"},
+		{"op":"set","key":"a","value":"2","sessionId":"$0"},
+		{"op":"int","key":"n","intOp":"inc"},
+		{"op":"acquire","key":"held","ttl":"10s"}
+	]}`, &ret)
+	if ret.Success || !ret.RolledBack || len(ret.Results) != 4 {
+		t.Fatalf("batch was not rolled back: %+v", ret)
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/a", "", &get)
+	if get.Success {
+		t.Fatalf("rolled back key still exists: %+v", get)
+	}
+	call(t, ts, http.MethodGet, "/kv/get/n", "", &get)
+	if get.Success {
+		t.Fatalf("rolled back counter still exists: %+v", get)
+	}
+
+	sessions := types.SessionsReturn{}
+	call(t, ts, http.MethodGet, "/admin/sessions", "", &sessions)
+	if len(sessions.Sessions) != 1 || sessions.Sessions[0].ID != held {
+		t.Fatalf("rolled back session survived: %+v", sessions.Sessions)
+	}
+}
+
+func TestBatchGetOfMissingKey(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	ret := types.BatchReturn{}
+	call(t, ts, http.MethodPost, "/batch", `{"atomic":true,"ops":[
+		{"op":"get","key":"missing"},
+		{"op":"set","key":"k","value":"v"}
+	]}`, &ret)
+	if !ret.Success || ret.RolledBack || len(ret.Results) != 2 || ret.Results[0].Success {
+		t.Fatalf("get of a missing key failed the batch: %+v", ret)
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/k", "", &get)
+	if !get.Success || get.Value != "v" {
+		t.Fatalf("set was rolled back: %+v", get)
+	}
+}
+
+func TestAtomicBatchRefusesDeleteOfLockedKey(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	held := acquire(t, ts, "held")
+
+	ret := types.BatchReturn{}
+	call(t, ts, http.MethodPost, "/batch", `{"atomic":true,"ops":[
+		{"op":"set","key":"a","value":"1"},
+		{"op":"delete","key":"held","sessionId":"`+held+`"}
+	]}`, &ret)
+	if ret.Success || !ret.RolledBack || ret.Results[1].Status != http.StatusBadRequest {
+		t.Fatalf("delete of a locked key was not refused: %+v", ret)
+	}
+
+	// the session and its lock are untouched
+	renew := types.RenewReturn{}
+	call(t, ts, http.MethodPost, "/session/renew/"+held+"/10s", "", &renew)
+	if !renew.Success || len(renew.Keys) != 1 || renew.Keys[0] != "held" {
+		t.Fatalf("session lost its lock: %+v", renew)
+	}
+	release := types.ReleaseReturn{}
+	call(t, ts, http.MethodPost, "/kv/release/held/"+held, "", &release)
+	if !release.Success {
+		t.Fatal("release after the rolled back batch failed")
+	}
+	acquire(t, ts, "held")
+}
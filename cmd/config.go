@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port int
+	// Listen is the address to listen on, e.g. 127.0.0.1:9876. It takes
+	// precedence over Port.
+	Listen       string
+	MaxValueSize int64
+	// AuthFile enables authentication with the tokens and ACLs it contains.
+	AuthFile string
+	// TLSCertFile and TLSKeyFile enable TLS. They are reloaded when they
+	// change on disk.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile enables mutual TLS, clients must present a
+	// certificate signed by one of its CAs.
+	TLSClientCAFile string
+	// AuditLog is the file the audit log is appended to, "-" for stdout.
+	AuditLog string
+	// LogFormat is either json or logfmt, LogLevel one of debug, info,
+	// warn and error.
+	LogFormat string
+	LogLevel  string
+	// ShutdownTimeout is how long in-flight requests may take to finish
+	// on SIGTERM, DefaultShutdownTimeout is used if zero.
+	ShutdownTimeout time.Duration
+	// TraceExporter enables tracing. Spans are sent to an OTLP/HTTP
+	// collector if it is an http(s) URL, written to stdout if it is "-"
+	// and appended to the file it names otherwise.
+	TraceExporter string
+	// MinTTL and MaxTTL limit session and lease TTLs, a zero MaxTTL
+	// allows any TTL.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// RESPListen enables the Redis protocol listener on this address.
+	RESPListen string
+	// GRPCListen enables the gRPC listener on this address.
+	GRPCListen string
+}
+
+const DefaultPort = 9876
+
+// EnvConfigFile names the configuration file if no -config flag is given.
+const EnvConfigFile = "DISTLOCK_CONFIG"
+
+func DefaultConfig() Config {
+	return Config{
+		Port:            DefaultPort,
+		MaxValueSize:    DefaultMaxValueSize,
+		LogFormat:       logFormatLogfmt,
+		LogLevel:        "info",
+		ShutdownTimeout: DefaultShutdownTimeout,
+		MinTTL:          DefaultMinTTL,
+		MaxTTL:          DefaultMaxTTL,
+	}
+}
+
+// Address returns the address the server listens on.
+func (c Config) Address() string {
+	if c.Listen != "" {
+		return c.Listen
+	}
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// configSetting is a key of the configuration file. It can also be set
+// with the environment variable DISTLOCK_<KEY>, e.g. tls.client_ca with
+// DISTLOCK_TLS_CLIENT_CA. Integers are written as in TOML in both.
+type configSetting struct {
+	key string
+	set func(c *Config, value string) error
+}
+
+func stringSetting(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+// unsupportedSetting rejects features this server does not have instead
+// of silently ignoring them.
+func unsupportedSetting(feature string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		if value == "" {
+			return nil
+		}
+		return fmt.Errorf("%s is not supported, all state is kept in memory by a single server", feature)
+	}
+}
+
+var configSettings = []configSetting{
+	{"listen", stringSetting(func(c *Config) *string { return &c.Listen })},
+	{"port", func(c *Config, value string) error {
+		port, err := parseTOMLInt(value, 32)
+		c.Port = int(port)
+		return err
+	}},
+	{"tls.cert", stringSetting(func(c *Config) *string { return &c.TLSCertFile })},
+	{"tls.key", stringSetting(func(c *Config) *string { return &c.TLSKeyFile })},
+	{"tls.client_ca", stringSetting(func(c *Config) *string { return &c.TLSClientCAFile })},
+	{"auth.file", stringSetting(func(c *Config) *string { return &c.AuthFile })},
+	{"audit.file", stringSetting(func(c *Config) *string { return &c.AuditLog })},
+	{"limits.max_value_size", func(c *Config, value string) error {
+		var err error
+		c.MaxValueSize, err = parseTOMLInt(value, 64)
+		return err
+	}},
+	{"limits.shutdown_timeout", func(c *Config, value string) error {
+		var err error
+		c.ShutdownTimeout, err = time.ParseDuration(value)
+		return err
+	}},
+	{"limits.min_ttl", func(c *Config, value string) error {
+		var err error
+		c.MinTTL, err = parseDuration(value)
+		return err
+	}},
+	{"limits.max_ttl", func(c *Config, value string) error {
+		var err error
+		c.MaxTTL, err = parseDuration(value)
+		return err
+	}},
+	{"log.format", stringSetting(func(c *Config) *string { return &c.LogFormat })},
+	{"log.level", stringSetting(func(c *Config) *string { return &c.LogLevel })},
+	{"trace.exporter", stringSetting(func(c *Config) *string { return &c.TraceExporter })},
+	{"resp.listen", stringSetting(func(c *Config) *string { return &c.RESPListen })},
+	{"grpc.listen", stringSetting(func(c *Config) *string { return &c.GRPCListen })},
+	{"persistence.dir", unsupportedSetting("persistence")},
+	{"cluster.peers", unsupportedSetting("clustering")},
+}
+
+func envName(key string) string {
+	return "DISTLOCK_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// ConfigErrors collects all problems found in a configuration.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for idx, err := range e {
+		lines[idx] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LoadConfig returns the default configuration overridden by the TOML
+// file at path, if not empty, and then by DISTLOCK_* environment
+// variables.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	errs := ConfigErrors{}
+
+	if path != "" {
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			return config, fmt.Errorf("%s: only TOML configuration files are supported", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, err
+		}
+
+		values, err := parseTOML(data)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+
+		known := map[string]bool{}
+		for _, setting := range configSettings {
+			known[setting.key] = true
+			if value, ok := values[setting.key]; ok {
+				if err := setting.set(&config, value); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s: %w", path, setting.key, err))
+				}
+			}
+		}
+
+		unknown := []string{}
+		for key := range values {
+			if !known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, key))
+		}
+	}
+
+	for _, setting := range configSettings {
+		if value, ok := os.LookupEnv(envName(setting.key)); ok {
+			if err := setting.set(&config, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", envName(setting.key), err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return config, errs
+	}
+	return config, nil
+}
+
+// Validate checks the configuration, including that the files it names
+// can be loaded, and reports all problems at once.
+func (c Config) Validate() error {
+	errs := ConfigErrors{}
+
+	if _, port, err := net.SplitHostPort(c.Address()); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %w", err))
+	} else if n, err := strconv.ParseUint(port, 10, 16); err != nil || (c.Listen == "" && n == 0) {
+		errs = append(errs, fmt.Errorf("listen: invalid port %s", port))
+	}
+
+	if c.RESPListen != "" {
+		if _, _, err := net.SplitHostPort(c.RESPListen); err != nil {
+			errs = append(errs, fmt.Errorf("resp.listen: %w", err))
+		}
+	}
+
+	if c.GRPCListen != "" {
+		if _, _, err := net.SplitHostPort(c.GRPCListen); err != nil {
+			errs = append(errs, fmt.Errorf("grpc.listen: %w", err))
+		}
+	}
+
+	if c.MaxValueSize <= 0 {
+		errs = append(errs, errors.New("limits.max_value_size must be positive"))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("limits.shutdown_timeout must not be negative"))
+	}
+	if c.MinTTL <= 0 {
+		errs = append(errs, errors.New("limits.min_ttl must be positive"))
+	}
+	if c.MaxTTL < 0 || c.MaxTTL > 0 && c.MaxTTL < c.MinTTL {
+		errs = append(errs, errors.New("limits.max_ttl must be zero or at least limits.min_ttl"))
+	}
+
+	if _, err := newLogger(io.Discard, c.LogFormat, c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+
+	if c.AuthFile != "" {
+		if _, err := loadACL(c.AuthFile); err != nil {
+			errs = append(errs, fmt.Errorf("auth.file: %w", err))
+		}
+	}
+
+	if _, err := serverTLSConfig(c); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// WriteTOML writes the configuration as a configuration file.
+func (c Config) WriteTOML(w io.Writer) {
+	fmt.Fprintf(w, "listen = %q\n", c.Address())
+	fmt.Fprintf(w, "\n[tls]\ncert = %q\nkey = %q\nclient_ca = %q\n", c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile)
+	fmt.Fprintf(w, "\n[auth]\nfile = %q\n", c.AuthFile)
+	fmt.Fprintf(w, "\n[audit]\nfile = %q\n", c.AuditLog)
+	fmt.Fprintf(w, "\n[limits]\nmax_value_size = %d\nshutdown_timeout = %q\nmin_ttl = %q\nmax_ttl = %q\n", c.MaxValueSize, c.ShutdownTimeout.String(), c.MinTTL.String(), c.MaxTTL.String())
+	fmt.Fprintf(w, "\n[log]\nformat = %q\nlevel = %q\n", c.LogFormat, c.LogLevel)
+	fmt.Fprintf(w, "\n[trace]\nexporter = %q\n", c.TraceExporter)
+	fmt.Fprintf(w, "\n[resp]\nlisten = %q\n", c.RESPListen)
+	fmt.Fprintf(w, "\n[grpc]\nlisten = %q\n", c.GRPCListen)
+}
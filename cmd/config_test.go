@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML([]byte(`
+# comment
+listen = "127.0.0.1:9876" # trailing comment
+port = 1_000
+
+[tls]
+cert = 'C:\certs\server.crt'
+client_ca = "ca \"quoted\".crt"
+
+[limits]
+hex = 0xff
+octal = 0o17
+binary = 0b101
+negative = -42
+zero = 0
+on = true
+
+[cluster]
+peers = ["a:1", 'b:2' ]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"listen":          "127.0.0.1:9876",
+		"port":            "1000",
+		"tls.cert":        `C:\certs\server.crt`,
+		"tls.client_ca":   `ca "quoted".crt`,
+		"limits.hex":      "255",
+		"limits.octal":    "15",
+		"limits.binary":   "5",
+		"limits.negative": "-42",
+		"limits.zero":     "0",
+		"limits.on":       "true",
+		"cluster.peers":   "a:1,b:2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, data := range []string{
+		"port = 012",
+		"port = 0_1",
+		"port = 1__000",
+		"port = _1",
+		"port = 1_",
+		"port = +0x10",
+		"port = 0x",
+		"port = 0o8",
+		"port = 1.5",
+		"port = yes",
+		"port =",
+		"port",
+		"port = 1 2",
+		"port = 1\nport = 2",
+		`listen = "open`,
+		"listen = 'open",
+		`listen = "\q"`,
+		"peers = [1, 2",
+		"peers = [1 2]",
+		"[tls",
+		"[tls] x",
+		"[a..b]",
+		"bad key = 1",
+	} {
+		if got, err := parseTOML([]byte(data)); err == nil {
+			t.Errorf("%q: got %v, want an error", data, got)
+		}
+	}
+}
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "distlock.toml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+listen = "127.0.0.1:7000"
+
+[limits]
+max_value_size = 0x1000
+min_ttl = "1s"
+max_ttl = "PT1H"
+
+[log]
+level = "debug"
+`)
+
+	// the environment overrides the file
+	t.Setenv("DISTLOCK_LOG_LEVEL", "warn")
+	t.Setenv("DISTLOCK_LIMITS_MIN_TTL", "2s")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Listen != "127.0.0.1:7000" || config.MaxValueSize != 4096 || config.MaxTTL != time.Hour {
+		t.Fatalf("file settings were not applied: %+v", config)
+	}
+	if config.LogLevel != "warn" || config.MinTTL != 2*time.Second {
+		t.Fatalf("environment did not override the file: %+v", config)
+	}
+	if config.ShutdownTimeout != DefaultShutdownTimeout || config.LogFormat != DefaultConfig().LogFormat {
+		t.Fatalf("unset settings lost their defaults: %+v", config)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("valid configuration was refused: %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	path := writeConfig(t, `
+port = "http"
+unknown = 1
+
+[limits]
+min_ttl = "soon"
+
+[persistence]
+dir = "/var/lib/distlock"
+`)
+	t.Setenv("DISTLOCK_LIMITS_MAX_VALUE_SIZE", "010")
+
+	_, err := LoadConfig(path)
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, want ConfigErrors", err)
+	}
+
+	// every problem is reported at once
+	for _, want := range []string{"port", "unknown setting unknown", "limits.min_ttl", "persistence is not supported", "DISTLOCK_LIMITS_MAX_VALUE_SIZE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("errors do not mention %q:\n%s", want, err)
+		}
+	}
+	if len(errs) != 5 {
+		t.Errorf("got %d errors, want 5:\n%s", len(errs), err)
+	}
+
+	if _, err := LoadConfig(writeConfig(t, "port = 012")); err == nil {
+		t.Error("integer with a leading zero was accepted")
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "distlock.yaml")); err == nil {
+		t.Error("YAML file was accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := DefaultConfig()
+	config.Listen = "nohost"
+	config.RESPListen = "6379"
+	config.MaxValueSize = 0
+	config.MinTTL = time.Second
+	config.MaxTTL = time.Millisecond
+	config.LogLevel = "loud"
+	config.AuthFile = filepath.Join(t.TempDir(), "missing.json")
+	config.TLSCertFile = "server.crt"
+
+	err := config.Validate()
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, want ConfigErrors", err)
+	}
+	for _, want := range []string{"listen", "resp.listen", "max_value_size", "max_ttl", "log", "auth.file", "tls"} {
+		if !strings.Contains(err.Error(), want+":") && !strings.Contains(err.Error(), want+" ") {
+			t.Errorf("errors do not mention %s:\n%s", want, err)
+		}
+	}
+	if len(errs) != 7 {
+		t.Errorf("got %d errors, want 7:\n%s", len(errs), err)
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default configuration is invalid: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMinTTL = 100 * time.Millisecond
+	// DefaultMaxTTL does not limit TTLs, so existing clients using long
+	// sessions keep working.
+	DefaultMaxTTL time.Duration = 0
+)
+
+// parseDuration accepts Go duration strings like 30s or 1m30s, ISO 8601
+// durations like PT30S and, for compatibility, integers as nanoseconds.
+func parseDuration(str string) (time.Duration, error) {
+	if str == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Duration(n), nil
+	}
+
+	if str[0] == 'P' || str[0] == 'p' {
+		return parseISODuration(str)
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, use e.g. 30s, 1m30s or PT30S", str)
+	}
+	return d, nil
+}
+
+// parseISODuration parses ISO 8601 durations made of weeks, days, hours,
+// minutes and seconds, e.g. P1DT12H or PT1.5S. Years and months are
+// rejected as their length varies.
+func parseISODuration(str string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid ISO 8601 duration %q", str)
+
+	rest := strings.ToUpper(str[1:])
+	if rest == "" || rest == "T" {
+		return 0, invalid
+	}
+
+	var total float64
+	inTime := false
+	units := map[bool]map[byte]time.Duration{
+		false: {'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour},
+		true:  {'H': time.Hour, 'M': time.Minute, 'S': time.Second},
+	}
+
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime || len(rest) == 1 {
+				return 0, invalid
+			}
+			inTime = true
+			rest = rest[1:]
+			continue
+		}
+
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.' && r != ','
+		})
+		if end <= 0 {
+			return 0, invalid
+		}
+
+		value, err := strconv.ParseFloat(strings.Replace(rest[:end], ",", ".", 1), 64)
+		if err != nil {
+			return 0, invalid
+		}
+
+		unit, ok := units[inTime][rest[end]]
+		if !ok {
+			if !inTime && (rest[end] == 'Y' || rest[end] == 'M') {
+				return 0, fmt.Errorf("ISO 8601 duration %q: years and months are not supported", str)
+			}
+			return 0, invalid
+		}
+
+		total += value * float64(unit)
+		rest = rest[end+1:]
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, which does not fit.
+	if total >= math.MaxInt64 {
+		return 0, fmt.Errorf("ISO 8601 duration %q is too long", str)
+	}
+	return time.Duration(total), nil
+}
+
+// parseTTL parses a session or lease TTL and checks it against the
+// configured limits.
+func parseTTL(str string, config Config) (time.Duration, error) {
+	ttl, err := parseDuration(str)
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl < config.MinTTL {
+		hint := ""
+		if _, err := strconv.ParseInt(str, 10, 64); err == nil {
+			hint = ", integers are nanoseconds, use a unit like " + str + "s"
+		}
+		return 0, fmt.Errorf("ttl %s is below the minimum of %s%s", ttl, config.MinTTL, hint)
+	}
+	if config.MaxTTL > 0 && ttl > config.MaxTTL {
+		return 0, fmt.Errorf("ttl %s is above the maximum of %s", ttl, config.MaxTTL)
+	}
+
+	return ttl, nil
+}
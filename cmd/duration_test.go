@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for _, test := range []struct {
+		str  string
+		want time.Duration
+		ok   bool
+	}{
+		{"30s", 30 * time.Second, true},
+		{"1500", 1500, true},
+		{"PT1.5S", 1500 * time.Millisecond, true},
+		{"P1DT12H", 36 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"P1M", 0, false},
+		{"PT", 0, false},
+		// 2^63 nanoseconds overflows
+		{"PT9223372036.854775808S", 0, false},
+		{"P15300W", 0, false},
+		{"P15000W", 15000 * 7 * 24 * time.Hour, true},
+	} {
+		got, err := parseDuration(test.str)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseDuration(%q) = %v, %v", test.str, got, err)
+		}
+	}
+}
+
+func TestParseTTLLimits(t *testing.T) {
+	config := DefaultConfig()
+
+	if _, err := parseTTL("8760h", config); err != nil {
+		t.Fatalf("default config limited a long TTL: %v", err)
+	}
+	if _, err := parseTTL("100", config); err == nil {
+		t.Fatal("TTL below the minimum was accepted")
+	}
+
+	config.MaxTTL = time.Hour
+	if _, err := parseTTL("2h", config); err == nil {
+		t.Fatal("TTL above the maximum was accepted")
+	}
+}
@@ -0,0 +1,527 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	distlockpb "github.com/DENKweit/distlock/proto"
+	"github.com/DENKweit/distlock/trace"
+	"github.com/DENKweit/distlock/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer serves the gRPC service of proto/distlock.proto. Like the
+// Redis protocol, calls are mapped to requests to the HTTP handler, so
+// authentication, namespaces, audit log and metrics apply as for HTTP
+// clients. The authorization, x-distlock-namespace and traceparent
+// metadata are passed on as headers.
+type grpcServer struct {
+	distlockpb.UnimplementedDistlockServer
+
+	handler      http.Handler
+	namespaces   *namespaceRegistry
+	audit        *auditLog
+	shuttingDown <-chan struct{}
+}
+
+var grpcIntOps = map[distlockpb.IntOp]types.IntOpType{
+	distlockpb.IntOp_INT_OP_GET:    types.IntOpTypeGet,
+	distlockpb.IntOp_INT_OP_INC:    types.IntOpTypeInc,
+	distlockpb.IntOp_INT_OP_DEC:    types.IntOpTypeDec,
+	distlockpb.IntOp_INT_OP_ADD:    types.IntOpTypeAdd,
+	distlockpb.IntOp_INT_OP_SET:    types.IntOpTypeSet,
+	distlockpb.IntOp_INT_OP_GETSET: types.IntOpTypeGetSet,
+	distlockpb.IntOp_INT_OP_CAS:    types.IntOpTypeCAS,
+	distlockpb.IntOp_INT_OP_RESET:  types.IntOpTypeReset,
+	distlockpb.IntOp_INT_OP_CREATE: types.IntOpTypeCreate,
+	distlockpb.IntOp_INT_OP_BOUNDS: types.IntOpTypeBounds,
+}
+
+var grpcIntModes = map[distlockpb.IntMode]types.IntMode{
+	distlockpb.IntMode_INT_MODE_PUBLIC:  types.IntModePublic,
+	distlockpb.IntMode_INT_MODE_LOCK:    types.IntModeLock,
+	distlockpb.IntMode_INT_MODE_SESSION: types.IntModeSession,
+}
+
+var grpcValueKinds = map[distlockpb.ValueKind]types.ValueKind{
+	distlockpb.ValueKind_VALUE_KIND_STRING: types.ValueKindString,
+	distlockpb.ValueKind_VALUE_KIND_INT:    types.ValueKindInt,
+	distlockpb.ValueKind_VALUE_KIND_JSON:   types.ValueKindJSON,
+	distlockpb.ValueKind_VALUE_KIND_BYTES:  types.ValueKindBytes,
+}
+
+// newGRPCServer returns a gRPC server for the state of s, serving TLS if
+// tlsConfig is not nil.
+func newGRPCServer(s *server, tlsConfig *tls.Config) *grpc.Server {
+	options := []grpc.ServerOption{}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	ret := grpc.NewServer(options...)
+	distlockpb.RegisterDistlockServer(ret, &grpcServer{
+		handler:      s.handler,
+		namespaces:   s.namespaces,
+		audit:        s.audit,
+		shuttingDown: s.shuttingDown,
+	})
+	return ret
+}
+
+// serveGRPC serves server on listener until shuttingDown is closed, then
+// waits up to timeout for running calls. The returned channel is closed
+// once the server has stopped.
+func serveGRPC(server *grpc.Server, listener net.Listener, shuttingDown <-chan struct{}, timeout time.Duration, log *logger) <-chan struct{} {
+	stopped := make(chan struct{})
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.error("grpc listener failed", "error", err)
+		}
+	}()
+
+	go func() {
+		defer close(stopped)
+
+		<-shuttingDown
+
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			log.warn("grpc calls still running after shutdown timeout")
+			server.Stop()
+		}
+	}()
+
+	return stopped
+}
+
+// grpcCode maps the status of an HTTP response to a gRPC code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// call serves the legacy request l for the call of ctx. body is sent as
+// request body if not nil and the JSON response is decoded into ret if it
+// is not nil. Failed requests are returned as gRPC status errors.
+func (g *grpcServer) call(ctx context.Context, l legacyRequest, body []byte, ret interface{}) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, l.method, l.url(l.query).RequestURI(), reader)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, name := range []string{"Authorization", HeaderNamespace, trace.TraceparentHeader} {
+			if values := md.Get(name); len(values) > 0 {
+				req.Header.Set(name, values[0])
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := info.State
+			req.TLS = &state
+		}
+	}
+
+	rec := newResponseBuffer()
+	g.handler.ServeHTTP(rec, req)
+	rec.WriteHeader(http.StatusOK)
+
+	if rec.status != http.StatusOK {
+		return status.Error(grpcCode(rec.status), strings.TrimSpace(rec.body.String()))
+	}
+	if ret == nil {
+		return nil
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), ret); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// namespace returns the namespace the call selected.
+func (g *grpcServer) namespace(ctx context.Context) (*namespace, error) {
+	name := defaultNamespace
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(HeaderNamespace); len(values) > 0 && values[0] != "" {
+			name = values[0]
+		}
+	}
+
+	ns, ok := g.namespaces.get(name)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "namespace does not exist")
+	}
+	return ns, nil
+}
+
+// grpcValue returns the kind and raw data of value, as sent in request
+// bodies.
+func grpcValue(value *distlockpb.Value) (types.ValueKind, []byte) {
+	if value == nil {
+		return types.ValueKindString, []byte{}
+	}
+	kind, ok := grpcValueKinds[value.Kind]
+	if !ok {
+		kind = types.ValueKindString
+	}
+	return kind, value.Data
+}
+
+// protoValue converts a value of a JSON response.
+func protoValue(kind string, value string) *distlockpb.Value {
+	ret := &distlockpb.Value{Data: []byte(value)}
+	for protoKind, k := range grpcValueKinds {
+		if string(k) == kind {
+			ret.Kind = protoKind
+		}
+	}
+	if types.ValueKind(kind) == types.ValueKindBytes {
+		ret.Data, _ = base64.StdEncoding.DecodeString(value)
+	}
+	return ret
+}
+
+func protoTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// grpcDuration formats a required duration for a legacy route.
+func grpcDuration(name string, d *durationpb.Duration) (string, error) {
+	if d == nil {
+		return "", status.Error(codes.InvalidArgument, name+" is required")
+	}
+	return d.AsDuration().String(), nil
+}
+
+func (g *grpcServer) Get(ctx context.Context, req *distlockpb.GetRequest) (*distlockpb.GetResponse, error) {
+	ret := types.GetReturn{}
+	l := legacyRequest{method: http.MethodGet, path: []string{"kv", "get", req.Key}}
+	if req.Path != "" {
+		l.query = url.Values{"path": {req.Path}}
+	}
+	if err := g.call(ctx, l, nil, &ret); err != nil {
+		return nil, err
+	}
+
+	resp := &distlockpb.GetResponse{Success: ret.Success, Key: req.Key, Locked: ret.Locked}
+	if ret.Success {
+		resp.Value = protoValue(ret.Kind, ret.Value)
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) Set(ctx context.Context, req *distlockpb.SetRequest) (*distlockpb.SuccessResponse, error) {
+	kind, data := grpcValue(req.Value)
+	query := url.Values{"kind": {string(kind)}, "sessionId": {req.SessionId}}
+
+	ret := types.SetReturn{}
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"kv", "set", req.Key}, query: query}, data, &ret); err != nil {
+		return nil, err
+	}
+	return &distlockpb.SuccessResponse{Success: ret.Success}, nil
+}
+
+func (g *grpcServer) Delete(ctx context.Context, req *distlockpb.DeleteRequest) (*distlockpb.SuccessResponse, error) {
+	query := url.Values{"sessionId": {req.SessionId}}
+
+	ret := types.DeleteReturn{}
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"kv", "delete", req.Key}, query: query}, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &distlockpb.SuccessResponse{Success: ret.Success}, nil
+}
+
+func (g *grpcServer) ListKeys(ctx context.Context, req *distlockpb.ListKeysRequest) (*distlockpb.ListKeysResponse, error) {
+	query := url.Values{"prefix": {req.Prefix}}
+
+	keys := []string{}
+	if err := g.call(ctx, legacyRequest{method: http.MethodGet, path: []string{"kv", "keys"}, query: query}, nil, &keys); err != nil {
+		return nil, err
+	}
+	return &distlockpb.ListKeysResponse{Keys: keys}, nil
+}
+
+// Watch sends the state of the key, then again whenever the audit log
+// records a change of it. Changes that leave the state as it was sent are
+// skipped.
+func (g *grpcServer) Watch(req *distlockpb.WatchRequest, stream distlockpb.Distlock_WatchServer) error {
+	ctx := stream.Context()
+
+	ns, err := g.namespace(ctx)
+	if err != nil {
+		return err
+	}
+
+	changed, stop := g.audit.watch(ns.Name, req.Key)
+	defer stop()
+
+	var last *distlockpb.WatchEvent
+
+	for {
+		ret := types.GetReturn{}
+		if err := g.call(ctx, legacyRequest{method: http.MethodGet, path: []string{"kv", "get", req.Key}}, nil, &ret); err != nil {
+			return err
+		}
+
+		event := &distlockpb.WatchEvent{Key: req.Key, Exists: ret.Success, Locked: ret.Locked}
+		if ret.Success {
+			event.Value = protoValue(ret.Kind, ret.Value)
+		}
+
+		if last == nil || event.Exists != last.Exists || event.Locked != last.Locked ||
+			event.Exists && (event.Value.Kind != last.Value.Kind || !bytes.Equal(event.Value.Data, last.Value.Data)) {
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			last = event
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ns.Deleted:
+			return status.Error(codes.NotFound, "namespace deleted")
+		case <-g.shuttingDown:
+			return status.Error(codes.Unavailable, "server shutting down")
+		}
+	}
+}
+
+func (g *grpcServer) Acquire(ctx context.Context, req *distlockpb.AcquireRequest) (*distlockpb.AcquireResponse, error) {
+	ttl, err := grpcDuration("ttl", req.Ttl)
+	if err != nil {
+		return nil, err
+	}
+	kind, data := grpcValue(req.Value)
+
+	if req.Wait {
+		// only acquireall waits for locks, with a single key it is an
+		// acquire
+		body := types.AcquireAllRequest{
+			Keys:  []string{req.Key},
+			Value: string(data),
+			Kind:  string(kind),
+			Wait:  true,
+		}
+		if kind == types.ValueKindBytes {
+			body.Value = base64.StdEncoding.EncodeToString(data)
+		}
+		if req.Timeout != nil {
+			body.Timeout = req.Timeout.AsDuration().String()
+		}
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		ret := types.AcquireAllReturn{}
+		if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"kv", "acquireall", ttl}}, encoded, &ret); err != nil {
+			return nil, err
+		}
+		resp := &distlockpb.AcquireResponse{Success: ret.Success}
+		if ret.Success {
+			resp.SessionId = ret.SessionID
+			resp.ExpiresAt = protoTime(ret.ExpiresAt)
+		}
+		return resp, nil
+	}
+
+	ret := types.AcquireReturn{}
+	query := url.Values{"kind": {string(kind)}}
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"kv", "acquire", req.Key, ttl}, query: query}, data, &ret); err != nil {
+		return nil, err
+	}
+	resp := &distlockpb.AcquireResponse{Success: ret.Success}
+	if ret.Success {
+		resp.SessionId = ret.SessionID
+		resp.ExpiresAt = protoTime(ret.ExpiresAt)
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) Release(ctx context.Context, req *distlockpb.ReleaseRequest) (*distlockpb.SuccessResponse, error) {
+	ret := types.ReleaseReturn{}
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"kv", "release", req.Key, req.SessionId}}, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &distlockpb.SuccessResponse{Success: ret.Success}, nil
+}
+
+func (g *grpcServer) renew(ctx context.Context, sessionID string, d *durationpb.Duration) (types.RenewReturn, error) {
+	ret := types.RenewReturn{}
+
+	ttl, err := grpcDuration("ttl", d)
+	if err != nil {
+		return ret, err
+	}
+	err = g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"session", "renew", sessionID, ttl}}, nil, &ret)
+	return ret, err
+}
+
+func (g *grpcServer) Renew(ctx context.Context, req *distlockpb.RenewRequest) (*distlockpb.RenewResponse, error) {
+	ret, err := g.renew(ctx, req.SessionId, req.Ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &distlockpb.RenewResponse{Success: ret.Success, ExpiresAt: protoTime(ret.ExpiresAt), Keys: ret.Keys}, nil
+}
+
+func (g *grpcServer) DestroySession(ctx context.Context, req *distlockpb.DestroySessionRequest) (*distlockpb.SuccessResponse, error) {
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"session", "destroy", req.SessionId}}, nil, nil); err != nil {
+		return nil, err
+	}
+	return &distlockpb.SuccessResponse{Success: true}, nil
+}
+
+// KeepAlive answers every renewal sent on the stream and ends the stream
+// once a session is gone. It does not touch the session when the client
+// closes the stream.
+func (g *grpcServer) KeepAlive(stream distlockpb.Distlock_KeepAliveServer) error {
+	ctx := stream.Context()
+
+	requests := make(chan *distlockpb.KeepAliveRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case req := <-requests:
+			ret, err := g.renew(ctx, req.SessionId, req.Ttl)
+			if err != nil {
+				return err
+			}
+			err = stream.Send(&distlockpb.KeepAliveResponse{Success: ret.Success, ExpiresAt: protoTime(ret.ExpiresAt), Keys: ret.Keys})
+			if err != nil || !ret.Success {
+				return err
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-g.shuttingDown:
+			return status.Error(codes.Unavailable, "server shutting down")
+		}
+	}
+}
+
+func (g *grpcServer) Lock(ctx context.Context, req *distlockpb.LockRequest) (*distlockpb.SuccessResponse, error) {
+	l := legacyRequest{method: http.MethodPost, path: []string{"mutex", "lock", req.Key}}
+	if req.Timeout != nil {
+		l.query = url.Values{"timeout": {req.Timeout.AsDuration().String()}}
+	}
+
+	ret := types.MutexReturn{}
+	if err := g.call(ctx, l, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &distlockpb.SuccessResponse{Success: ret.Success}, nil
+}
+
+func (g *grpcServer) Unlock(ctx context.Context, req *distlockpb.UnlockRequest) (*distlockpb.SuccessResponse, error) {
+	ret := types.MutexReturn{}
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"mutex", "unlock", req.Key}}, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &distlockpb.SuccessResponse{Success: ret.Success}, nil
+}
+
+func (g *grpcServer) Int(ctx context.Context, req *distlockpb.IntRequest) (*distlockpb.IntResponse, error) {
+	op, ok := grpcIntOps[req.Op]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "op is required")
+	}
+
+	query := url.Values{"op": {string(op)}, "sessionId": {req.SessionId}}
+	if mode, ok := grpcIntModes[req.Mode]; ok {
+		query.Set("mode", string(mode))
+	}
+	if req.Ttl != nil {
+		query.Set("ttl", req.Ttl.AsDuration().String())
+	}
+	for name, value := range map[string]*int64{"value": req.Value, "delta": req.Delta, "expected": req.Expected, "min": req.Min, "max": req.Max} {
+		if value != nil {
+			query.Set(name, strconv.FormatInt(*value, 10))
+		}
+	}
+
+	ret := types.IntReturn{}
+	if err := g.call(ctx, legacyRequest{method: http.MethodPost, path: []string{"int", req.Key}, query: query}, nil, &ret); err != nil {
+		return nil, err
+	}
+
+	resp := &distlockpb.IntResponse{Success: ret.Success, Value: ret.Value, Previous: ret.Previous, Op: req.Op}
+	for protoMode, mode := range grpcIntModes {
+		if string(mode) == ret.Mode {
+			resp.Mode = protoMode
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCTestServer serves the same state over HTTP and gRPC. It returns
+// the HTTP server and the address of the gRPC listener.
+func newGRPCTestServer(t *testing.T, config Config) (*httptest.Server, string) {
+	t.Helper()
+
+	config.LogLevel = "error"
+	s := newServer(config)
+
+	ts := httptest.NewServer(s.handler)
+	t.Cleanup(ts.Close)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newGRPCServer(s, nil)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return ts, listener.Addr().String()
+}
+
+func grpcClient(t *testing.T, ts *httptest.Server, addr string, options ...api.ClientOption) *api.Client {
+	t.Helper()
+
+	options = append(options, api.WithGRPC(addr, grpc.WithTransportCredentials(insecure.NewCredentials())))
+	client, err := api.NewClient(ts.URL, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGRPCSharesState(t *testing.T) {
+	ts, addr := newGRPCTestServer(t, DefaultConfig())
+	client := grpcClient(t, ts, addr)
+
+	success, sessionID, err := client.Acquire("k", "v1", 10*time.Second)
+	if err != nil || !success {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, "GET", "/kv/get/k", "", &get)
+	if !get.Success || get.Value != "v1" || !get.Locked {
+		t.Fatalf("HTTP does not see the lock taken over gRPC: %+v", get)
+	}
+
+	if ok, _ := client.Set("k", "v2", "other"); ok {
+		t.Fatal("set with another session succeeded")
+	}
+	if ok, err := client.Set("k", "v2", sessionID); err != nil || !ok {
+		t.Fatalf("set by the holder failed: %v", err)
+	}
+
+	ret, err := client.Get("k")
+	if err != nil || !ret.Success || ret.Value != "v2" || !ret.Locked {
+		t.Fatalf("get over gRPC: %+v %v", ret, err)
+	}
+
+	keys, err := client.Keys("")
+	if err != nil || len(keys) != 1 || keys[0] != "k" {
+		t.Fatalf("keys over gRPC: %v %v", keys, err)
+	}
+
+	if ok, err := client.Release("k", sessionID); err != nil || !ok {
+		t.Fatalf("release failed: %v", err)
+	}
+
+	counter, err := client.IntInc("c", "")
+	if err != nil || !counter.Success || counter.Value != 1 {
+		t.Fatalf("int inc over gRPC: %+v %v", counter, err)
+	}
+	min, max := int64(0), int64(1)
+	if ret, err := client.IntSetBounds("c", &min, &max, ""); err != nil || !ret.Success {
+		t.Fatalf("int bounds over gRPC: %+v %v", ret, err)
+	}
+	if ret, _ := client.IntInc("c", ""); ret.Success {
+		t.Fatal("increment beyond the bound succeeded")
+	}
+
+	timeout := time.Second
+	if ok, err := client.LockMutex("m", &timeout); err != nil || !ok {
+		t.Fatalf("mutex lock failed: %v", err)
+	}
+	if ok, err := client.UnlockMutex("m"); err != nil || !ok {
+		t.Fatalf("mutex unlock failed: %v", err)
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	ts, addr := newGRPCTestServer(t, DefaultConfig())
+	client := grpcClient(t, ts, addr)
+
+	done := make(chan struct{})
+	events, errs, err := client.Watch("k", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() *types.GetReturn {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("no watch event")
+		}
+		return nil
+	}
+
+	if event := next(); event.Success {
+		t.Fatalf("missing key was reported as existing: %+v", event)
+	}
+
+	call(t, ts, "POST", "/kv/set/k?value=v1", "", nil)
+	if event := next(); !event.Success || event.Value != "v1" || event.Locked {
+		t.Fatalf("set was not watched: %+v", event)
+	}
+
+	sessionID := acquire(t, ts, "k")
+	if event := next(); !event.Success || !event.Locked {
+		t.Fatalf("acquire was not watched: %+v", event)
+	}
+
+	call(t, ts, "POST", "/kv/delete/k?sessionId="+sessionID, "", nil)
+	if event := next(); event.Success {
+		t.Fatalf("delete was not watched: %+v", event)
+	}
+
+	close(done)
+	if err := <-errs; err != nil {
+		t.Fatalf("closing the watch failed: %v", err)
+	}
+}
+
+func TestGRPCKeepAlive(t *testing.T) {
+	ts, addr := newGRPCTestServer(t, DefaultConfig())
+	client := grpcClient(t, ts, addr)
+
+	success, sessionID, err := client.Acquire("k", "", 300*time.Millisecond)
+	if err != nil || !success {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	// the session outlives its TTL while kept alive
+	result := make(chan error, 1)
+	go func() { result <- client.KeepLock("k", sessionID, 300*time.Millisecond, nil) }()
+
+	time.Sleep(600 * time.Millisecond)
+	get := types.GetReturn{}
+	call(t, ts, "GET", "/kv/get/k", "", &get)
+	if !get.Locked {
+		t.Fatal("session kept alive over gRPC expired")
+	}
+
+	call(t, ts, "POST", "/session/destroy/"+sessionID, "", nil)
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, api.ErrSessionNotFound) {
+			t.Fatalf("got %v, want ErrSessionNotFound", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("keep alive did not end with the session")
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	acl := `{"tokens":[{"token":"t1","name":"alice","policies":[{"primitive":"kv","prefix":"a-","rights":["read","write","lock"]}]}]}`
+	if err := os.WriteFile(authFile, []byte(acl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.AuthFile = authFile
+	ts, addr := newGRPCTestServer(t, config)
+
+	if _, err := grpcClient(t, ts, addr).Get("a-1"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("call without a token got %v", err)
+	}
+
+	client := grpcClient(t, ts, addr, api.WithToken("t1"))
+	if ok, err := client.Set("a-1", "v", ""); err != nil || !ok {
+		t.Fatalf("set with a token failed: %v", err)
+	}
+	if _, err := client.Get("b-1"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("get outside the token's prefix got %v", err)
+	}
+
+	if _, err := grpcClient(t, ts, addr, api.WithToken("t1"), api.WithNamespace("missing")).Get("a-1"); status.Code(err) == codes.OK {
+		t.Fatal("call to a missing namespace succeeded")
+	}
+
+	ret := types.GetReturn{}
+	if code := callAs(t, ts, "t1", "GET", "/kv/get/a-1", "", &ret); code != http.StatusOK || ret.Value != "v" {
+		t.Fatalf("value set over gRPC is not visible over HTTP: %d %+v", code, ret)
+	}
+}
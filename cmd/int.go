@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+var errIntOverflow = errors.New("integer overflow")
+
+// parseIntParam returns nil if the query parameter is absent.
+func parseIntParam(query url.Values, name string) (*int64, error) {
+	str := query.Get(name)
+	if str == "" {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func addInt(a int64, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, errIntOverflow
+	}
+	return a + b, nil
+}
+
+func (v *lockableValue) inBounds(value int64) bool {
+	return inLimits(value, v.Min, v.Max)
+}
+
+// inLimits reports whether value lies within min and max, nil limits are
+// open.
+func inLimits(value int64, min *int64, max *int64) bool {
+	if min != nil && value < *min {
+		return false
+	}
+	if max != nil && value > *max {
+		return false
+	}
+	return true
+}
+
+// canMutate reports whether the holder of sessionID may change the value.
+func (v *lockableValue) canMutate(sessionID string) bool {
+	switch v.Mode {
+	case types.IntModePublic:
+		return true
+	case types.IntModeLock:
+		return v.IsLocked && v.SessionID != nil && *v.SessionID == sessionID
+	case types.IntModeSession:
+		return v.SessionID != nil && *v.SessionID == sessionID
+	}
+
+	// plain values are guarded by their lock while it is held
+	return !v.IsLocked || (v.SessionID != nil && *v.SessionID == sessionID)
+}
+
+// lockable reports whether the value can be acquired through /kv/acquire.
+// Public and session owned counters are never locked.
+func (v *lockableValue) lockable() bool {
+	return v.Mode == "" || v.Mode == types.IntModeLock
+}
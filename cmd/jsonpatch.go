@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+var errPathNotFound = errors.New("path not found")
+
+func unmarshalJSON(data []byte) (interface{}, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// parseJSONPath splits a path like $.a.b[0]['c.d'] into its segments. Only
+// plain member and index selectors are supported.
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path must start with $: %s", path)
+	}
+
+	segments := []string{}
+	rest := path[1:]
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty member in json path: %s", path)
+			}
+			segments = append(segments, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated [ in json path: %s", path)
+			}
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				selector = selector[1 : len(selector)-1]
+			} else if _, err := strconv.Atoi(selector); err != nil {
+				return nil, fmt.Errorf("invalid selector in json path: %s", path)
+			}
+			segments = append(segments, selector)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid json path: %s", path)
+		}
+	}
+
+	return segments, nil
+}
+
+func selectJSONPath(doc interface{}, segments []string) (interface{}, error) {
+	current := doc
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			child, ok := node[segment]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			current = child
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, errPathNotFound
+			}
+			current = node[idx]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return current, nil
+}
+
+// mergePatch applies patch to target as described in RFC 7386.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
+
+// parseJSONPointer splits a RFC 6901 pointer into unescaped tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("json pointer must start with /: %s", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[idx] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	// RFC 6901 indices are plain digits without leading zeros
+	idx, err := strconv.Atoi(token)
+	if err != nil || strings.TrimLeft(token, "0123456789") != "" || idx > length || (!allowEnd && idx == length) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index: %s", token)
+	}
+	return idx, nil
+}
+
+// updateJSONPointer replaces the parent of the location the pointer refers
+// to with the result of fn, which receives the parent container and the
+// last token.
+func updateJSONPointer(doc interface{}, tokens []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, errPathNotFound
+		}
+		updated, err := updateJSONPointer(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = updated
+		return node, nil
+	case []interface{}:
+		idx, err := arrayIndex(tokens[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateJSONPointer(node[idx], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = updated
+		return node, nil
+	}
+
+	return nil, errPathNotFound
+}
+
+func jsonPointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			current = child
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[idx]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return current, nil
+}
+
+func jsonPointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return updateJSONPointer(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		}
+		return nil, errPathNotFound
+	})
+}
+
+func jsonPointerRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return updateJSONPointer(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, errPathNotFound
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:idx], node[idx+1:]...), nil
+		}
+		return nil, errPathNotFound
+	})
+}
+
+// deepCopyJSON copies a decoded document so that copy operations do not
+// alias parts of it.
+func deepCopyJSON(doc interface{}) interface{} {
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			ret[k] = deepCopyJSON(v)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(node))
+		for i, v := range node {
+			ret[i] = deepCopyJSON(v)
+		}
+		return ret
+	}
+	return doc
+}
+
+// applyJSONPatch applies ops to doc as described in RFC 6902. doc is
+// modified in place, callers must pass a copy if the patch may fail.
+func applyJSONPatch(doc interface{}, ops []types.JSONPatchOp) (interface{}, error) {
+	for idx, op := range ops {
+		path, err := parseJSONPointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", idx, err)
+		}
+
+		var value interface{}
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return nil, fmt.Errorf("op %d: value is required", idx)
+			}
+			value, err = unmarshalJSON(op.Value)
+			if err != nil {
+				return nil, fmt.Errorf("op %d: %w", idx, err)
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = jsonPointerAdd(doc, path, value)
+		case "remove":
+			doc, err = jsonPointerRemove(doc, path)
+		case "replace":
+			if _, err = jsonPointerGet(doc, path); err == nil {
+				if len(path) == 0 {
+					doc = value
+				} else {
+					doc, err = jsonPointerRemove(doc, path)
+					if err == nil {
+						doc, err = jsonPointerAdd(doc, path, value)
+					}
+				}
+			}
+		case "move", "copy":
+			var from []string
+			from, err = parseJSONPointer(op.From)
+			if err != nil {
+				break
+			}
+			var moved interface{}
+			moved, err = jsonPointerGet(doc, from)
+			if err != nil {
+				break
+			}
+			if op.Op == "move" {
+				if op.Path != op.From && strings.HasPrefix(op.Path+"/", op.From+"/") {
+					err = errors.New("cannot move a value into itself")
+					break
+				}
+				doc, err = jsonPointerRemove(doc, from)
+			} else {
+				moved = deepCopyJSON(moved)
+			}
+			if err == nil {
+				doc, err = jsonPointerAdd(doc, path, moved)
+			}
+		case "test":
+			var current interface{}
+			current, err = jsonPointerGet(doc, path)
+			if err == nil && !jsonEqual(current, value) {
+				err = errors.New("test failed")
+			}
+		default:
+			err = fmt.Errorf("unknown op: %s", op.Op)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", idx, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// jsonEqual compares two decoded documents, treating numbers by value.
+func jsonEqual(a interface{}, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		if aerr == nil && berr == nil {
+			return af == bf
+		}
+		return an == bn
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, ok := bv[k]
+			if !ok || !jsonEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
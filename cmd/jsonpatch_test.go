@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func mustUnmarshalJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+
+	doc, err := unmarshalJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("%s: %v", data, err)
+	}
+	return doc
+}
+
+func TestParseJSONPath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"$", []string{}},
+		{"$.a", []string{"a"}},
+		{"$.a.b", []string{"a", "b"}},
+		{"$.a[0]", []string{"a", "0"}},
+		{"$['c.d']", []string{"c.d"}},
+		{`$["c.d"].e`, []string{"c.d", "e"}},
+		{"$.a[0][1]['x']", []string{"a", "0", "1", "x"}},
+	} {
+		got, err := parseJSONPath(tc.path)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q %v, want %q", tc.path, got, err, tc.want)
+		}
+	}
+
+	for _, path := range []string{"", "a.b", "$.", "$..a", "$[0", "$[x]", "$['a]", "$a"} {
+		if got, err := parseJSONPath(path); err == nil {
+			t.Errorf("%s: got %q, want an error", path, got)
+		}
+	}
+}
+
+// TestMergePatch runs the examples of RFC 7386, appendix A.
+func TestMergePatch(t *testing.T) {
+	for _, tc := range []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		got := mergePatch(mustUnmarshalJSON(t, tc.target), mustUnmarshalJSON(t, tc.patch))
+		if !jsonEqual(got, mustUnmarshalJSON(t, tc.want)) {
+			data, _ := json.Marshal(got)
+			t.Errorf("%s patched with %s: got %s, want %s", tc.target, tc.patch, data, tc.want)
+		}
+	}
+}
+
+// TestApplyJSONPatch runs the examples of RFC 6902, appendix A, and the
+// edge cases of array indices and pointer escaping.
+func TestApplyJSONPatch(t *testing.T) {
+	for _, tc := range []struct {
+		name, doc, patch, want string
+	}{
+		{"A.1 add object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"A.2 add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"A.3 remove object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"A.4 remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"A.5 replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"A.6 move value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"A.7 move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"A.8 test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"A.10 add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{"A.11 ignore unknown members", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`},
+		{"A.14 escape ordering", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{"A.16 add array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escaped tilde", `{"m~n":1}`, `[{"op":"remove","path":"/m~0n"}]`, `{}`},
+		{"append with -", `[1,2]`, `[{"op":"add","path":"/-","value":3}]`, `[1,2,3]`},
+		{"add at end index", `[1,2]`, `[{"op":"add","path":"/2","value":3}]`, `[1,2,3]`},
+		{"replace whole document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"copy is not aliased", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"move onto itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`},
+		{"move to a sibling with a common prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`},
+		{"test numbers by value", `{"n":1.0}`, `[{"op":"test","path":"/n","value":1}]`, `{"n":1.0}`},
+	} {
+		ops := []types.JSONPatchOp{}
+		if err := json.Unmarshal([]byte(tc.patch), &ops); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		got, err := applyJSONPatch(mustUnmarshalJSON(t, tc.doc), ops)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !jsonEqual(got, mustUnmarshalJSON(t, tc.want)) {
+			data, _ := json.Marshal(got)
+			t.Errorf("%s: got %s, want %s", tc.name, data, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, doc, patch string
+	}{
+		{"A.9 test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{"A.12 add to missing target", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{"A.15 test with escaped string", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`},
+		{"index past the end", `[1,2]`, `[{"op":"add","path":"/3","value":3}]`},
+		{"leading zero index", `[1,2]`, `[{"op":"replace","path":"/01","value":3}]`},
+		{"negative index", `[1,2]`, `[{"op":"remove","path":"/-1"}]`},
+		{"signed index", `[1,2]`, `[{"op":"remove","path":"/+1"}]`},
+		{"negative zero index", `[1,2]`, `[{"op":"remove","path":"/-0"}]`},
+		{"- outside add", `[1,2]`, `[{"op":"remove","path":"/-"}]`},
+		{"move into a descendant", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`},
+		{"pointer without slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`},
+		{"missing value", `{"a":1}`, `[{"op":"add","path":"/b"}]`},
+		{"unknown op", `{"a":1}`, `[{"op":"frobnicate","path":"/a"}]`},
+	} {
+		ops := []types.JSONPatchOp{}
+		if err := json.Unmarshal([]byte(tc.patch), &ops); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if got, err := applyJSONPatch(mustUnmarshalJSON(t, tc.doc), ops); err == nil {
+			data, _ := json.Marshal(got)
+			t.Errorf("%s: got %s, want an error", tc.name, data)
+		}
+	}
+}
+
+func TestFailedJSONPatchKeepsValue(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	set := types.SetReturn{}
+	call(t, ts, http.MethodPost, "/kv/set/doc?kind=json&value="+url.QueryEscape(`{"a":1,"b":[1,2]}`), "", &set)
+	if !set.Success {
+		t.Fatal("set failed")
+	}
+
+	// the first op applies, the failing test must undo it
+	patch := `[{"op":"remove","path":"/b/0"},{"op":"test","path":"/a","value":2}]`
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/kv/patch/doc", strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentTypeJSONPatch)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("failing patch got %d", resp.StatusCode)
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/doc", "", &get)
+	if !jsonEqual(mustUnmarshalJSON(t, get.Value), mustUnmarshalJSON(t, `{"a":1,"b":[1,2]}`)) {
+		t.Fatalf("failed patch changed the value to %s", get.Value)
+	}
+}
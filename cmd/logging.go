@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+func parseLogLevel(name string) (logLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
+const (
+	logFormatJSON   = "json"
+	logFormatLogfmt = "logfmt"
+)
+
+// logger writes structured log lines in the JSON or logfmt format. Fields
+// are given as alternating keys and values.
+type logger struct {
+	lock   sync.Mutex
+	out    io.Writer
+	format string
+	level  logLevel
+}
+
+func newLogger(out io.Writer, format string, level string) (*logger, error) {
+	if format == "" {
+		format = logFormatLogfmt
+	}
+	if format != logFormatJSON && format != logFormatLogfmt {
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+
+	ret := &logger{
+		out:    out,
+		format: format,
+		level:  levelInfo,
+	}
+
+	if level != "" {
+		var err error
+		ret.level, err = parseLogLevel(level)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (l *logger) debug(msg string, fields ...interface{}) {
+	l.log(levelDebug, msg, fields...)
+}
+
+func (l *logger) info(msg string, fields ...interface{}) {
+	l.log(levelInfo, msg, fields...)
+}
+
+func (l *logger) warn(msg string, fields ...interface{}) {
+	l.log(levelWarn, msg, fields...)
+}
+
+func (l *logger) error(msg string, fields ...interface{}) {
+	l.log(levelError, msg, fields...)
+}
+
+func (l *logger) log(level logLevel, msg string, fields ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	fields = append([]interface{}{
+		"time", time.Now().UTC().Format(time.RFC3339Nano),
+		"level", logLevelNames[level],
+		"msg", msg,
+	}, fields...)
+
+	var line strings.Builder
+	if l.format == logFormatJSON {
+		line.WriteByte('{')
+	}
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		value := fields[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		if l.format == logFormatJSON {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				encoded, _ = json.Marshal(fmt.Sprint(value))
+			}
+			line.WriteString(strconv.Quote(key))
+			line.WriteByte(':')
+			line.Write(encoded)
+		} else {
+			if i > 0 {
+				line.WriteByte(' ')
+			}
+			line.WriteString(key)
+			line.WriteByte('=')
+			line.WriteString(logfmtValue(value))
+		}
+	}
+
+	if l.format == logFormatJSON {
+		line.WriteByte('}')
+	}
+	line.WriteByte('\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	io.WriteString(l.out, line.String())
+}
+
+func logfmtValue(value interface{}) string {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	default:
+		str = fmt.Sprint(v)
+	}
+
+	if str == "" || strings.ContainsAny(str, " =\"\t\n") {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+type logFieldsContextKey struct{}
+
+// logFields adds fields to the access log line of the request.
+func logFields(r *http.Request, fields ...interface{}) {
+	if entry, ok := r.Context().Value(logFieldsContextKey{}).(*[]interface{}); ok {
+		*entry = append(*entry, fields...)
+	}
+}
+
+// accessLog logs every request after it has been handled, together with
+// its request id and the key and session it operated on.
+func (l *logger) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		requestID := middleware.GetReqID(r.Context())
+		w.Header().Set(middleware.RequestIDHeader, requestID)
+
+		fields := []interface{}{}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), logFieldsContextKey{}, &fields)))
+
+		entry := []interface{}{
+			"request_id", requestID,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"remote", r.RemoteAddr,
+		}
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if route := routePattern(r); route != "" {
+				entry = append(entry, "route", route)
+			}
+			for _, param := range []string{"key", "queue"} {
+				if value := rctx.URLParam(param); value != "" {
+					entry = append(entry, param, value)
+				}
+			}
+		}
+
+		sessionID := r.URL.Query().Get("sessionId")
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.URLParam("sessionId") != "" {
+			sessionID = rctx.URLParam("sessionId")
+		}
+		if sessionID != "" {
+			entry = append(entry, "session", sessionID)
+		}
+
+		l.info("request", append(entry, fields...)...)
+	})
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+	"github.com/go-chi/chi/middleware"
+)
+
+// logBuffer collects log lines written while requests are served.
+type logBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// lines decodes the JSON log lines written so far.
+func (b *logBuffer) lines(t *testing.T) []map[string]interface{} {
+	t.Helper()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ret := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+// newLoggingTestServer logs JSON at the info level into the returned
+// buffer.
+func newLoggingTestServer(t *testing.T, config Config) (*httptest.Server, *logBuffer) {
+	t.Helper()
+
+	config.LogFormat = logFormatJSON
+	config.LogLevel = "info"
+	s := newServer(config)
+
+	out := &logBuffer{}
+	s.log.out = out
+
+	ts := httptest.NewServer(s.handler)
+	t.Cleanup(ts.Close)
+	return ts, out
+}
+
+func TestLoggerFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format, want string
+	}{
+		{logFormatLogfmt, `level=warn msg="lock lost" key=k holds=2 err="session not found" empty=""`},
+		{logFormatJSON, `"level":"warn","msg":"lock lost","key":"k","holds":2,"err":"session not found","empty":""}`},
+	} {
+		buf := bytes.Buffer{}
+		log, err := newLogger(&buf, tc.format, "warn")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		log.info("hidden")
+		log.warn("lock lost", "key", "k", "holds", 2, "err", errors.New("session not found"), "empty", "")
+
+		line := buf.String()
+		if strings.Contains(line, "hidden") || strings.Count(line, "\n") != 1 {
+			t.Fatalf("%s: below the level was logged:\n%s", tc.format, line)
+		}
+		if !strings.HasSuffix(line, tc.want+"\n") {
+			t.Errorf("%s: got %s want suffix %s", tc.format, line, tc.want)
+		}
+	}
+
+	// the default format is logfmt and the default level info
+	buf := bytes.Buffer{}
+	log, err := newLogger(&buf, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.debug("hidden")
+	log.info("shown")
+	if !strings.HasPrefix(buf.String(), "time=") || !strings.Contains(buf.String(), "msg=shown\n") || strings.Contains(buf.String(), "hidden") {
+		t.Fatalf("defaults logged %s", buf.String())
+	}
+
+	if _, err := newLogger(&buf, "xml", ""); err == nil {
+		t.Error("unknown format was accepted")
+	}
+	if _, err := newLogger(&buf, "", "loud"); err == nil {
+		t.Error("unknown level was accepted")
+	}
+	if level, err := parseLogLevel("ERROR"); err != nil || level != levelError {
+		t.Errorf("level names are not case insensitive: %v", err)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthFile = writeACL(t, testACL)
+	ts, out := newLoggingTestServer(t, config)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/kv/acquire/a-1/10s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer t-alice")
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := types.AcquireReturn{}
+	json.NewDecoder(resp.Body).Decode(&acquired)
+	resp.Body.Close()
+
+	if resp.Header.Get(middleware.RequestIDHeader) != "req-1" {
+		t.Fatalf("request id not echoed: %q", resp.Header.Get(middleware.RequestIDHeader))
+	}
+
+	// requests without an id get one
+	resp, err = ts.Client().Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	generated := resp.Header.Get(middleware.RequestIDHeader)
+	if generated == "" {
+		t.Fatal("no request id generated")
+	}
+
+	callAs(t, ts, "t-alice", http.MethodPost, "/kv/release/a-1/"+acquired.SessionID, "", nil)
+	callAs(t, ts, "t-bob", http.MethodPost, "/kv/set/a-1?value=v", "", nil)
+
+	lines := out.lines(t)
+	if len(lines) != 4 {
+		t.Fatalf("got %d log lines, want 4: %v", len(lines), lines)
+	}
+
+	for key, want := range map[string]interface{}{
+		"level":      "info",
+		"msg":        "request",
+		"request_id": "req-1",
+		"method":     http.MethodPost,
+		"path":       "/kv/acquire/a-1/10s",
+		"route":      "/kv/acquire/{key}/{duration}",
+		"status":     float64(http.StatusOK),
+		"key":        "a-1",
+		"session":    acquired.SessionID,
+		"identity":   "alice",
+		"namespace":  defaultNamespace,
+	} {
+		if lines[0][key] != want {
+			t.Errorf("%s: got %v, want %v", key, lines[0][key], want)
+		}
+	}
+	if _, ok := lines[0]["duration_ms"].(float64); !ok || lines[0]["remote"] == "" {
+		t.Errorf("access log misses the duration or the remote address: %v", lines[0])
+	}
+
+	if lines[1]["request_id"] != generated || lines[1]["path"] != "/healthz" {
+		t.Errorf("probe was logged as %v", lines[1])
+	}
+	if lines[2]["session"] != acquired.SessionID {
+		t.Errorf("session of the path was not logged: %v", lines[2])
+	}
+	if lines[3]["status"] != float64(http.StatusForbidden) || lines[3]["identity"] != "bob" {
+		t.Errorf("forbidden request was logged as %v", lines[3])
+	}
+}
+
+func TestSessionExpiryLogged(t *testing.T) {
+	ts, out := newLoggingTestServer(t, DefaultConfig())
+
+	acquired := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/100ms", "", &acquired)
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		for _, line := range out.lines(t) {
+			if line["msg"] != "session expired" {
+				continue
+			}
+			if line["key"] != "k" || line["session"] != acquired.SessionID || line["ttl"] != "100ms" || line["namespace"] != defaultNamespace {
+				t.Fatalf("expiry was logged as %v", line)
+			}
+			return
+		}
+	}
+	t.Fatal("expiry was not logged")
+}
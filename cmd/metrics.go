@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type metricKind string
+
+const (
+	metricCounter   metricKind = "counter"
+	metricGauge     metricKind = "gauge"
+	metricHistogram metricKind = "histogram"
+)
+
+var defaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+type metricSeries struct {
+	labels  string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type metricFamily struct {
+	name   string
+	help   string
+	kind   metricKind
+	series map[string]*metricSeries
+}
+
+// metrics is a minimal registry of counters and histograms exposed in the
+// Prometheus text format. Gauges are collected when scraped.
+type metrics struct {
+	lock     sync.Mutex
+	families map[string]*metricFamily
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		families: map[string]*metricFamily{},
+	}
+
+	m.register("distlock_http_requests_total", metricCounter, "HTTP requests by route, method and status code.")
+	m.register("distlock_http_request_duration_seconds", metricHistogram, "HTTP request latency by route.")
+	m.register("distlock_lock_wait_seconds", metricHistogram, "Time spent waiting for a mutex or queue item.")
+	m.register("distlock_lock_contention_total", metricCounter, "Acquisitions that failed because the lock was held.")
+	m.register("distlock_session_expirations_total", metricCounter, "Sessions that expired without being renewed.")
+	m.register("distlock_mutex_timeouts_total", metricCounter, "Mutex lock requests that timed out.")
+
+	return m
+}
+
+func (m *metrics) register(name string, kind metricKind, help string) {
+	m.families[name] = &metricFamily{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		series: map[string]*metricSeries{},
+	}
+}
+
+// labels renders name/value pairs as a Prometheus label set.
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%s", pairs[i], strconv.Quote(pairs[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *metrics) series(name string, labelSet string) *metricSeries {
+	family := m.families[name]
+	s, ok := family.series[labelSet]
+	if !ok {
+		s = &metricSeries{labels: labelSet}
+		if family.kind == metricHistogram {
+			s.buckets = make([]uint64, len(defaultBuckets))
+		}
+		family.series[labelSet] = s
+	}
+	return s
+}
+
+func (m *metrics) inc(name string, labelPairs ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.series(name, labels(labelPairs...)).value++
+}
+
+func (m *metrics) observe(name string, duration time.Duration, labelPairs ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.series(name, labels(labelPairs...))
+	value := duration.Seconds()
+	for idx, bound := range defaultBuckets {
+		if value <= bound {
+			s.buckets[idx]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func writeSample(w io.Writer, name string, labelSet string, value float64) {
+	if labelSet != "" {
+		name += "{" + labelSet + "}"
+	}
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func joinLabels(a string, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+// write renders all registered metrics followed by the gauges, which are
+// given as name to label set to value.
+func (m *metrics) write(w io.Writer, gauges map[string]map[string]float64, gaugeHelp map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	names := []string{}
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := m.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+
+		labelSets := []string{}
+		for labelSet := range family.series {
+			labelSets = append(labelSets, labelSet)
+		}
+		sort.Strings(labelSets)
+
+		for _, labelSet := range labelSets {
+			s := family.series[labelSet]
+			if family.kind != metricHistogram {
+				writeSample(w, name, labelSet, s.value)
+				continue
+			}
+			for idx, bound := range defaultBuckets {
+				writeSample(w, name+"_bucket", joinLabels(labelSet, labels("le", strconv.FormatFloat(bound, 'g', -1, 64))), float64(s.buckets[idx]))
+			}
+			writeSample(w, name+"_bucket", joinLabels(labelSet, labels("le", "+Inf")), float64(s.count))
+			writeSample(w, name+"_sum", labelSet, s.sum)
+			writeSample(w, name+"_count", labelSet, float64(s.count))
+		}
+	}
+
+	gaugeNames := []string{}
+	for name := range gauges {
+		gaugeNames = append(gaugeNames, name)
+	}
+	sort.Strings(gaugeNames)
+
+	for _, name := range gaugeNames {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, gaugeHelp[name], name, metricGauge)
+
+		labelSets := []string{}
+		for labelSet := range gauges[name] {
+			labelSets = append(labelSets, labelSet)
+		}
+		sort.Strings(labelSets)
+
+		for _, labelSet := range labelSets {
+			writeSample(w, name, labelSet, gauges[name][labelSet])
+		}
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// instrument counts requests and their latency per route pattern.
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if pattern := routePattern(r); pattern != "" {
+			route = pattern
+		}
+
+		m.inc("distlock_http_requests_total", "route", route, "method", r.Method, "code", strconv.Itoa(recorder.status))
+		m.observe("distlock_http_request_duration_seconds", time.Since(start), "route", route)
+	})
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// scrape returns the samples of /metrics by name and label set, as in
+// `distlock_keys{namespace="default"}`.
+func scrape(t *testing.T, ts *httptest.Server) map[string]float64 {
+	t.Helper()
+
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("scrape got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	ret := map[string]float64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndexByte(line, ' ')
+		if idx == -1 {
+			t.Fatalf("malformed sample %q", line)
+		}
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			t.Fatalf("malformed sample %q", line)
+		}
+		ret[line[:idx]] = value
+	}
+	return ret
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	call(t, ts, http.MethodPost, "/kv/set/k?value=12345", "", nil)
+	acquire(t, ts, "l")
+	call(t, ts, http.MethodPost, "/kv/acquire/l/10s", "", nil)
+	call(t, ts, http.MethodPost, "/mutex/lock/m", "", nil)
+	call(t, ts, http.MethodPost, "/mutex/lock/m?timeout=10ms", "", nil)
+	call(t, ts, http.MethodPost, "/kv/acquire/e/100ms", "", nil)
+	call(t, ts, http.MethodGet, "/no/such/route", "", nil)
+
+	time.Sleep(300 * time.Millisecond)
+	samples := scrape(t, ts)
+
+	for sample, want := range map[string]float64{
+		`distlock_http_requests_total{route="/kv/set/{key}",method="POST",code="200"}`:                1,
+		`distlock_http_requests_total{route="/kv/acquire/{key}/{duration}",method="POST",code="200"}`: 3,
+		`distlock_http_requests_total{route="unmatched",method="GET",code="404"}`:                     1,
+		`distlock_http_request_duration_seconds_count{route="/mutex/lock/{key}"}`:                     2,
+		`distlock_lock_contention_total{primitive="kv"}`:                                              1,
+		`distlock_lock_contention_total{primitive="mutex"}`:                                           1,
+		`distlock_mutex_timeouts_total`:                                                               1,
+		`distlock_session_expirations_total{namespace="default"}`:                                     1,
+		`distlock_keys{namespace="default"}`:                                                          2,
+		`distlock_value_bytes{namespace="default"}`:                                                   5,
+		`distlock_sessions{namespace="default"}`:                                                      1,
+		`distlock_locks_held{namespace="default"}`:                                                    1,
+		`distlock_mutexes_held{namespace="default"}`:                                                  1,
+	} {
+		if got, ok := samples[sample]; !ok || got != want {
+			t.Errorf("%s: got %v, want %v", sample, got, want)
+		}
+	}
+
+	// the timed out lock waited at least its timeout
+	if sum := samples[`distlock_lock_wait_seconds_sum{primitive="mutex"}`]; sum < 0.01 {
+		t.Errorf("mutex wait time %v", sum)
+	}
+}
+
+func TestMetricsRequireAdmin(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthFile = writeACL(t, testACL)
+	ts := newTestServer(t, config)
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "t-alice": http.StatusForbidden, "t-root": http.StatusOK} {
+		if code := callAs(t, ts, token, http.MethodGet, "/metrics", "", nil); code != want {
+			t.Errorf("token %q: got %d, want %d", token, code, want)
+		}
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	m := newMetrics()
+	m.observe("distlock_lock_wait_seconds", 20*time.Millisecond, "primitive", "kv")
+	m.observe("distlock_lock_wait_seconds", 2*time.Second, "primitive", "kv")
+	m.inc("distlock_mutex_timeouts_total")
+
+	buf := bytes.Buffer{}
+	m.write(&buf, map[string]map[string]float64{"distlock_keys": {labels("namespace", `a"b`): 3}}, map[string]string{"distlock_keys": "Keys."})
+	out := buf.String()
+
+	for _, want := range []string{
+		"# HELP distlock_lock_wait_seconds Time spent waiting for a mutex or queue item.\n# TYPE distlock_lock_wait_seconds histogram\n",
+		`distlock_lock_wait_seconds_bucket{primitive="kv",le="0.01"} 0` + "\n",
+		`distlock_lock_wait_seconds_bucket{primitive="kv",le="0.05"} 1` + "\n",
+		`distlock_lock_wait_seconds_bucket{primitive="kv",le="5"} 2` + "\n",
+		`distlock_lock_wait_seconds_bucket{primitive="kv",le="+Inf"} 2` + "\n",
+		`distlock_lock_wait_seconds_sum{primitive="kv"} 2.02` + "\n",
+		`distlock_lock_wait_seconds_count{primitive="kv"} 2` + "\n",
+		"# TYPE distlock_mutex_timeouts_total counter\ndistlock_mutex_timeouts_total 1\n",
+		"# HELP distlock_keys Keys.\n# TYPE distlock_keys gauge\n" + `distlock_keys{namespace="a\"b"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// families without samples are still described
+	if !strings.Contains(out, "# TYPE distlock_session_expirations_total counter\n") {
+		t.Errorf("empty family missing:\n%s", out)
+	}
+}
+
+func TestMetricsAcquireAllWait(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	sessionID := acquire(t, ts, "k")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if resp, err := ts.Client().Post(ts.URL+"/kv/release/k/"+sessionID, "", nil); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	ret := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquireall/10s", `{"keys":["k"],"wait":true}`, &ret)
+	if !ret.Success {
+		t.Fatal("waiting acquireall failed")
+	}
+
+	if count := scrape(t, ts)[`distlock_lock_wait_seconds_count{primitive="kv"}`]; count != 1 {
+		t.Fatalf("acquireall wait was observed %v times", count)
+	}
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+const defaultNamespace = "default"
+
+// HeaderNamespace selects the namespace of a request. Alternatively the
+// path can be prefixed with /ns/{namespace}.
+const HeaderNamespace = "X-Distlock-Namespace"
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// namespace holds an isolated keyspace. All maps are guarded by the global
+// kvLock, except Locks, MutexOwners and MutexWaiters which are guarded by
+// locksLock.
+type namespace struct {
+	Name  string
+	Quota types.NamespaceQuota
+
+	Sessions map[string]*session
+	KVs      map[string]*lockableValue
+	Queues   map[string]*queue
+
+	Locks       map[string]chan struct{}
+	MutexOwners map[string]string
+	// MutexWaiters counts the requests blocked on each mutex.
+	MutexWaiters map[string]int64
+
+	// Deleted is closed when the namespace is deleted to release
+	// blocked requests.
+	Deleted chan struct{}
+	// Released is closed and replaced whenever a lock is released, to wake
+	// up requests waiting for locks.
+	Released chan struct{}
+}
+
+func newNamespace(name string, quota types.NamespaceQuota) *namespace {
+	return &namespace{
+		Name:         name,
+		Quota:        quota,
+		Sessions:     map[string]*session{},
+		KVs:          map[string]*lockableValue{},
+		Queues:       map[string]*queue{},
+		Locks:        map[string]chan struct{}{},
+		MutexOwners:  map[string]string{},
+		MutexWaiters: map[string]int64{},
+		Deleted:      make(chan struct{}),
+		Released:     make(chan struct{}),
+	}
+}
+
+func (ns *namespace) valueBytes() int64 {
+	var ret int64
+	for _, v := range ns.KVs {
+		ret += int64(v.size())
+	}
+	for _, q := range ns.Queues {
+		for _, item := range q.Pending {
+			ret += int64(item.Value.size())
+		}
+		for _, item := range q.Leased {
+			ret += int64(item.Value.size())
+		}
+	}
+	return ret
+}
+
+// signalReleased wakes up every request waiting for a lock. It must be
+// called with kvLock held.
+func (ns *namespace) signalReleased() {
+	close(ns.Released)
+	ns.Released = make(chan struct{})
+}
+
+// checkQuota returns errQuotaExceeded if adding newKeys keys and growing
+// the stored values by grow bytes would exceed the namespace's quota.
+func (ns *namespace) checkQuota(newKeys int, grow int64) error {
+	if newKeys > 0 && ns.Quota.MaxKeys > 0 && int64(len(ns.KVs)+newKeys) > ns.Quota.MaxKeys {
+		return errQuotaExceeded
+	}
+	if grow > 0 && ns.Quota.MaxValueBytes > 0 && ns.valueBytes()+grow > ns.Quota.MaxValueBytes {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+func (ns *namespace) checkSessionQuota() error {
+	if ns.Quota.MaxSessions > 0 && int64(len(ns.Sessions)) >= ns.Quota.MaxSessions {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// info must be called with kvLock held.
+func (ns *namespace) info() types.NamespaceInfo {
+	return types.NamespaceInfo{
+		Name:       ns.Name,
+		Quota:      ns.Quota,
+		Keys:       int64(len(ns.KVs)),
+		ValueBytes: ns.valueBytes(),
+		Sessions:   int64(len(ns.Sessions)),
+	}
+}
+
+type namespaceCounts struct {
+	locksHeld   int64
+	mutexesHeld int64
+	queueItems  int64
+	queueLeased int64
+}
+
+// counts must be called with kvLock and locksLock held.
+func (ns *namespace) counts() namespaceCounts {
+	ret := namespaceCounts{}
+	for _, v := range ns.KVs {
+		if v.IsLocked {
+			ret.locksHeld++
+		}
+	}
+	for _, m := range ns.Locks {
+		ret.mutexesHeld += int64(len(m))
+	}
+	for _, q := range ns.Queues {
+		ret.queueItems += int64(len(q.Pending))
+		ret.queueLeased += int64(len(q.Leased))
+	}
+	return ret
+}
+
+// clear stops all timers of the namespace and wakes up everyone waiting on
+// it. It must be called with kvLock held.
+func (ns *namespace) clear() {
+	close(ns.Deleted)
+	for _, s := range ns.Sessions {
+		if s.Timer != nil {
+			s.Timer.Stop()
+		}
+	}
+	for _, v := range ns.KVs {
+		if v.Timer != nil {
+			v.Timer.Stop()
+		}
+	}
+	for _, q := range ns.Queues {
+		for _, item := range q.Leased {
+			if item.Timer != nil {
+				item.Timer.Stop()
+			}
+		}
+		q.signal()
+	}
+}
+
+type namespaceContextKey struct{}
+
+type namespaceRegistry struct {
+	lock       sync.RWMutex
+	namespaces map[string]*namespace
+}
+
+func newNamespaceRegistry() *namespaceRegistry {
+	return &namespaceRegistry{
+		namespaces: map[string]*namespace{
+			defaultNamespace: newNamespace(defaultNamespace, types.NamespaceQuota{}),
+		},
+	}
+}
+
+func (n *namespaceRegistry) get(name string) (*namespace, bool) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	ns, ok := n.namespaces[name]
+	return ns, ok
+}
+
+// selectNamespace stores the namespace chosen by the request's header or
+// /ns/{namespace} path prefix in the request context. Requests without
+// either use the default namespace.
+func (n *namespaceRegistry) selectNamespace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(HeaderNamespace)
+
+		if strings.HasPrefix(r.URL.Path, "/ns/") {
+			rest := strings.TrimPrefix(r.URL.Path, "/ns/")
+			idx := strings.IndexByte(rest, '/')
+			if idx == -1 {
+				http.NotFound(w, r)
+				return
+			}
+
+			name = rest[:idx]
+
+			u := *r.URL
+			u.Path = rest[idx:]
+			u.RawPath = ""
+			r2 := r.Clone(r.Context())
+			r2.URL = &u
+			r = r2
+		}
+
+		if name == "" {
+			name = defaultNamespace
+		}
+
+		ns, ok := n.get(name)
+		if !ok {
+			http.Error(w, "namespace does not exist", http.StatusNotFound)
+			return
+		}
+
+		logFields(r, "namespace", ns.Name)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), namespaceContextKey{}, ns)))
+	})
+}
+
+func requestNamespace(r *http.Request) *namespace {
+	return r.Context().Value(namespaceContextKey{}).(*namespace)
+}
+
+// quotaError writes err with the status code matching it.
+func quotaError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func createNamespace(t *testing.T, ts *httptest.Server, name string, quota string) {
+	t.Helper()
+
+	ret := types.NamespaceReturn{}
+	call(t, ts, http.MethodPost, "/admin/namespaces/"+name, quota, &ret)
+	if !ret.Success {
+		t.Fatalf("creating namespace %s failed", name)
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	createNamespace(t, ts, "team-a", "")
+	createNamespace(t, ts, "team-b", "")
+
+	call(t, ts, http.MethodPost, "/ns/team-a/kv/set/deploy?value=a", "", nil)
+
+	// the header selects the namespace as well as the path prefix
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/kv/set/deploy?value=b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderNamespace, "team-b")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for path, want := range map[string]string{"/ns/team-a/kv/get/deploy": "a", "/ns/team-b/kv/get/deploy": "b", "/ns/default/kv/get/deploy": ""} {
+		get := types.GetReturn{}
+		call(t, ts, http.MethodGet, path, "", &get)
+		if get.Value != want || get.Success != (want != "") {
+			t.Errorf("%s: got %+v, want %q", path, get, want)
+		}
+	}
+
+	// the same lock, mutex and counter can be held in every namespace
+	acquireA := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/ns/team-a/kv/acquire/deploy/10s", "", &acquireA)
+	acquireB := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/ns/team-b/kv/acquire/deploy/10s", "", &acquireB)
+	if !acquireA.Success || !acquireB.Success {
+		t.Fatal("a lock in one namespace blocks the other")
+	}
+
+	for _, ns := range []string{"team-a", "team-b"} {
+		mutex := types.MutexReturn{}
+		call(t, ts, http.MethodPost, "/ns/"+ns+"/mutex/lock/m?timeout=100ms", "", &mutex)
+		if !mutex.Success {
+			t.Fatalf("mutex in %s is held by another namespace", ns)
+		}
+		counter := types.IntReturn{}
+		call(t, ts, http.MethodPost, "/ns/"+ns+"/int/c?op=inc", "", &counter)
+		if counter.Value != 1 {
+			t.Fatalf("counter in %s is shared: %+v", ns, counter)
+		}
+	}
+
+	// sessions are only known in their namespace
+	renew := types.RenewReturn{}
+	call(t, ts, http.MethodPost, "/ns/team-b/session/renew/"+acquireA.SessionID+"/10s", "", &renew)
+	if renew.Success {
+		t.Fatal("session of team-a was renewed in team-b")
+	}
+	released := types.ReleaseReturn{}
+	call(t, ts, http.MethodPost, "/ns/team-b/kv/release/deploy/"+acquireA.SessionID, "", &released)
+	if released.Success {
+		t.Fatal("session of team-a released a lock in team-b")
+	}
+
+	keys := []string{}
+	call(t, ts, http.MethodGet, "/kv/keys", "", &keys)
+	if len(keys) != 0 {
+		t.Fatalf("default namespace lists %v", keys)
+	}
+}
+
+func TestMissingNamespace(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	for _, path := range []string{"/ns/missing/kv/get/k", "/ns/missing", "/ns/"} {
+		if code := call(t, ts, http.MethodGet, path, "", nil); code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want %d", path, code, http.StatusNotFound)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/kv/set/k?value=v", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderNamespace, "missing")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("header with a missing namespace got %d", resp.StatusCode)
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/k", "", &get)
+	if get.Success {
+		t.Fatal("request to a missing namespace wrote to the default one")
+	}
+}
+
+func TestNamespaceQuotas(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	createNamespace(t, ts, "small", `{"maxKeys":2,"maxValueBytes":10}`)
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/ns/small/kv/set/a?value=12345", "", http.StatusOK},
+		{"/ns/small/kv/set/b?value=1234", "", http.StatusOK},
+		{"/ns/small/kv/set/c?value=1", "", http.StatusTooManyRequests},
+		{"/ns/small/kv/acquire/c/10s", "", http.StatusTooManyRequests},
+		{"/ns/small/int/c?op=inc", "", http.StatusTooManyRequests},
+		{"/ns/small/kv/setm", `{"entries":[{"key":"b","value":"1"},{"key":"d","value":"1"}]}`, http.StatusTooManyRequests},
+		{"/ns/small/queue/push/q?value=12", "", http.StatusTooManyRequests},
+	} {
+		if code := call(t, ts, http.MethodPost, tc.path, tc.body, nil); code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.path, code, tc.want)
+		}
+	}
+
+	// overwriting does not add a key, but may not grow past the bytes
+	acquired := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/ns/small/kv/acquire/a/10s", "", &acquired)
+	if !acquired.Success {
+		t.Fatal("acquiring an existing key failed")
+	}
+	set := types.SetReturn{}
+	call(t, ts, http.MethodPost, "/ns/small/kv/set/a?value=123456&sessionId="+acquired.SessionID, "", &set)
+	if !set.Success {
+		t.Fatal("overwrite within the quota failed")
+	}
+	if code := call(t, ts, http.MethodPost, "/ns/small/kv/set/a?value=1234567&sessionId="+acquired.SessionID, "", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("overwrite beyond the quota got %d", code)
+	}
+
+	// the default namespace is not limited
+	if code := call(t, ts, http.MethodPost, "/kv/set/c?value=1", "", nil); code != http.StatusOK {
+		t.Fatalf("quota of another namespace applied to the default one: %d", code)
+	}
+
+	list := types.NamespacesReturn{}
+	call(t, ts, http.MethodGet, "/admin/namespaces", "", &list)
+	if len(list.Namespaces) != 2 || list.Namespaces[1].Name != "small" {
+		t.Fatalf("namespaces: %+v", list)
+	}
+	if info := list.Namespaces[1]; info.Keys != 2 || info.ValueBytes != 10 || info.Sessions != 1 || info.Quota.MaxKeys != 2 {
+		t.Fatalf("usage of small: %+v", info)
+	}
+}
+
+func TestNamespaceSessionQuota(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	createNamespace(t, ts, "small", `{"maxSessions":1}`)
+
+	acquired := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/ns/small/kv/acquire/a/10s", "", &acquired)
+	if !acquired.Success {
+		t.Fatal("first session was refused")
+	}
+	for _, path := range []string{"/ns/small/kv/acquire/b/10s", "/ns/small/kv/acquireall/10s"} {
+		if code := call(t, ts, http.MethodPost, path, `{"keys":["b"]}`, nil); code != http.StatusTooManyRequests {
+			t.Errorf("%s: second session got %d", path, code)
+		}
+	}
+
+	// releasing keeps the session, destroying it frees the slot
+	call(t, ts, http.MethodPost, "/ns/small/kv/release/a/"+acquired.SessionID, "", nil)
+	if code := call(t, ts, http.MethodPost, "/ns/small/kv/acquire/b/10s", "", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("session after the release got %d", code)
+	}
+	call(t, ts, http.MethodPost, "/ns/small/session/destroy/"+acquired.SessionID, "", nil)
+	if code := call(t, ts, http.MethodPost, "/ns/small/kv/acquire/b/10s", "", nil); code != http.StatusOK {
+		t.Fatalf("session after the destroy got %d", code)
+	}
+
+	// raising the quota of an existing namespace keeps its state
+	createNamespace(t, ts, "small", `{"maxSessions":2}`)
+	if code := call(t, ts, http.MethodPost, "/ns/small/kv/acquire/c/10s", "", nil); code != http.StatusOK {
+		t.Fatalf("session after raising the quota got %d", code)
+	}
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	createNamespace(t, ts, "tmp", "")
+
+	lock := types.MutexReturn{}
+	call(t, ts, http.MethodPost, "/ns/tmp/mutex/lock/m", "", &lock)
+
+	blocked := make(chan int, 1)
+	go func() {
+		resp, err := ts.Client().Post(ts.URL+"/ns/tmp/mutex/lock/m", "", nil)
+		if err != nil {
+			blocked <- 0
+			return
+		}
+		resp.Body.Close()
+		blocked <- resp.StatusCode
+	}()
+	waitForWaiters(t, ts, 1)
+
+	deleted := types.NamespaceReturn{}
+	call(t, ts, http.MethodDelete, "/admin/namespaces/tmp", "", &deleted)
+	if !deleted.Success {
+		t.Fatal("delete failed")
+	}
+
+	select {
+	case code := <-blocked:
+		if code != http.StatusGone {
+			t.Fatalf("blocked lock got %d, want %d", code, http.StatusGone)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("blocked lock was not released by the delete")
+	}
+
+	if code := call(t, ts, http.MethodGet, "/ns/tmp/kv/get/k", "", nil); code != http.StatusNotFound {
+		t.Fatalf("deleted namespace got %d", code)
+	}
+
+	deleted = types.NamespaceReturn{}
+	call(t, ts, http.MethodDelete, "/admin/namespaces/tmp", "", &deleted)
+	if deleted.Success {
+		t.Fatal("deleting a missing namespace succeeded")
+	}
+	if code := call(t, ts, http.MethodDelete, "/admin/namespaces/default", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("deleting the default namespace got %d", code)
+	}
+}
+
+func TestNamespacePolicy(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthFile = writeACL(t, `{"tokens": [
+		{"token": "t-admin", "admin": true},
+		{"token": "t-a", "policies": [{"namespace": "team-a", "rights": ["read", "write"]}]}
+	]}`)
+	ts := newTestServer(t, config)
+
+	if code := callAs(t, ts, "t-admin", http.MethodPost, "/admin/namespaces/team-a", "", nil); code != http.StatusOK {
+		t.Fatalf("create got %d", code)
+	}
+	if code := callAs(t, ts, "t-a", http.MethodPost, "/admin/namespaces/team-b", "", nil); code != http.StatusForbidden {
+		t.Fatalf("create without admin got %d", code)
+	}
+
+	if code := callAs(t, ts, "t-a", http.MethodPost, "/ns/team-a/kv/set/k?value=v", "", nil); code != http.StatusOK {
+		t.Fatalf("set in the token's namespace got %d", code)
+	}
+	if code := callAs(t, ts, "t-a", http.MethodPost, "/kv/set/k?value=v", "", nil); code != http.StatusForbidden {
+		t.Fatalf("set in another namespace got %d", code)
+	}
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPIDocument describes routes as an OpenAPI 3 document. The schemas
+// are generated from the request and response types, so the document
+// cannot drift from the types package.
+func openAPIDocument(routes []v1Route) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range routes {
+		parameters := []interface{}{}
+		for _, segment := range strings.Split(route.pattern, "/") {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     strings.Trim(segment, "{}"),
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		for _, param := range route.params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":   param,
+				"in":     "query",
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+
+		response := map[string]interface{}{"description": "OK"}
+		if route.response != nil {
+			response["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.response), schemas)},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"summary":    route.summary,
+			"parameters": parameters,
+			"responses": map[string]interface{}{
+				"200": response,
+				"400": map[string]interface{}{"description": "Invalid request"},
+				"403": map[string]interface{}{"description": "Forbidden"},
+			},
+		}
+
+		if route.request != nil {
+			contentTypes := route.contentTypes
+			if len(contentTypes) == 0 {
+				contentTypes = []string{"application/json"}
+			}
+			content := map[string]interface{}{}
+			for _, contentType := range contentTypes {
+				content[contentType] = map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.request), schemas)}
+			}
+			operation["requestBody"] = map[string]interface{}{"content": content}
+		}
+
+		if paths[route.pattern] == nil {
+			paths[route.pattern] = map[string]interface{}{}
+		}
+		paths[route.pattern][strings.ToLower(route.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "distlock",
+			"version": Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// schemaOf returns the JSON schema of t as encoding/json encodes it. Named
+// structs are added to schemas and referenced.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Name() == "" {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			// placeholder against recursive types
+			schemas[t.Name()] = nil
+			properties := map[string]interface{}{}
+			required := []string{}
+			structFields(t, properties, &required, schemas)
+			schema := map[string]interface{}{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				schema["required"] = required
+			}
+			schemas[t.Name()] = schema
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	// interfaces and json.RawMessage can hold any value
+	return map[string]interface{}{}
+}
+
+// structFields adds the fields of t to properties, fields of embedded
+// structs are inlined like encoding/json does.
+func structFields(t reflect.Type, properties map[string]interface{}, required *[]string, schemas map[string]interface{}) {
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			structFields(field.Type, properties, required, schemas)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		omitEmpty := false
+		if tag := field.Tag.Get("json"); tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+		}
+
+		if field.Type.Name() == "RawMessage" {
+			properties[name] = map[string]interface{}{}
+		} else {
+			properties[name] = schemaOf(field.Type, schemas)
+		}
+		if !omitEmpty && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+)
+
+type queueItem struct {
+	ID    string
+	Value typedValue
+	// Receipt identifies the current lease, every pop hands out a new one.
+	// Acks and nacks carrying an older receipt are refused.
+	Receipt   string
+	SessionID *string
+	Timer     *time.Timer
+}
+
+type queue struct {
+	Pending []*queueItem
+	Leased  map[string]*queueItem
+	Notify  chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{
+		Pending: []*queueItem{},
+		Leased:  map[string]*queueItem{},
+		Notify:  make(chan struct{}),
+	}
+}
+
+// signal wakes up every pop currently waiting on the queue.
+func (q *queue) signal() {
+	close(q.Notify)
+	q.Notify = make(chan struct{})
+}
+
+// requeue puts a leased item back at the front of the queue so it is
+// handed out again before newer items.
+func (q *queue) requeue(item *queueItem) {
+	if _, ok := q.Leased[item.ID]; !ok {
+		return
+	}
+	if item.Timer != nil {
+		item.Timer.Stop()
+	}
+	delete(q.Leased, item.ID)
+	item.Receipt = ""
+	item.SessionID = nil
+	item.Timer = nil
+	q.Pending = append([]*queueItem{item}, q.Pending...)
+	q.signal()
+}
+
+func startLeaseTimer(duration time.Duration, q *queue, item *queueItem, lock *sync.RWMutex) {
+	if item.Timer != nil {
+		item.Timer.Stop()
+	}
+	receipt := item.Receipt
+	item.Timer = time.AfterFunc(duration, func() {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// The timer may have fired while the item was settled and leased
+		// again, that lease has its own timer.
+		if item.Receipt != receipt {
+			return
+		}
+		q.requeue(item)
+	})
+}
+
+// leased returns the item leased under receipt.
+func (q *queue) leased(itemID string, receipt string) (*queueItem, bool) {
+	item, ok := q.Leased[itemID]
+	if !ok || item.Receipt != receipt {
+		return nil, false
+	}
+	return item, true
+}
+
+// requeueSession returns every item leased under sessionID to its queue.
+func requeueSession(sessionID string, queues map[string]*queue) {
+	for _, q := range queues {
+		for _, item := range q.Leased {
+			if item.SessionID != nil && *item.SessionID == sessionID {
+				q.requeue(item)
+			}
+		}
+	}
+}
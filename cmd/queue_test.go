@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func pop(t *testing.T, ts *httptest.Server, queue string, lease string) types.QueuePopReturn {
+	t.Helper()
+
+	ret := types.QueuePopReturn{}
+	call(t, ts, http.MethodPost, "/queue/pop/"+queue+"/"+lease+"?timeout=0s", "", &ret)
+	return ret
+}
+
+func TestQueueLeaseReceipts(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	call(t, ts, http.MethodPost, "/queue/push/q?value=a", "", nil)
+
+	first := pop(t, ts, "q", "100ms")
+	if !first.Success || first.Receipt == "" {
+		t.Fatalf("pop failed: %+v", first)
+	}
+
+	if status := call(t, ts, http.MethodPost, "/queue/ack/q/"+first.ID, "", nil); status != http.StatusBadRequest {
+		t.Fatalf("ack without a receipt returned %d", status)
+	}
+
+	// the lease runs out and a second consumer gets the item
+	time.Sleep(200 * time.Millisecond)
+	second := pop(t, ts, "q", "10s")
+	if !second.Success || second.ID != first.ID || second.Receipt == first.Receipt {
+		t.Fatalf("item was not leased again: %+v", second)
+	}
+
+	ack := types.QueueAckReturn{}
+	call(t, ts, http.MethodPost, "/queue/ack/q/"+first.ID+"?receipt="+first.Receipt, "", &ack)
+	if ack.Success {
+		t.Fatal("expired lease acknowledged the item")
+	}
+	call(t, ts, http.MethodPost, "/queue/nack/q/"+first.ID+"?receipt="+first.Receipt, "", &ack)
+	if ack.Success {
+		t.Fatal("expired lease returned the item")
+	}
+
+	call(t, ts, http.MethodPost, "/queue/ack/q/"+second.ID+"?receipt="+second.Receipt, "", &ack)
+	if !ack.Success {
+		t.Fatal("current lease could not acknowledge the item")
+	}
+
+	if ret := pop(t, ts, "q", "10s"); ret.Success {
+		t.Fatalf("acknowledged item was handed out again: %+v", ret)
+	}
+}
+
+func TestQueueStaleLeaseTimer(t *testing.T) {
+	q := newQueue()
+	lock := &sync.RWMutex{}
+	item := &queueItem{ID: "i", Receipt: "old"}
+	q.Leased[item.ID] = item
+
+	// a timer that fired but waits for the lock while the item is leased
+	// again must leave the new lease alone
+	lock.Lock()
+	startLeaseTimer(time.Millisecond, q, item, lock)
+	time.Sleep(20 * time.Millisecond)
+	item.Receipt = "new"
+	item.Timer = nil
+	lock.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := q.Leased[item.ID]; !ok || len(q.Pending) != 0 {
+		t.Fatal("stale lease timer requeued the item")
+	}
+}
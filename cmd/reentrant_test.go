@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func TestReentrantHolds(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	first := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s?reentrant=true", "", &first)
+	if !first.Success || first.Holds != 1 {
+		t.Fatalf("acquire failed: %+v", first)
+	}
+
+	again := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s?reentrant=true&sessionId="+first.SessionID, "", &again)
+	if !again.Success || again.SessionID != first.SessionID || again.Holds != 2 {
+		t.Fatalf("holder could not acquire again: %+v", again)
+	}
+
+	// without authentication there is no identity to recognize the holder
+	other := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s?reentrant=true", "", &other)
+	if other.Success {
+		t.Fatal("anonymous request acquired a held reentrant lock")
+	}
+
+	release := types.ReleaseReturn{}
+	call(t, ts, http.MethodPost, "/kv/release/k/"+first.SessionID, "", &release)
+	if !release.Success || release.Holds != 1 {
+		t.Fatalf("release did not count down: %+v", release)
+	}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s", "", &other)
+	if other.Success {
+		t.Fatal("lock was free while still held once")
+	}
+
+	call(t, ts, http.MethodPost, "/kv/release/k/"+first.SessionID, "", &release)
+	if !release.Success || release.Holds != 0 {
+		t.Fatalf("last release failed: %+v", release)
+	}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s", "", &other)
+	if !other.Success {
+		t.Fatal("lock was not freed by the last release")
+	}
+}
+
+func TestReentrantByIdentity(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	acl := `{"tokens":[
+		{"token":"t1","name":"alice","policies":[{"rights":["read","write","lock"]}]},
+		{"token":"t2","name":"bob","policies":[{"rights":["read","write","lock"]}]}
+	]}`
+	if err := os.WriteFile(authFile, []byte(acl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.AuthFile = authFile
+	ts := newTestServer(t, config)
+
+	first := types.AcquireReturn{}
+	callAs(t, ts, "t1", http.MethodPost, "/kv/acquire/k/10s?reentrant=true", "", &first)
+
+	again := types.AcquireReturn{}
+	callAs(t, ts, "t1", http.MethodPost, "/kv/acquire/k/10s?reentrant=true", "", &again)
+	if !again.Success || again.SessionID != first.SessionID || again.Holds != 2 {
+		t.Fatalf("owner could not acquire again: %+v", again)
+	}
+
+	other := types.AcquireReturn{}
+	callAs(t, ts, "t2", http.MethodPost, "/kv/acquire/k/10s?reentrant=true", "", &other)
+	if other.Success {
+		t.Fatal("another identity acquired a held reentrant lock")
+	}
+}
+
+func TestAcquireAllIsNotReentrant(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	first := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s?reentrant=true", "", &first)
+	release := types.ReleaseReturn{}
+	call(t, ts, http.MethodPost, "/kv/release/k/"+first.SessionID, "", &release)
+	if !first.Success || !release.Success {
+		t.Fatalf("reentrant acquire and release failed: %+v %+v", first, release)
+	}
+
+	all := types.AcquireAllReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquireall/10s", `{"keys":["k"]}`, &all)
+	if !all.Success {
+		t.Fatalf("acquireall failed: %+v", all)
+	}
+
+	again := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s?reentrant=true&sessionId="+all.SessionID, "", &again)
+	if again.Success {
+		t.Fatalf("lock taken with acquireall was acquired again: %+v", again)
+	}
+}
+
+func TestReleaseEndsReentrancy(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	for _, free := range []string{"release", "releaseall", "force-release", "expire"} {
+		key := "k-" + free
+		ttl := "10s"
+		if free == "expire" {
+			ttl = "100ms"
+		}
+
+		first := types.AcquireReturn{}
+		call(t, ts, http.MethodPost, "/kv/acquire/"+key+"/"+ttl+"?reentrant=true", "", &first)
+		if !first.Success {
+			t.Fatalf("%s: reentrant acquire failed", free)
+		}
+
+		switch free {
+		case "release":
+			call(t, ts, http.MethodPost, "/kv/release/"+key+"/"+first.SessionID, "", nil)
+		case "releaseall":
+			call(t, ts, http.MethodPost, "/kv/releaseall/"+first.SessionID, "", nil)
+		case "force-release":
+			call(t, ts, http.MethodDelete, "/admin/locks/kv/"+key, "", nil)
+		case "expire":
+			time.Sleep(300 * time.Millisecond)
+		}
+
+		// the key is locked again, plainly or with acquireall
+		sessionID := ""
+		if free == "release" || free == "expire" {
+			plain := types.AcquireReturn{}
+			call(t, ts, http.MethodPost, "/kv/acquire/"+key+"/10s", "", &plain)
+			sessionID = plain.SessionID
+		} else {
+			all := types.AcquireAllReturn{}
+			call(t, ts, http.MethodPost, "/kv/acquireall/10s", `{"keys":["`+key+`"]}`, &all)
+			sessionID = all.SessionID
+		}
+		if sessionID == "" {
+			t.Fatalf("%s: lock was not freed", free)
+		}
+
+		again := types.AcquireReturn{}
+		call(t, ts, http.MethodPost, "/kv/acquire/"+key+"/10s?reentrant=true&sessionId="+sessionID, "", &again)
+		if again.Success {
+			t.Fatalf("%s: plain lock was acquired again: %+v", free, again)
+		}
+	}
+}
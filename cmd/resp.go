@@ -0,0 +1,973 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// respServer serves a subset of the Redis protocol so that Redis clients
+// can use distlock for simple locking. Commands are mapped to requests to
+// the HTTP handler, so authentication, namespaces, audit log and metrics
+// apply as for HTTP clients:
+//
+//	GET, MGET, EXISTS, KEYS      read keys
+//	SET, MSET                    set keys, overwriting unlocked keys
+//	SET key value NX PX|EX ttl   acquire the lock on key under a session
+//	EXPIRE, PEXPIRE              renew the session of such a lock
+//	DEL                          release such a lock and delete the key
+//	EVAL, EVALSHA, SCRIPT LOAD   compare-and-delete and compare-and-expire
+//	                             scripts releasing and renewing such locks
+//	INCR, DECR, INCRBY, DECRBY   counter operations
+//	AUTH [user] token            authenticate with an API token
+//	SELECT namespace             select a namespace, 0 is the default one
+//
+// DEL and EXPIRE only reach the locks taken on the same connection. Other
+// connections release and renew a lock with a script passing the value it
+// was set to, as Redis lock libraries do.
+type respServer struct {
+	handler http.Handler
+	maxSize int64
+	log     *logger
+
+	lock sync.Mutex
+	// locks are the locks acquired with SET NX PX.
+	locks   map[respLockKey]respLock
+	scripts map[string]respScript
+	conns   map[net.Conn]bool
+}
+
+type respLockKey struct {
+	namespace string
+	key       string
+}
+
+// respLock is a lock acquired with SET NX PX, value is the value it was set
+// to, which scripts compare against.
+type respLock struct {
+	sessionID string
+	value     string
+	conn      *respConn
+	expiresAt time.Time
+}
+
+// respConn is the state of a client connection.
+type respConn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	w         *bufio.Writer
+	token     string
+	namespace string
+}
+
+// respError is sent to the client as an error reply.
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+var errRESPProtocol = errors.New("protocol error")
+
+const (
+	// respMaxLine limits inline commands and the header lines of commands
+	// sent as arrays, like Redis does.
+	respMaxLine = 64 * 1024
+	// respMaxArgs limits the arguments of a command.
+	respMaxArgs = 64 * 1024
+	// respMaxValues is how many values of the maximum size a command may
+	// carry in total, e.g. MSET of several large values.
+	respMaxValues = 16
+)
+
+// serveRESP serves RESP connections on listener until shuttingDown is
+// closed. handler serves the requests the commands are mapped to.
+func serveRESP(listener net.Listener, handler http.Handler, maxSize int64, shuttingDown <-chan struct{}, log *logger) {
+	s := &respServer{
+		handler: handler,
+		maxSize: maxSize,
+		log:     log,
+		locks:   map[respLockKey]respLock{},
+		scripts: map[string]respScript{},
+		conns:   map[net.Conn]bool{},
+	}
+
+	go func() {
+		<-shuttingDown
+		listener.Close()
+
+		s.lock.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.lock.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-shuttingDown:
+				return
+			default:
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			log.error("resp listener failed", "error", err)
+			return
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = true
+		s.lock.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+func (s *respServer) serve(conn net.Conn) {
+	defer func() {
+		// like net/http, a panicking request only closes its connection
+		if err := recover(); err != nil {
+			s.log.error("resp command panicked", "remote", conn.RemoteAddr().String(), "error", fmt.Sprint(err))
+		}
+		conn.Close()
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+	}()
+
+	c := &respConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+
+	for {
+		args, err := c.readCommand(s.maxSize)
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				c.error("ERR " + err.Error())
+				c.w.Flush()
+			} else if err != io.EOF {
+				s.log.debug("resp connection closed", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.ToUpper(args[0]) == "QUIT"
+		if quit {
+			c.simple("OK")
+		} else if err := s.command(c, args); err != nil {
+			c.error(err.Error())
+		}
+
+		if c.r.Buffered() == 0 || quit {
+			if err := c.w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings or as an
+// inline command. Commands larger than respMaxValues values of maxSize are
+// refused.
+func (c *respConn) readCommand(maxSize int64) ([]string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > respMaxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	}
+
+	total := int64(len(line))
+	args := []string{}
+	for idx := 0; idx < n; idx++ {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got '%.1s'", errRESPProtocol, line)
+		}
+
+		size, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil || size < 0 || size > maxSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+		}
+
+		total += int64(len(line)) + size
+		if total > respMaxValues*maxSize+respMaxLine {
+			return nil, fmt.Errorf("%w: command too large", errRESPProtocol)
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return nil, fmt.Errorf("%w: bulk string not terminated", errRESPProtocol)
+		}
+		args = append(args, string(data[:size]))
+	}
+
+	return args, nil
+}
+
+// readLine reads a line of at most respMaxLine bytes.
+func (c *respConn) readLine() (string, error) {
+	line := []byte{}
+	for {
+		chunk, err := c.r.ReadSlice('\n')
+		line = append(line, chunk...)
+
+		// a full line without newline can only grow beyond the limit
+		if len(line) > respMaxLine || err == bufio.ErrBufferFull && len(line) >= respMaxLine {
+			return "", fmt.Errorf("%w: too big inline request", errRESPProtocol)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+func (c *respConn) simple(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+func (c *respConn) error(s string) {
+	c.w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(s) + "\r\n")
+}
+
+func (c *respConn) integer(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (c *respConn) bulk(data []byte) {
+	c.w.WriteString("$" + strconv.Itoa(len(data)) + "\r\n")
+	c.w.Write(data)
+	c.w.WriteString("\r\n")
+}
+
+func (c *respConn) null() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *respConn) array(n int) {
+	c.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func wrongArgs(name string) error {
+	return respError("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+// command runs a command, errors are sent as error replies.
+func (s *respServer) command(c *respConn, args []string) error {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	switch name {
+	case "PING":
+		if len(args) > 1 {
+			return wrongArgs(name)
+		}
+		if len(args) == 1 {
+			c.bulk([]byte(args[0]))
+		} else {
+			c.simple("PONG")
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		c.bulk([]byte(args[0]))
+	case "AUTH":
+		// the token is checked by the requests made with it
+		if len(args) != 1 && len(args) != 2 {
+			return wrongArgs(name)
+		}
+		c.token = args[len(args)-1]
+		c.simple("OK")
+	case "SELECT":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		if _, err := strconv.Atoi(args[0]); err == nil && args[0] != "0" {
+			return respError("ERR only database 0 exists, select other namespaces by name")
+		}
+		c.namespace = ""
+		if args[0] != "0" {
+			c.namespace = args[0]
+		}
+		c.simple("OK")
+	case "CLIENT":
+		if len(args) == 0 || strings.ToUpper(args[0]) != "SETNAME" && strings.ToUpper(args[0]) != "SETINFO" {
+			return respError("ERR unsupported CLIENT subcommand")
+		}
+		c.simple("OK")
+	case "COMMAND":
+		c.array(0)
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		return s.get(c, args[0])
+	case "MGET", "EXISTS":
+		if len(args) == 0 {
+			return wrongArgs(name)
+		}
+		return s.getm(c, args, name == "EXISTS")
+	case "SET":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		return s.set(c, args[0], args[1], args[2:])
+	case "MSET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return wrongArgs(name)
+		}
+		return s.mset(c, args)
+	case "KEYS":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		return s.keys(c, args[0])
+	case "DEL":
+		if len(args) == 0 {
+			return wrongArgs(name)
+		}
+		deleted := int64(0)
+		for _, key := range args {
+			ok, err := s.del(c, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				deleted++
+			}
+		}
+		c.integer(deleted)
+	case "EXPIRE", "PEXPIRE":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return respError("ERR value is not an integer or out of range")
+		}
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		return s.expire(c, args[0], time.Duration(n)*unit)
+	case "EVAL", "EVALSHA":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		return s.eval(c, name == "EVALSHA", args[0], args[1:])
+	case "SCRIPT":
+		if len(args) != 2 || strings.ToUpper(args[0]) != "LOAD" {
+			return respError("ERR unsupported SCRIPT subcommand")
+		}
+		script, err := parseRESPScript(args[1])
+		if err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.scripts[script.sha] = script
+		s.lock.Unlock()
+		c.bulk([]byte(script.sha))
+	case "INCR", "DECR":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		return s.counter(c, args[0], strings.ToLower(name[:3]), nil)
+	case "INCRBY", "DECRBY":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return respError("ERR value is not an integer or out of range")
+		}
+		if name == "DECRBY" {
+			delta = -delta
+		}
+		return s.counter(c, args[0], string(types.IntOpTypeAdd), &delta)
+	default:
+		return respError(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+	}
+
+	return nil
+}
+
+// call serves the legacy request l for the connection. body is sent as
+// JSON if not nil. It returns the response body, or an error reply if the
+// request failed. A missing key is reported with notFound.
+func (s *respServer) call(c *respConn, l legacyRequest, body interface{}) ([]byte, bool, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, false, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), l.method, l.url(l.query).RequestURI(), reader)
+	if err != nil {
+		return nil, false, respError("ERR " + err.Error())
+	}
+	req.RemoteAddr = c.conn.RemoteAddr().String()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.namespace != "" {
+		req.Header.Set(HeaderNamespace, c.namespace)
+	}
+	if tlsConn, ok := c.conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		req.TLS = &state
+	}
+
+	rec := newResponseBuffer()
+	s.handler.ServeHTTP(rec, req)
+	rec.WriteHeader(http.StatusOK)
+
+	message := strings.TrimSpace(rec.body.String())
+	switch rec.status {
+	case http.StatusOK:
+		return rec.body.Bytes(), true, nil
+	case http.StatusNotFound:
+		if message == "key does not exist" {
+			return nil, false, nil
+		}
+	case http.StatusUnauthorized:
+		return nil, false, respError("NOAUTH " + message)
+	case http.StatusForbidden:
+		return nil, false, respError("NOPERM " + message)
+	}
+	return nil, false, respError("ERR " + message)
+}
+
+// callJSON calls l and decodes the JSON response into ret.
+func (s *respServer) callJSON(c *respConn, l legacyRequest, body interface{}, ret interface{}) error {
+	data, _, err := s.call(c, l, body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, ret)
+}
+
+func (s *respServer) lockKey(c *respConn, key string) respLockKey {
+	return respLockKey{namespace: c.namespace, key: key}
+}
+
+// session returns the session of the lock on key acquired with SET NX PX
+// on the connection c.
+func (s *respServer) session(c *respConn, key string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if lock, ok := s.locks[s.lockKey(c, key)]; ok && lock.conn == c {
+		return lock.sessionID
+	}
+	return ""
+}
+
+// decodedValue returns a value as reported in JSON responses as it is
+// stored, bytes values are base64 encoded there.
+func decodedValue(value string, kind string) []byte {
+	if kind == string(types.ValueKindBytes) {
+		if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+			return data
+		}
+	}
+	return []byte(value)
+}
+
+func (s *respServer) get(c *respConn, key string) error {
+	data, found, err := s.call(c, legacyRequest{method: http.MethodGet, path: []string{"kv", "get", key}, query: url.Values{"raw": {"true"}}}, nil)
+	if err != nil {
+		return err
+	}
+	if !found {
+		c.null()
+		return nil
+	}
+	c.bulk(data)
+	return nil
+}
+
+func (s *respServer) getm(c *respConn, keys []string, count bool) error {
+	ret := types.GetMReturn{}
+	if err := s.callJSON(c, legacyRequest{method: http.MethodGet, path: []string{"kv", "getm"}}, types.GetMRequest{Keys: keys}, &ret); err != nil {
+		return err
+	}
+
+	if count {
+		n := int64(0)
+		for _, entry := range ret.Entries {
+			if entry.Success {
+				n++
+			}
+		}
+		c.integer(n)
+		return nil
+	}
+
+	c.array(len(ret.Entries))
+	for _, entry := range ret.Entries {
+		if entry.Success {
+			c.bulk(decodedValue(entry.Value, entry.Kind))
+		} else {
+			c.null()
+		}
+	}
+	return nil
+}
+
+// set maps SET to acquiring a lock if a TTL is given, to creating the key
+// with NX and to overwriting it otherwise.
+func (s *respServer) set(c *respConn, key string, value string, options []string) error {
+	nx := false
+	var ttl time.Duration
+
+	for idx := 0; idx < len(options); idx++ {
+		option := strings.ToUpper(options[idx])
+		switch option {
+		case "NX":
+			nx = true
+		case "EX", "PX":
+			if idx+1 == len(options) {
+				return respError("ERR syntax error")
+			}
+			idx++
+			n, err := strconv.ParseInt(options[idx], 10, 64)
+			if err != nil || n <= 0 {
+				return respError("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Second
+			if option == "PX" {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+		default:
+			return respError("ERR SET option " + option + " is not supported")
+		}
+	}
+
+	if ttl != 0 {
+		if !nx {
+			return respError("ERR SET with EX or PX requires NX, keys only expire as locks")
+		}
+
+		ret := types.AcquireReturn{}
+		l := legacyRequest{method: http.MethodPost, path: []string{"kv", "acquire", key, ttl.String()}, query: url.Values{"value": {value}}}
+		if err := s.callJSON(c, l, nil, &ret); err != nil {
+			return err
+		}
+		if !ret.Success {
+			c.null()
+			return nil
+		}
+
+		s.lock.Lock()
+		// locks whose sessions expired are forgotten
+		now := time.Now()
+		for lockKey, lock := range s.locks {
+			if lock.expiresAt.Before(now) {
+				delete(s.locks, lockKey)
+			}
+		}
+		s.locks[s.lockKey(c, key)] = respLock{sessionID: ret.SessionID, value: value, conn: c, expiresAt: *ret.ExpiresAt}
+		s.lock.Unlock()
+
+		c.simple("OK")
+		return nil
+	}
+
+	if nx {
+		ret := types.SetReturn{}
+		if err := s.callJSON(c, legacyRequest{method: http.MethodPost, path: []string{"kv", "set", key}, query: url.Values{"value": {value}}}, nil, &ret); err != nil {
+			return err
+		}
+		if !ret.Success {
+			c.null()
+			return nil
+		}
+		c.simple("OK")
+		return nil
+	}
+
+	return s.mset(c, []string{key, value})
+}
+
+func (s *respServer) mset(c *respConn, args []string) error {
+	req := types.SetMRequest{}
+	for idx := 0; idx < len(args); idx += 2 {
+		req.Entries = append(req.Entries, types.KeyValue{Key: args[idx], Value: args[idx+1]})
+	}
+
+	// a single key may be held with SET NX PX by this client
+	query := url.Values{}
+	if len(req.Entries) == 1 {
+		if sessionID := s.session(c, args[0]); sessionID != "" {
+			query.Set("sessionId", sessionID)
+		}
+	}
+
+	ret := types.SetMReturn{}
+	if err := s.callJSON(c, legacyRequest{method: http.MethodPost, path: []string{"kv", "setm"}, query: query}, req, &ret); err != nil {
+		return err
+	}
+	if !ret.Success {
+		return respError("ERR key is locked")
+	}
+	c.simple("OK")
+	return nil
+}
+
+func (s *respServer) keys(c *respConn, pattern string) error {
+	prefix := pattern
+	if idx := strings.IndexAny(pattern, "*?[\\"); idx != -1 {
+		prefix = pattern[:idx]
+	}
+
+	keys := []string{}
+	if err := s.callJSON(c, legacyRequest{method: http.MethodGet, path: []string{"kv", "keys"}, query: url.Values{"prefix": {prefix}}}, nil, &keys); err != nil {
+		return err
+	}
+
+	matching := []string{}
+	for _, key := range keys {
+		if globMatch(pattern, key) {
+			matching = append(matching, key)
+		}
+	}
+
+	c.array(len(matching))
+	for _, key := range matching {
+		c.bulk([]byte(key))
+	}
+	return nil
+}
+
+// del releases the lock on key if it was acquired with SET NX PX on the
+// connection, ends its session and deletes the key.
+func (s *respServer) del(c *respConn, key string) (bool, error) {
+	return s.release(c, key, func(lock respLock) bool { return lock.conn == c })
+}
+
+// release deletes key. If it is locked with SET NX PX and owns accepts the
+// lock, the lock is released and its session ended first.
+func (s *respServer) release(c *respConn, key string, owns func(lock respLock) bool) (bool, error) {
+	s.lock.Lock()
+	sessionID := ""
+	if lock, ok := s.locks[s.lockKey(c, key)]; ok && owns(lock) {
+		sessionID = lock.sessionID
+		delete(s.locks, s.lockKey(c, key))
+	}
+	s.lock.Unlock()
+
+	if sessionID != "" {
+		if err := s.callJSON(c, legacyRequest{method: http.MethodPost, path: []string{"kv", "release", key, sessionID}}, nil, &types.ReleaseReturn{}); err != nil {
+			return false, err
+		}
+	}
+
+	ret := types.DeleteReturn{}
+	if err := s.callJSON(c, legacyRequest{method: http.MethodPost, path: []string{"kv", "delete", key}}, nil, &ret); err != nil {
+		return false, err
+	}
+
+	if sessionID != "" {
+		if _, _, err := s.call(c, legacyRequest{method: http.MethodPost, path: []string{"session", "destroy", sessionID}}, nil); err != nil {
+			return false, err
+		}
+	}
+
+	return ret.Success, nil
+}
+
+// expire renews the session of a lock acquired with SET NX PX on the
+// connection. Other keys do not expire.
+func (s *respServer) expire(c *respConn, key string, ttl time.Duration) error {
+	renewed, err := s.renew(c, key, ttl, func(lock respLock) bool { return lock.conn == c })
+	if err != nil {
+		return err
+	}
+	if renewed {
+		c.integer(1)
+	} else {
+		c.integer(0)
+	}
+	return nil
+}
+
+// renew renews the session of the lock on key if owns accepts the lock, a
+// ttl of zero or less releases it.
+func (s *respServer) renew(c *respConn, key string, ttl time.Duration, owns func(lock respLock) bool) (bool, error) {
+	if ttl <= 0 {
+		return s.release(c, key, owns)
+	}
+
+	s.lock.Lock()
+	lock, ok := s.locks[s.lockKey(c, key)]
+	s.lock.Unlock()
+
+	if !ok || !owns(lock) {
+		return false, nil
+	}
+
+	ret := types.RenewReturn{}
+	if err := s.callJSON(c, legacyRequest{method: http.MethodPost, path: []string{"session", "renew", lock.sessionID, ttl.String()}}, nil, &ret); err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if current, ok := s.locks[s.lockKey(c, key)]; ok && current.sessionID == lock.sessionID {
+		if ret.Success {
+			current.expiresAt = *ret.ExpiresAt
+			s.locks[s.lockKey(c, key)] = current
+		} else {
+			delete(s.locks, s.lockKey(c, key))
+		}
+	}
+
+	return ret.Success, nil
+}
+
+// respScript is one of the Lua scripts Redis lock libraries release and
+// renew locks with. Scripts are not run, only these forms are recognized,
+// ignoring whitespace and the case of command names:
+//
+//	if redis.call("get",KEYS[1]) == ARGV[1] then
+//	    return redis.call("del",KEYS[1])
+//	else
+//	    return 0
+//	end
+//
+// and the same calling pexpire or expire with KEYS[1] and ARGV[2].
+type respScript struct {
+	sha     string
+	command string
+}
+
+var respScriptPattern = regexp.MustCompile(`^ifredis\.call\(["'](?i:get)["'],KEYS\[1\]\)==ARGV\[1\]thenreturnredis\.call\(["']((?i:del|pexpire|expire))["'],KEYS\[1\](,ARGV\[2\])?\);?elsereturn0;?end;?$`)
+
+func parseRESPScript(script string) (respScript, error) {
+	normalized := strings.Join(strings.Fields(script), "")
+
+	m := respScriptPattern.FindStringSubmatch(normalized)
+	command := ""
+	if m != nil {
+		command = strings.ToLower(m[1])
+	}
+	if m == nil || (command == "del") != (m[2] == "") {
+		return respScript{}, respError("ERR only compare-and-delete and compare-and-expire lock scripts are supported")
+	}
+
+	sum := sha1.Sum([]byte(script))
+	return respScript{sha: hex.EncodeToString(sum[:]), command: command}, nil
+}
+
+// eval runs a lock script given as source or, for EVALSHA, by its SHA1
+// from SCRIPT LOAD or an earlier EVAL.
+func (s *respServer) eval(c *respConn, bySHA bool, source string, args []string) error {
+	var script respScript
+	if bySHA {
+		s.lock.Lock()
+		loaded, ok := s.scripts[strings.ToLower(source)]
+		s.lock.Unlock()
+		if !ok {
+			return respError("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		script = loaded
+	} else {
+		parsed, err := parseRESPScript(source)
+		if err != nil {
+			return err
+		}
+		script = parsed
+		s.lock.Lock()
+		s.scripts[script.sha] = script
+		s.lock.Unlock()
+	}
+
+	if args[0] != "1" {
+		return respError("ERR lock scripts take exactly one key")
+	}
+	if script.command == "del" && len(args) < 3 || script.command != "del" && len(args) < 4 {
+		return respError("ERR wrong number of arguments for the lock script")
+	}
+	key, value := args[1], args[2]
+
+	s.lock.Lock()
+	lock, ok := s.locks[s.lockKey(c, key)]
+	s.lock.Unlock()
+
+	owns := func(current respLock) bool { return current.sessionID == lock.sessionID }
+
+	done := false
+	if ok && lock.value == value {
+		var err error
+		switch script.command {
+		case "del":
+			done, err = s.release(c, key, owns)
+		default:
+			n, parseErr := strconv.ParseInt(args[3], 10, 64)
+			if parseErr != nil {
+				return respError("ERR value is not an integer or out of range")
+			}
+			unit := time.Second
+			if script.command == "pexpire" {
+				unit = time.Millisecond
+			}
+			done, err = s.renew(c, key, time.Duration(n)*unit, owns)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if done {
+		c.integer(1)
+	} else {
+		c.integer(0)
+	}
+	return nil
+}
+
+func (s *respServer) counter(c *respConn, key string, op string, delta *int64) error {
+	query := url.Values{"op": {op}}
+	if delta != nil {
+		query.Set("delta", strconv.FormatInt(*delta, 10))
+	}
+	if sessionID := s.session(c, key); sessionID != "" {
+		query.Set("sessionId", sessionID)
+	}
+
+	ret := types.IntReturn{}
+	if err := s.callJSON(c, legacyRequest{method: http.MethodPost, path: []string{"int", key}, query: query}, nil, &ret); err != nil {
+		if strings.Contains(err.Error(), "invalid syntax") {
+			return respError("ERR value is not an integer or out of range")
+		}
+		return err
+	}
+	if !ret.Success {
+		return respError("ERR key is locked or out of bounds")
+	}
+
+	c.integer(ret.Value)
+	return nil
+}
+
+// globMatch matches key against a Redis glob pattern with *, ?, [...]
+// and \ escapes.
+func globMatch(pattern string, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for idx := 0; idx <= len(key); idx++ {
+				if globMatch(pattern, key[idx:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if key == "" {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		case '[':
+			if key == "" {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end == -1 {
+				// an unterminated class matches literally
+				if key[0] != '[' {
+					return false
+				}
+				pattern, key = pattern[1:], key[1:]
+				continue
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for idx := 0; idx < len(class); idx++ {
+				if idx+2 < len(class) && class[idx+1] == '-' {
+					if class[idx] <= key[0] && key[0] <= class[idx+2] {
+						matched = true
+					}
+					idx += 2
+				} else if class[idx] == key[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern, key = pattern[end+2:], key[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if key == "" || pattern[0] != key[0] {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		}
+	}
+	return key == ""
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// respClient is a minimal Redis client for the tests. Replies are returned
+// as strings, integers as :n, errors as -message, nulls as nil and arrays
+// as []interface{}.
+type respClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRESPTestServer(t *testing.T, config Config) string {
+	t.Helper()
+
+	config.LogLevel = "error"
+	s := newServer(config)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := newLogger(io.Discard, config.LogFormat, "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go serveRESP(listener, s.handler, config.MaxValueSize, done, log)
+	t.Cleanup(func() { close(done) })
+
+	return listener.Addr().String()
+}
+
+func dialRESP(t *testing.T, addr string) *respClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &respClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *respClient) do(t *testing.T, args ...string) interface{} {
+	t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func (c *respClient) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-', ':':
+		return line, nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		ret := make([]interface{}, n)
+		for idx := range ret {
+			if ret[idx], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+func expectReply(t *testing.T, got interface{}, want interface{}) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+const respReleaseScript = `if redis.call("get",KEYS[1]) == ARGV[1] then
+    return redis.call("del",KEYS[1])
+else
+    return 0
+end`
+
+func TestRESPCommands(t *testing.T) {
+	c := dialRESP(t, newRESPTestServer(t, DefaultConfig()))
+
+	expectReply(t, c.do(t, "PING"), "PONG")
+	expectReply(t, c.do(t, "SET", "a", "1"), "OK")
+	expectReply(t, c.do(t, "GET", "a"), "1")
+	expectReply(t, c.do(t, "GET", "missing"), nil)
+	expectReply(t, c.do(t, "MGET", "a", "missing"), []interface{}{"1", nil})
+	expectReply(t, c.do(t, "INCR", "n"), ":1")
+	expectReply(t, c.do(t, "INCRBY", "n", "4"), ":5")
+	expectReply(t, c.do(t, "KEYS", "[n]*"), []interface{}{"n"})
+	expectReply(t, c.do(t, "DEL", "a", "missing"), ":1")
+
+	// inline commands
+	if _, err := c.conn.Write([]byte("EXISTS n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectReply(t, reply, ":1")
+}
+
+func TestRESPLockOwnership(t *testing.T) {
+	addr := newRESPTestServer(t, DefaultConfig())
+	first := dialRESP(t, addr)
+	second := dialRESP(t, addr)
+
+	expectReply(t, first.do(t, "SET", "lk", "token-1", "NX", "PX", "10000"), "OK")
+	expectReply(t, second.do(t, "SET", "lk", "token-2", "NX", "PX", "10000"), nil)
+
+	// DEL and EXPIRE only reach locks taken on the same connection
+	expectReply(t, second.do(t, "DEL", "lk"), ":0")
+	expectReply(t, second.do(t, "PEXPIRE", "lk", "1"), ":0")
+	expectReply(t, second.do(t, "SET", "lk", "token-2", "NX", "PX", "10000"), nil)
+
+	// scripts release a lock from any connection knowing its value
+	expectReply(t, second.do(t, "EVAL", respReleaseScript, "1", "lk", "token-2"), ":0")
+	expectReply(t, second.do(t, "GET", "lk"), "token-1")
+
+	sha := second.do(t, "SCRIPT", "LOAD", respReleaseScript)
+	expectReply(t, second.do(t, "EVALSHA", sha.(string), "1", "lk", "token-1"), ":1")
+	expectReply(t, second.do(t, "SET", "lk", "token-2", "NX", "PX", "10000"), "OK")
+
+	expectReply(t, first.do(t, "EVALSHA", "0000", "1", "lk", "token-1"), "-NOSCRIPT No matching script. Please use EVAL.")
+	expectReply(t, second.do(t, "EVAL", `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) else return 0 end`, "1", "lk", "token-2", "20000"), ":1")
+	expectReply(t, second.do(t, "DEL", "lk"), ":1")
+	expectReply(t, first.do(t, "SET", "lk", "token-1", "NX", "PX", "10000"), "OK")
+}
+
+func TestRESPLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxValueSize = 10
+	addr := newRESPTestServer(t, config)
+
+	manyValues := strings.Repeat("$10\r\n0123456789\r\n", 6000)
+	for _, tc := range []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"inline without newline", strings.Repeat("x", respMaxLine+1), "-ERR protocol error: too big inline request"},
+		{"too many arguments", fmt.Sprintf("*%d\r\n", respMaxArgs+1), "-ERR protocol error: invalid multibulk length"},
+		{"value too large", "*2\r\n$3\r\nGET\r\n$11\r\n", "-ERR protocol error: invalid bulk length"},
+		{"command too large", "*6000\r\n" + manyValues, "-ERR protocol error: command too large"},
+	} {
+		c := dialRESP(t, addr)
+
+		// the server stops reading once a limit is exceeded
+		go c.conn.Write([]byte(tc.command))
+
+		reply, err := c.read()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		expectReply(t, reply, tc.want)
+
+		if _, err := c.read(); err == nil {
+			t.Fatalf("%s: connection stayed open", tc.name)
+		}
+	}
+
+	// commands within the limits still work
+	c := dialRESP(t, addr)
+	expectReply(t, c.do(t, "SET", "k", "0123456789"), "OK")
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+const DefaultShutdownTimeout = 10 * time.Second
+
+// shuttingDownError tells a waiting client that the server is shutting
+// down and the request can be retried.
+func shuttingDownError(w http.ResponseWriter) {
+	w.Header().Set(types.HeaderError, types.ErrorShuttingDown)
+	http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+}
+
+// handleSignals shuts the server down on SIGTERM or SIGINT. It closes
+// shuttingDown to release blocked waiters, then waits up to timeout for
+// in-flight requests to finish before closing the remaining connections.
+// The returned channel is closed once the server has stopped.
+func handleSignals(server *http.Server, timeout time.Duration, shuttingDown chan struct{}, log *logger) <-chan struct{} {
+	stopped := make(chan struct{})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	go func() {
+		defer close(stopped)
+
+		sig := <-signals
+		signal.Stop(signals)
+
+		log.info("shutting down", "signal", sig.String(), "timeout", timeout.String())
+		close(shuttingDown)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			log.warn("requests still running after shutdown timeout", "error", err)
+			server.Close()
+		}
+	}()
+
+	return stopped
+}
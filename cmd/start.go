@@ -1,98 +1,391 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/lucsky/cuid"
 
+	"github.com/DENKweit/distlock/trace"
 	"github.com/DENKweit/distlock/types"
 )
 
 type session struct {
-	ID    string `json:"id"`
-	Key   string `json:"-"`
-	Timer *time.Timer
+	ID  string `json:"id"`
+	Key string `json:"-"`
+	// Keys is set for sessions locking several keys at once, Key is then
+	// the first of them.
+	Keys      []string `json:"-"`
+	Owner     string   `json:"-"`
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Timer     *time.Timer
+	// Trace is the span that created the session, its expiry is traced
+	// as part of the same trace.
+	Trace trace.SpanContext `json:"-"`
+}
+
+// keys returns the keys locked by the session.
+func (s *session) keys() []string {
+	if len(s.Keys) > 0 {
+		return s.Keys
+	}
+	return []string{s.Key}
+}
+
+func (s *session) holds(key string) bool {
+	for _, k := range s.keys() {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 type lockableValue struct {
-	Value     string
+	typedValue
 	IsLocked  bool
 	SessionID *string
+	// Reentrant locks can be acquired again by their holder, Holds counts
+	// the acquisitions not released yet.
+	Reentrant bool
+	Holds     int64
+	Mode      types.IntMode
+	Min       *int64
+	Max       *int64
+	Timer     *time.Timer
+}
+
+// unlock frees the lock once its last hold is gone.
+func (v *lockableValue) unlock() {
+	v.IsLocked = false
+	v.SessionID = nil
+	v.Reentrant = false
+	v.Holds = 0
+}
+
+// expireSession removes the session together with the lock it holds, the
+// counters it owns and the queue items leased to it. action tells the audit
+// log whether the session expired or was destroyed.
+func expireSession(s *session, ns *namespace, audit *auditLog, action types.AuditAction) {
+	if s.Timer != nil {
+		s.Timer.Stop()
+	}
+
+	record := func(action types.AuditAction, key string) {
+		audit.record(types.AuditEntry{
+			Action:    action,
+			Namespace: ns.Name,
+			Primitive: string(primitiveKV),
+			Key:       key,
+			SessionID: s.ID,
+			Identity:  s.Owner,
+		})
+	}
+
+	for _, key := range s.keys() {
+		record(action, key)
+
+		if v, ok := ns.KVs[key]; ok && v.SessionID != nil && *v.SessionID == s.ID {
+			if v.Mode == types.IntModeLock {
+				v.unlock()
+				record(types.AuditActionRelease, key)
+			} else {
+				delete(ns.KVs, key)
+				record(types.AuditActionDelete, key)
+			}
+			ns.signalReleased()
+		}
+	}
+
+	for key, v := range ns.KVs {
+		if v.Mode == types.IntModeSession && v.SessionID != nil && *v.SessionID == s.ID {
+			delete(ns.KVs, key)
+			record(types.AuditActionDelete, key)
+		}
+	}
+
+	delete(ns.Sessions, s.ID)
+	requeueSession(s.ID, ns.Queues)
+}
+
+// detachKey removes a deleted key from the session locking it, so the
+// session cannot reach a key created later under the same name. A session
+// left without keys ends like a destroyed one.
+func detachKey(v *lockableValue, key string, ns *namespace, audit *auditLog) {
+	if v.SessionID == nil {
+		return
+	}
+	s, ok := ns.Sessions[*v.SessionID]
+	if !ok || !s.holds(key) {
+		return
+	}
+
+	keys := []string{}
+	for _, k := range s.keys() {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		expireSession(s, ns, audit, types.AuditActionDestroy)
+		return
+	}
+
+	s.Key = keys[0]
+	s.Keys = keys
 }
 
-func startTimer(duration time.Duration, s *session, lock *sync.RWMutex, kvs map[string]*lockableValue, sessions map[string]*session) {
+func startTimer(duration time.Duration, s *session, lock *sync.RWMutex, ns *namespace, audit *auditLog, stats *metrics, tracer *trace.Tracer, log *logger) {
 	if s.Timer != nil {
 		s.Timer.Stop()
 	}
+	s.ExpiresAt = time.Now().Add(duration)
 	s.Timer = time.AfterFunc(duration, func() {
+		_, span := tracer.Start(trace.ContextWithSpanContext(context.Background(), s.Trace), "session.expire", trace.SpanKindInternal)
+		span.SetAttribute("distlock.namespace", ns.Name)
+		span.SetAttribute("distlock.key", s.Key)
+		span.SetAttribute("distlock.session_id", s.ID)
+		defer span.End()
+
 		lock.Lock()
 		defer lock.Unlock()
 
-		delete(kvs, s.Key)
-		delete(sessions, s.ID)
+		expireSession(s, ns, audit, types.AuditActionExpire)
+		stats.inc("distlock_session_expirations_total", "namespace", ns.Name)
+		log.info("session expired", "namespace", ns.Name, "key", s.Key, "session", s.ID, "owner", s.Owner, "ttl", duration.String())
 	})
 }
 
-func Start(port int) {
+// server holds what Start needs besides the handler serving the API.
+type server struct {
+	handler      http.Handler
+	namespaces   *namespaceRegistry
+	log          *logger
+	audit        *auditLog
+	tracer       *trace.Tracer
+	auth         bool
+	shuttingDown chan struct{}
+}
+
+// newServer sets up the routes and the state they share.
+func newServer(config Config) *server {
 	router := chi.NewRouter()
 
-	sessions := map[string]*session{}
+	log, err := newLogger(os.Stderr, config.LogFormat, config.LogLevel)
+	if err != nil {
+		panic(err)
+	}
+
+	var tokens *acl
+	if config.AuthFile != "" {
+		var err error
+		tokens, err = loadACL(config.AuthFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	namespaces := newNamespaceRegistry()
+
+	audit, err := newAuditLog(config.AuditLog)
+	if err != nil {
+		panic(err)
+	}
+
+	stats := newMetrics()
+
+	tracer, err := newTracer(config.TraceExporter)
+	if err != nil {
+		panic(err)
+	}
+
+	// The middlewares run on root, router only routes. This way the /v1
+	// routes can hand requests on to the legacy routes without passing
+	// them through the middlewares twice.
+	root := chi.NewRouter()
+	root.Use(middleware.RequestID)
+	root.Use(log.accessLog)
+	root.Use(stats.instrument)
+	root.Use(traceRequests(tracer))
+	root.Use(tokens.authenticate)
+	root.Use(namespaces.selectNamespace)
+
 	kvLock := sync.RWMutex{}
-	kvs := map[string]*lockableValue{}
 
+	// The operations of an atomic batch run while the batch holds kvLock,
+	// the handlers of these operations lock it with these functions, which
+	// do nothing for them.
+	lockKV := func(r *http.Request) {
+		if !inAtomicBatch(r) {
+			kvLock.Lock()
+		}
+	}
+	unlockKV := func(r *http.Request) {
+		if !inAtomicBatch(r) {
+			kvLock.Unlock()
+		}
+	}
+	rlockKV := func(r *http.Request) {
+		if !inAtomicBatch(r) {
+			kvLock.RLock()
+		}
+	}
+	runlockKV := func(r *http.Request) {
+		if !inAtomicBatch(r) {
+			kvLock.RUnlock()
+		}
+	}
 	locksLock := sync.Mutex{}
-	locks := map[string]chan struct{}{}
+
+	// shuttingDown is closed when the server starts shutting down to
+	// release blocked waiters.
+	shuttingDown := make(chan struct{})
+
+	startedAt := time.Now().UTC()
+	waiters := &waiterCount{}
+
+	router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.HealthReturn{Status: "ok"})
+	})
+
+	router.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		select {
+		case <-shuttingDown:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(types.HealthReturn{Status: "shutting down"})
+		default:
+			json.NewEncoder(w).Encode(types.HealthReturn{Status: "ok"})
+		}
+	})
 
 	router.Get("/status", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(types.StatusReturn{Running: true})
+
+		ret := types.StatusReturn{
+			Running:        true,
+			Ready:          true,
+			Version:        Version,
+			StartedAt:      startedAt,
+			Uptime:         time.Since(startedAt),
+			BlockedWaiters: waiters.count(),
+			Memory:         memoryStatus(),
+			// all state is kept in memory by a single server
+			Persistence: types.PersistenceStatus{Enabled: false},
+			Replication: types.ReplicationStatus{Enabled: false, Mode: "standalone"},
+		}
+
+		select {
+		case <-shuttingDown:
+			ret.Ready = false
+		default:
+		}
+
+		namespaces.lock.RLock()
+		kvLock.RLock()
+		locksLock.Lock()
+
+		ret.Namespaces = int64(len(namespaces.namespaces))
+		for _, ns := range namespaces.namespaces {
+			counts := ns.counts()
+			ret.Keys += int64(len(ns.KVs))
+			ret.Sessions += int64(len(ns.Sessions))
+			ret.LocksHeld += counts.locksHeld
+			ret.MutexesHeld += counts.mutexesHeld
+			ret.QueueItems += counts.queueItems
+		}
+
+		locksLock.Unlock()
+		kvLock.RUnlock()
+		namespaces.lock.RUnlock()
+
+		json.NewEncoder(w).Encode(ret)
 	})
 
-	router.Post("/session/renew/{sessionId}/{duration}", func(w http.ResponseWriter, r *http.Request) {
-		kvLock.Lock()
-		defer kvLock.Unlock()
+	router.With(traceOperation(tracer, "session.renew", "")).Post("/session/renew/{sessionId}/{duration}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		lockKV(r)
+		defer unlockKV(r)
 
 		sessionId := chi.URLParam(r, "sessionId")
 		duration := chi.URLParam(r, "duration")
 
-		interval, err := strconv.ParseInt(duration, 10, 64)
+		interval, err := parseTTL(duration, config)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if session, ok := sessions[sessionId]; ok {
-			startTimer(time.Duration(interval), session, &kvLock, kvs, sessions)
+		ret := types.RenewReturn{
+			Success: false,
+		}
+
+		if session, ok := ns.Sessions[sessionId]; ok {
+			if session.Owner != identity(r) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			startTimer(interval, session, &kvLock, ns, audit, stats, tracer, log)
+			audit.recordRequest(r, types.AuditActionRenew, primitiveKV, session.Key, session.ID, duration)
+			ret.Success = true
+			expiresAt := session.ExpiresAt.UTC()
+			ret.ExpiresAt = &expiresAt
+			ret.Keys = []string{}
+			for _, key := range session.keys() {
+				if v, ok := ns.KVs[key]; ok && v.IsLocked && v.SessionID != nil && *v.SessionID == session.ID {
+					ret.Keys = append(ret.Keys, key)
+				}
+			}
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ret)
 	})
 
-	router.Post("/session/destroy/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+	router.With(traceOperation(tracer, "session.destroy", "")).Post("/session/destroy/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		kvLock.Lock()
 		defer kvLock.Unlock()
 
 		sessionId := chi.URLParam(r, "sessionId")
-		if session, ok := sessions[sessionId]; ok {
-			session.Timer.Stop()
-			delete(kvs, session.Key)
-			delete(sessions, sessionId)
+		if session, ok := ns.Sessions[sessionId]; ok {
+			if session.Owner != identity(r) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			expireSession(session, ns, audit, types.AuditActionDestroy)
 		}
 	})
 
 	router.Get("/kv/keys", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		prefix := r.URL.Query().Get("prefix")
 		kvLock.RLock()
 
 		ret := []string{}
-		for key := range kvs {
-			if prefix != "" && key[:len(prefix)] == prefix {
-				ret = append(ret, key)
-			} else if prefix == "" {
+		for key := range ns.KVs {
+			if !allowed(r, primitiveKV, key, rightRead) {
+				continue
+			}
+			if strings.HasPrefix(key, prefix) {
 				ret = append(ret, key)
 			}
 		}
@@ -103,389 +396,1848 @@ func Start(port int) {
 		json.NewEncoder(w).Encode(ret)
 	})
 
-	router.Post("/kv/acquire/{key}/{duration}", func(w http.ResponseWriter, r *http.Request) {
+	router.With(authorize(primitiveKV, "key", rightLock), traceOperation(tracer, "kv.acquire", "key")).Post("/kv/acquire/{key}/{duration}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		w.Header().Set("Content-Type", "application/json")
-		kvLock.Lock()
 
 		key := chi.URLParam(r, "key")
 		duration := chi.URLParam(r, "duration")
 
-		interval, err := strconv.ParseInt(duration, 10, 64)
+		interval, err := parseTTL(duration, config)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		value := r.URL.Query().Get("value")
+		value, err := readValue(r, config.MaxValueSize)
+
+		if err != nil {
+			valueError(w, err)
+			return
+		}
+
+		reentrant := r.URL.Query().Get("reentrant") == "true"
+		holderSessionID := r.URL.Query().Get("sessionId")
+
+		lockKV(r)
 
 		ret := types.AcquireReturn{
 			SessionID: cuid.New(),
 			Success:   false,
 		}
 
-		if _, ok := kvs[key]; !ok {
-			kvs[key] = &lockableValue{
-				Value:     value,
-				IsLocked:  false,
-				SessionID: &ret.SessionID,
+		// The holder of a reentrant lock acquires it again, it is known by
+		// its session or, without one, by its identity.
+		if v, ok := ns.KVs[key]; ok && v.IsLocked && v.Reentrant && v.SessionID != nil {
+			if s, sessionOk := ns.Sessions[*v.SessionID]; sessionOk && s.Owner == identity(r) && (holderSessionID == s.ID || holderSessionID == "" && s.Owner != "") {
+				v.Holds++
+
+				if expiresAt := time.Now().Add(interval); expiresAt.After(s.ExpiresAt) {
+					startTimer(interval, s, &kvLock, ns, audit, stats, tracer, log)
+				}
+				logFields(r, "session", s.ID)
+				audit.recordRequest(r, types.AuditActionAcquire, primitiveKV, key, s.ID, "holds "+strconv.FormatInt(v.Holds, 10))
+
+				ret.SessionID = s.ID
+				ret.Success = true
+				ret.Holds = v.Holds
+				expiresAt := s.ExpiresAt.UTC()
+				ret.ExpiresAt = &expiresAt
+
+				unlockKV(r)
+				json.NewEncoder(w).Encode(ret)
+				return
 			}
 		}
 
-		if !kvs[key].IsLocked {
-
-			kvs[key].IsLocked = true
+		if _, ok := ns.KVs[key]; !ok {
+			if err := ns.checkQuota(1, int64(value.size())); err != nil {
+				unlockKV(r)
+				quotaError(w, err)
+				return
+			}
+			ns.KVs[key] = &lockableValue{
+				typedValue: value,
+				IsLocked:   false,
+			}
+		}
 
-			sessions[ret.SessionID] = &session{
-				ID:  ret.SessionID,
-				Key: key,
+		if !ns.KVs[key].IsLocked && ns.KVs[key].lockable() {
+			if err := ns.checkSessionQuota(); err != nil {
+				unlockKV(r)
+				quotaError(w, err)
+				return
 			}
 
-			if kvs[key].SessionID == nil {
-				kvs[key].SessionID = &ret.SessionID
+			ns.KVs[key].IsLocked = true
+			ns.KVs[key].Reentrant = reentrant
+			ns.KVs[key].Holds = 1
+
+			ns.Sessions[ret.SessionID] = &session{
+				ID:        ret.SessionID,
+				Key:       key,
+				Owner:     identity(r),
+				CreatedAt: time.Now(),
+				Trace:     trace.SpanContextFromContext(r.Context()),
 			}
 
-			startTimer(time.Duration(interval), sessions[ret.SessionID], &kvLock, kvs, sessions)
+			ns.KVs[key].SessionID = &ret.SessionID
+
+			startTimer(interval, ns.Sessions[ret.SessionID], &kvLock, ns, audit, stats, tracer, log)
+			logFields(r, "session", ret.SessionID)
+			audit.recordRequest(r, types.AuditActionAcquire, primitiveKV, key, ret.SessionID, "")
 
 			ret.Success = true
+			ret.Holds = 1
+			expiresAt := ns.Sessions[ret.SessionID].ExpiresAt.UTC()
+			ret.ExpiresAt = &expiresAt
+		} else {
+			stats.inc("distlock_lock_contention_total", "primitive", string(primitiveKV))
 		}
 
-		kvLock.Unlock()
+		unlockKV(r)
 		json.NewEncoder(w).Encode(ret)
 	})
 
-	router.Post("/kv/release/{key}/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+	router.With(authorize(primitiveKV, "key", rightLock), traceOperation(tracer, "kv.release", "key")).Post("/kv/release/{key}/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		w.Header().Set("Content-Type", "application/json")
 
 		key := chi.URLParam(r, "key")
 		sessionID := chi.URLParam(r, "sessionId")
 
-		kvLock.Lock()
+		lockKV(r)
 
 		ret := types.ReleaseReturn{
 			Success: false,
 		}
 
-		if v, ok := kvs[key]; ok {
-			if session, sessionOk := sessions[sessionID]; sessionOk && session.Key == key {
-				v.IsLocked = false
+		if v, ok := ns.KVs[key]; ok {
+			if session, sessionOk := ns.Sessions[sessionID]; sessionOk && session.holds(key) && session.Owner == identity(r) && v.SessionID != nil && *v.SessionID == sessionID {
+				if v.Holds > 1 {
+					v.Holds--
+					audit.recordRequest(r, types.AuditActionRelease, primitiveKV, key, sessionID, "holds "+strconv.FormatInt(v.Holds, 10))
+				} else {
+					v.unlock()
+					ns.signalReleased()
+					audit.recordRequest(r, types.AuditActionRelease, primitiveKV, key, sessionID, "")
+				}
 				ret.Success = true
+				ret.Holds = v.Holds
 			}
 		}
 
-		kvLock.Unlock()
+		unlockKV(r)
 		json.NewEncoder(w).Encode(ret)
 		return
 
 	})
 
-	router.Post("/mutex/lock/{key}", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	router.With(traceOperation(tracer, "kv.acquireall", "")).Post("/kv/acquireall/{duration}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		req := types.AcquireAllRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
 
-		key := chi.URLParam(r, "key")
-		timeoutStr := r.URL.Query().Get("timeout")
-		var timeout *time.Duration
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		if timeoutStr != "" {
-			interval, err := strconv.ParseInt(timeoutStr, 10, 64)
+		interval, err := parseTTL(chi.URLParam(r, "duration"), config)
 
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Keys) == 0 {
+			http.Error(w, "keys must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		// The keys are locked in sorted order, so the audit log and the
+		// session list the same order however the keys were passed.
+		keys := []string{}
+		seen := map[string]bool{}
+		for _, key := range req.Keys {
+			if !allowed(r, primitiveKV, key, rightLock) {
+				http.Error(w, "forbidden", http.StatusForbidden)
 				return
 			}
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
 
-			if interval <= 0 {
-				http.Error(w, "timeout must be >= 0", http.StatusBadRequest)
+		value, err := decodeValue(types.ValueKind(req.Kind), req.Value)
+		if err == nil && int64(value.size()) > config.MaxValueSize {
+			err = errValueTooLarge
+		}
+		if err != nil {
+			valueError(w, err)
+			return
+		}
+
+		var deadline <-chan time.Time
+
+		if req.Timeout != "" {
+			timeout, err := parseDuration(req.Timeout)
+
+			if err != nil {
+				http.Error(w, "timeout: "+err.Error(), http.StatusBadRequest)
 				return
 			}
 
-			t := time.Duration(interval)
+			if timeout <= 0 {
+				http.Error(w, "timeout must be > 0", http.StatusBadRequest)
+				return
+			}
 
-			timeout = &t
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			deadline = timer.C
 		}
 
-		var currentMutex chan struct{}
-
-		locksLock.Lock()
+		w.Header().Set("Content-Type", "application/json")
 
-		if m, ok := locks[key]; ok {
-			currentMutex = m
-		} else {
-			locks[key] = make(chan struct{}, 1)
-			currentMutex = locks[key]
+		ret := types.AcquireAllReturn{
+			SessionID: cuid.New(),
+			Success:   false,
 		}
 
-		locksLock.Unlock()
+		waitStart := time.Now()
+		span := startSpan(tracer, r, "kv.wait")
+		defer span.End()
 
-		if timeout == nil {
-			select {
-			case currentMutex <- struct{}{}:
-			}
-		} else {
-			select {
-			case currentMutex <- struct{}{}:
-			case <-time.After(*timeout):
+		var stopWaiting func()
+
+		for {
+			kvLock.Lock()
+
+			ret.Locked = nil
+			newKeys := 0
+			for _, key := range keys {
+				if v, ok := ns.KVs[key]; !ok {
+					newKeys++
+				} else if !v.lockable() {
+					// Waiting would never end, counters keep their mode.
+					kvLock.Unlock()
+					http.Error(w, key+": counter in "+string(v.Mode)+" mode cannot be locked", http.StatusConflict)
+					return
+				} else if v.IsLocked {
+					ret.Locked = append(ret.Locked, key)
+				}
 			}
-		}
 
-		ret := types.MutexReturn{
-			Success: true,
-		}
+			if len(ret.Locked) == 0 {
+				if err := ns.checkQuota(newKeys, int64(newKeys*value.size())); err != nil {
+					kvLock.Unlock()
+					quotaError(w, err)
+					return
+				}
+				if err := ns.checkSessionQuota(); err != nil {
+					kvLock.Unlock()
+					quotaError(w, err)
+					return
+				}
 
-		json.NewEncoder(w).Encode(ret)
-	})
+				s := &session{
+					ID:        ret.SessionID,
+					Key:       keys[0],
+					Keys:      keys,
+					Owner:     identity(r),
+					CreatedAt: time.Now(),
+					Trace:     trace.SpanContextFromContext(r.Context()),
+				}
+				ns.Sessions[s.ID] = s
 
-	router.Post("/mutex/unlock/{key}", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+				for _, key := range keys {
+					if _, ok := ns.KVs[key]; !ok {
+						ns.KVs[key] = &lockableValue{typedValue: value}
+					}
+					ns.KVs[key].IsLocked = true
+					ns.KVs[key].SessionID = &s.ID
+					ns.KVs[key].Reentrant = false
+					ns.KVs[key].Holds = 1
+					audit.recordRequest(r, types.AuditActionAcquire, primitiveKV, key, s.ID, "acquireall")
+				}
 
-		key := chi.URLParam(r, "key")
+				startTimer(interval, s, &kvLock, ns, audit, stats, tracer, log)
+				logFields(r, "session", s.ID, "keys", len(keys))
 
-		locksLock.Lock()
+				ret.Success = true
+				expiresAt := s.ExpiresAt.UTC()
+				ret.ExpiresAt = &expiresAt
 
-		if m, ok := locks[key]; ok {
-			if len(m) == 0 {
-				locksLock.Unlock()
-				http.Error(w, "can't unlock unlocked mutex", http.StatusBadRequest)
+				kvLock.Unlock()
+				stats.observe("distlock_lock_wait_seconds", time.Since(waitStart), "primitive", string(primitiveKV))
+				json.NewEncoder(w).Encode(ret)
 				return
-			} else {
-				<-m
+			}
 
-				locksLock.Unlock()
-				ret := types.MutexReturn{
-					Success: true,
-				}
+			released := ns.Released
+			kvLock.Unlock()
+
+			if stopWaiting == nil {
+				stats.inc("distlock_lock_contention_total", "primitive", string(primitiveKV))
+			}
+
+			if !req.Wait {
 				json.NewEncoder(w).Encode(ret)
 				return
 			}
-		}
 
-		locksLock.Unlock()
-		http.Error(w, "mutex does not exist", http.StatusBadRequest)
-		return
+			if stopWaiting == nil {
+				stopWaiting = waiters.wait(nil)
+				defer stopWaiting()
+			}
+
+			select {
+			case <-released:
+			case <-deadline:
+				span.SetAttribute("distlock.timed_out", "true")
+				json.NewEncoder(w).Encode(ret)
+				return
+			case <-r.Context().Done():
+				return
+			case <-ns.Deleted:
+				http.Error(w, "namespace deleted", http.StatusGone)
+				return
+			case <-shuttingDown:
+				shuttingDownError(w)
+				return
+			}
+		}
 	})
 
-	router.Post("/int/{key}", func(w http.ResponseWriter, r *http.Request) {
+	router.With(traceOperation(tracer, "kv.releaseall", "")).Post("/kv/releaseall/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		w.Header().Set("Content-Type", "application/json")
 
-		key := chi.URLParam(r, "key")
-		sessionId := r.URL.Query().Get("sessionId")
-		op := r.URL.Query().Get("op")
-		value := r.URL.Query().Get("value")
+		sessionID := chi.URLParam(r, "sessionId")
 
-		ret := types.IntReturn{
-			Success: false,
-			Op:      op,
+		ret := types.ReleaseAllReturn{
+			Success:  false,
+			Released: []string{},
 		}
 
 		kvLock.Lock()
 
-		if op != string(types.IntOpTypeGet) {
-			if v, ok := kvs[key]; ok {
-				if v.SessionID != nil && *v.SessionID != sessionId {
-					kvLock.Unlock()
-					json.NewEncoder(w).Encode(ret)
-					return
+		if s, ok := ns.Sessions[sessionID]; ok && s.Owner == identity(r) {
+			for _, key := range s.keys() {
+				if v, ok := ns.KVs[key]; ok && v.SessionID != nil && *v.SessionID == sessionID {
+					v.unlock()
+					ret.Released = append(ret.Released, key)
+					audit.recordRequest(r, types.AuditActionRelease, primitiveKV, key, sessionID, "releaseall")
 				}
 			}
+			expireSession(s, ns, audit, types.AuditActionDestroy)
+			ns.signalReleased()
+			ret.Success = true
 		}
 
-		if _, ok := kvs[key]; !ok {
-			kvs[key] = &lockableValue{
-				Value:    strconv.FormatInt(0, 10),
-				IsLocked: false,
-			}
-		}
-
-		switch op {
-		case string(types.IntOpTypeInc):
-			if kvs[key].Value == "" {
-				kvs[key].Value = "0"
+		kvLock.Unlock()
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(authorize(primitiveMutex, "key", rightLock), traceOperation(tracer, "mutex.lock", "key")).Post("/mutex/lock/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		key := chi.URLParam(r, "key")
+		timeoutStr := r.URL.Query().Get("timeout")
+		var timeout *time.Duration
+
+		if timeoutStr != "" {
+			t, err := parseDuration(timeoutStr)
+
+			if err != nil {
+				http.Error(w, "timeout: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if t <= 0 {
+				http.Error(w, "timeout must be > 0", http.StatusBadRequest)
+				return
+			}
+
+			timeout = &t
+		}
+
+		var currentMutex chan struct{}
+
+		locksLock.Lock()
+
+		if m, ok := ns.Locks[key]; ok {
+			currentMutex = m
+		} else {
+			ns.Locks[key] = make(chan struct{}, 1)
+			currentMutex = ns.Locks[key]
+		}
+
+		locksLock.Unlock()
+
+		ret := types.MutexReturn{
+			Success: true,
+		}
+
+		waitStart := time.Now()
+		span := startSpan(tracer, r, "mutex.wait")
+		defer span.End()
+
+		if len(currentMutex) > 0 {
+			stats.inc("distlock_lock_contention_total", "primitive", string(primitiveMutex))
+		}
+
+		locksLock.Lock()
+		ns.MutexWaiters[key]++
+		locksLock.Unlock()
+
+		stopWaiting := waiters.wait(func() {
+			locksLock.Lock()
+			ns.MutexWaiters[key]--
+			if ns.MutexWaiters[key] <= 0 {
+				delete(ns.MutexWaiters, key)
+			}
+			locksLock.Unlock()
+		})
+		defer stopWaiting()
+
+		if timeout == nil {
+			select {
+			case currentMutex <- struct{}{}:
+			case <-r.Context().Done():
+				return
+			case <-ns.Deleted:
+				http.Error(w, "namespace deleted", http.StatusGone)
+				return
+			case <-shuttingDown:
+				shuttingDownError(w)
+				return
+			}
+		} else {
+			select {
+			case currentMutex <- struct{}{}:
+			case <-time.After(*timeout):
+				ret.Success = false
+				stats.inc("distlock_mutex_timeouts_total")
+				span.SetAttribute("distlock.timed_out", "true")
+			case <-r.Context().Done():
+				return
+			case <-ns.Deleted:
+				http.Error(w, "namespace deleted", http.StatusGone)
+				return
+			case <-shuttingDown:
+				shuttingDownError(w)
+				return
+			}
+		}
+
+		stats.observe("distlock_lock_wait_seconds", time.Since(waitStart), "primitive", string(primitiveMutex))
+		stopWaiting()
+		span.End()
+
+		if ret.Success {
+			locksLock.Lock()
+			ns.MutexOwners[key] = identity(r)
+			locksLock.Unlock()
+			audit.recordRequest(r, types.AuditActionAcquire, primitiveMutex, key, "", "")
+		}
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(authorize(primitiveMutex, "key", rightLock), traceOperation(tracer, "mutex.unlock", "key")).Post("/mutex/unlock/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		key := chi.URLParam(r, "key")
+
+		locksLock.Lock()
+
+		if m, ok := ns.Locks[key]; ok {
+			if len(m) == 0 {
+				locksLock.Unlock()
+				http.Error(w, "can't unlock unlocked mutex", http.StatusBadRequest)
+				return
+			} else if ns.MutexOwners[key] != identity(r) {
+				locksLock.Unlock()
+				http.Error(w, "mutex is locked by someone else", http.StatusForbidden)
+				return
+			} else {
+				<-m
+				delete(ns.MutexOwners, key)
+				audit.recordRequest(r, types.AuditActionRelease, primitiveMutex, key, "", "")
+
+				locksLock.Unlock()
+				ret := types.MutexReturn{
+					Success: true,
+				}
+				json.NewEncoder(w).Encode(ret)
+				return
+			}
+		}
+
+		locksLock.Unlock()
+		http.Error(w, "mutex does not exist", http.StatusBadRequest)
+		return
+	})
+
+	router.With(traceOperation(tracer, "int", "key")).Post("/int/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		key := chi.URLParam(r, "key")
+		sessionId := query.Get("sessionId")
+		op := query.Get("op")
+
+		if op == string(types.IntOpTypeGet) && !allowed(r, primitiveInt, key, rightRead) ||
+			op != string(types.IntOpTypeGet) && !allowed(r, primitiveInt, key, rightWrite) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		mode := types.IntMode(query.Get("mode"))
+
+		ret := types.IntReturn{
+			Success: false,
+			Op:      op,
+		}
+
+		switch mode {
+		case "":
+			mode = types.IntModePublic
+		case types.IntModePublic, types.IntModeLock, types.IntModeSession:
+		default:
+			http.Error(w, "unknown mode: "+string(mode), http.StatusBadRequest)
+			return
+		}
+
+		params := map[string]*int64{}
+		for _, name := range []string{"value", "delta", "expected", "min", "max"} {
+			p, err := parseIntParam(query, name)
+			if err != nil {
+				http.Error(w, name+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			params[name] = p
+		}
+
+		if params["min"] != nil && params["max"] != nil && *params["min"] > *params["max"] {
+			http.Error(w, "min must be <= max", http.StatusBadRequest)
+			return
+		}
+
+		switch types.IntOpType(op) {
+		case types.IntOpTypeSet, types.IntOpTypeGetSet:
+			if params["value"] == nil {
+				http.Error(w, "value is required", http.StatusBadRequest)
+				return
+			}
+		case types.IntOpTypeAdd:
+			if params["delta"] == nil {
+				http.Error(w, "delta is required", http.StatusBadRequest)
+				return
+			}
+		case types.IntOpTypeCAS:
+			if params["value"] == nil || params["expected"] == nil {
+				http.Error(w, "value and expected are required", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var ttl *time.Duration
+		if ttlStr := query.Get("ttl"); ttlStr != "" {
+			t, err := parseTTL(ttlStr, config)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ttl = &t
+		}
+
+		lockKV(r)
+
+		if op == string(types.IntOpTypeCreate) {
+			if v, ok := ns.KVs[key]; ok {
+				ret.Mode = string(v.Mode)
+				unlockKV(r)
+				json.NewEncoder(w).Encode(ret)
+				return
+			}
+
+			v := &lockableValue{
+				IsLocked: false,
+				Mode:     mode,
+				Min:      params["min"],
+				Max:      params["max"],
+			}
+
+			if params["value"] != nil {
+				ret.Value = *params["value"]
+			}
+
+			if !v.inBounds(ret.Value) {
+				unlockKV(r)
+				http.Error(w, "value out of bounds", http.StatusBadRequest)
+				return
+			}
+
+			if mode == types.IntModeSession {
+				s, ok := ns.Sessions[sessionId]
+				if !ok {
+					unlockKV(r)
+					http.Error(w, "session does not exist", http.StatusBadRequest)
+					return
+				}
+				v.SessionID = &s.ID
+			}
+
+			v.typedValue = intValue(ret.Value)
+
+			if err := ns.checkQuota(1, int64(v.size())); err != nil {
+				unlockKV(r)
+				quotaError(w, err)
+				return
+			}
+
+			ns.KVs[key] = v
+
+			ret.Mode = string(mode)
+			ret.Success = true
+			audit.recordRequest(r, types.AuditActionSet, primitiveInt, key, sessionId, op)
+
+			unlockKV(r)
+			json.NewEncoder(w).Encode(ret)
+			return
+		}
+
+		if op != string(types.IntOpTypeGet) {
+			if v, ok := ns.KVs[key]; ok && !v.canMutate(sessionId) {
+				ret.Mode = string(v.Mode)
+				unlockKV(r)
+				json.NewEncoder(w).Encode(ret)
+				return
+			}
+		}
+
+		if _, ok := ns.KVs[key]; !ok {
+			if err := ns.checkQuota(1, int64(intValue(0).size())); err != nil {
+				unlockKV(r)
+				quotaError(w, err)
+				return
+			}
+			ns.KVs[key] = &lockableValue{
+				typedValue: intValue(0),
+				IsLocked:   false,
+				Mode:       types.IntModePublic,
+			}
+		}
+
+		v := ns.KVs[key]
+		ret.Mode = string(v.Mode)
+
+		currentValue, err := v.asInt()
+		if err != nil {
+			// set and reset overwrite whatever was stored before
+			if op != string(types.IntOpTypeSet) && op != string(types.IntOpTypeReset) {
+				unlockKV(r)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			currentValue = 0
+		}
+
+		ret.Previous = currentValue
+		ret.Value = currentValue
+		newValue := currentValue
+		store := true
+
+		switch types.IntOpType(op) {
+		case types.IntOpTypeInc:
+			newValue, err = addInt(currentValue, 1)
+		case types.IntOpTypeDec:
+			newValue, err = addInt(currentValue, -1)
+		case types.IntOpTypeAdd:
+			newValue, err = addInt(currentValue, *params["delta"])
+		case types.IntOpTypeSet, types.IntOpTypeGetSet:
+			newValue = *params["value"]
+		case types.IntOpTypeCAS:
+			if currentValue != *params["expected"] {
+				store = false
+			}
+			newValue = *params["value"]
+		case types.IntOpTypeReset:
+			newValue = 0
+			if params["value"] != nil {
+				newValue = *params["value"]
+			}
+		case types.IntOpTypeGet:
+			ret.Success = true
+			store = false
+		case types.IntOpTypeBounds:
+			// The stored value has to satisfy the new bounds.
+			if inLimits(currentValue, params["min"], params["max"]) {
+				v.Min = params["min"]
+				v.Max = params["max"]
+				ret.Success = true
+				audit.recordRequest(r, types.AuditActionSet, primitiveInt, key, sessionId, op)
+			}
+			store = false
+		default:
+			store = false
+		}
+
+		if err != nil {
+			unlockKV(r)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// min and max of other operations limit only this operation, the
+		// counter keeps its own bounds.
+		if store && v.inBounds(newValue) && inLimits(newValue, params["min"], params["max"]) {
+			v.typedValue = intValue(newValue)
+			ret.Value = newValue
+			ret.Success = true
+			audit.recordRequest(r, types.AuditActionSet, primitiveInt, key, sessionId, op)
+
+			if op == string(types.IntOpTypeReset) {
+				if v.Timer != nil {
+					v.Timer.Stop()
+					v.Timer = nil
+				}
+				if ttl != nil {
+					v.Timer = time.AfterFunc(*ttl, func() {
+						kvLock.Lock()
+						defer kvLock.Unlock()
+
+						if ns.KVs[key] == v {
+							delete(ns.KVs, key)
+							audit.record(types.AuditEntry{
+								Action:    types.AuditActionDelete,
+								Namespace: ns.Name,
+								Primitive: string(primitiveInt),
+								Key:       key,
+								Detail:    "ttl",
+							})
+							if v.IsLocked {
+								detachKey(v, key, ns, audit)
+								ns.signalReleased()
+							}
+						}
+					})
+				}
+			}
+		}
+
+		unlockKV(r)
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(authorize(primitiveKV, "key", rightWrite), traceOperation(tracer, "kv.set", "key")).Post("/kv/set/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		key := chi.URLParam(r, "key")
+		sessionId := r.URL.Query().Get("sessionId")
+		value, err := readValue(r, config.MaxValueSize)
+
+		if err != nil {
+			valueError(w, err)
+			return
+		}
+
+		lockKV(r)
+
+		ret := types.SetReturn{
+			Success: false,
+		}
+
+		if sessionId != "" {
+			if v, ok := ns.KVs[key]; ok && v.IsLocked && v.canMutate(sessionId) {
+				if err := ns.checkQuota(0, int64(value.size()-v.size())); err != nil {
+					unlockKV(r)
+					quotaError(w, err)
+					return
+				}
+				v.typedValue = value
+				ret.Success = true
+				audit.recordRequest(r, types.AuditActionSet, primitiveKV, key, sessionId, "")
+			}
+		} else {
+			if _, ok := ns.KVs[key]; !ok {
+				if err := ns.checkQuota(1, int64(value.size())); err != nil {
+					unlockKV(r)
+					quotaError(w, err)
+					return
+				}
+				ns.KVs[key] = &lockableValue{
+					typedValue: value,
+					IsLocked:   false,
+				}
+				ret.Success = true
+				audit.recordRequest(r, types.AuditActionSet, primitiveKV, key, "", "")
+			}
+		}
+
+		unlockKV(r)
+		json.NewEncoder(w).Encode(ret)
+		return
+	})
+
+	router.With(authorize(primitiveKV, "key", rightRead), traceOperation(tracer, "kv.get", "key")).Get("/kv/get/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		key := chi.URLParam(r, "key")
+
+		rlockKV(r)
+
+		if r.URL.Query().Get("raw") == "true" {
+			v, ok := ns.KVs[key]
+			if !ok {
+				runlockKV(r)
+				http.Error(w, "key does not exist", http.StatusNotFound)
+				return
+			}
+			data := v.raw()
+			kind := v.Kind
+			runlockKV(r)
+
+			w.Header().Set("Content-Type", contentTypeOfKind(kind))
+			w.Header().Set(types.HeaderValueKind, string(kind))
+			w.Write(data)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.GetReturn{
+			Success: false,
+		}
+
+		if path := r.URL.Query().Get("path"); path != "" {
+			segments, err := parseJSONPath(path)
+			if err != nil {
+				runlockKV(r)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			v, ok := ns.KVs[key]
+			if !ok || v.Kind != types.ValueKindJSON {
+				runlockKV(r)
+				json.NewEncoder(w).Encode(ret)
+				return
+			}
+
+			doc, err := unmarshalJSON(v.Data)
+			runlockKV(r)
+
+			if err == nil {
+				doc, err = selectJSONPath(doc, segments)
+			}
+
+			if err == nil {
+				data, marshalErr := json.Marshal(doc)
+				if marshalErr != nil {
+					http.Error(w, marshalErr.Error(), http.StatusInternalServerError)
+					return
+				}
+				ret.Success = true
+				ret.Key = key
+				ret.Value = string(data)
+				ret.Kind = string(types.ValueKindJSON)
+			}
+
+			json.NewEncoder(w).Encode(ret)
+			return
+		}
+
+		if v, ok := ns.KVs[key]; ok {
+			ret.Success = true
+			ret.Key = key
+			ret.Value = v.encode()
+			ret.Kind = string(v.Kind)
+			ret.Locked = v.IsLocked
+		}
+
+		runlockKV(r)
+		json.NewEncoder(w).Encode(ret)
+		return
+	})
+
+	router.With(authorize(primitiveKV, "key", rightWrite), traceOperation(tracer, "kv.patch", "key")).Post("/kv/patch/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		key := chi.URLParam(r, "key")
+		sessionID := r.URL.Query().Get("sessionId")
+
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || (contentType != contentTypeMergePatch && contentType != contentTypeJSONPatch) {
+			http.Error(w, "content type must be "+contentTypeMergePatch+" or "+contentTypeJSONPatch, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, config.MaxValueSize+1))
+		if err == nil && int64(len(body)) > config.MaxValueSize {
+			err = errValueTooLarge
+		}
+		if err != nil {
+			valueError(w, err)
+			return
+		}
+
+		var patch interface{}
+		var ops []types.JSONPatchOp
+
+		if contentType == contentTypeMergePatch {
+			patch, err = unmarshalJSON(body)
+		} else {
+			err = json.Unmarshal(body, &ops)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.PatchReturn{
+			Success: false,
+		}
+
+		kvLock.Lock()
+		defer kvLock.Unlock()
+
+		v, ok := ns.KVs[key]
+		if !ok || v.Kind != types.ValueKindJSON || !v.canMutate(sessionID) {
+			json.NewEncoder(w).Encode(ret)
+			return
+		}
+
+		doc, err := unmarshalJSON(v.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if contentType == contentTypeMergePatch {
+			doc = mergePatch(doc, patch)
+		} else {
+			doc, err = applyJSONPatch(doc, ops)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		}
+
+		data, err := json.Marshal(doc)
+		if err == nil && int64(len(data)) > config.MaxValueSize {
+			err = errValueTooLarge
+		}
+		if err != nil {
+			valueError(w, err)
+			return
+		}
+
+		if err := ns.checkQuota(0, int64(len(data)-len(v.Data))); err != nil {
+			quotaError(w, err)
+			return
+		}
+
+		v.Data = data
+		ret.Success = true
+		ret.Value = string(data)
+		audit.recordRequest(r, types.AuditActionSet, primitiveKV, key, sessionID, contentType)
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(traceOperation(tracer, "kv.getm", "")).Get("/kv/getm", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+
+		req := &types.GetMRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, key := range req.Keys {
+			if !allowed(r, primitiveKV, key, rightRead) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.GetMReturn{
+			Entries: make([]types.KeyValueSuccess, len(req.Keys)),
+		}
+
+		kvLock.RLock()
+
+		for idx, key := range req.Keys {
+			v, ok := ns.KVs[key]
+			if ok {
+				ret.Entries[idx].Success = true
+				ret.Entries[idx].Value = v.encode()
+				ret.Entries[idx].Kind = string(v.Kind)
+			}
+			ret.Entries[idx].Key = key
+		}
+
+		kvLock.RUnlock()
+
+		json.NewEncoder(w).Encode(ret)
+		return
+	})
+
+	router.With(authorize(primitiveKV, "key", rightWrite), traceOperation(tracer, "kv.delete", "key")).Post("/kv/delete/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		key := chi.URLParam(r, "key")
+		sessionID := r.URL.Query().Get("sessionId")
+
+		ret := types.DeleteReturn{
+			Success: false,
+		}
+
+		lockKV(r)
+
+		if v, ok := ns.KVs[key]; ok && v.IsLocked && inAtomicBatch(r) {
+			// deleting a locked key may end its session, which a failed
+			// batch cannot undo
+			unlockKV(r)
+			http.Error(w, "locked keys cannot be deleted in atomic batches", http.StatusBadRequest)
+			return
+		}
+
+		if v, ok := ns.KVs[key]; ok && v.canMutate(sessionID) {
+			if v.Timer != nil {
+				v.Timer.Stop()
+			}
+			delete(ns.KVs, key)
+			audit.recordRequest(r, types.AuditActionDelete, primitiveKV, key, sessionID, "")
+			if v.IsLocked {
+				detachKey(v, key, ns, audit)
+				ns.signalReleased()
+			}
+			ret.Success = true
+		}
+
+		unlockKV(r)
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(traceOperation(tracer, "kv.setm", "")).Post("/kv/setm", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		req := &types.SetMRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		sessionID := r.URL.Query().Get("sessionId")
+
+		ret := types.SetMReturn{
+			Success: false,
+		}
+
+		values := make([]typedValue, len(req.Entries))
+		for idx, entry := range req.Entries {
+			if !allowed(r, primitiveKV, entry.Key, rightWrite) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			values[idx], err = decodeValue(types.ValueKind(entry.Kind), entry.Value)
+			if err == nil && int64(values[idx].size()) > config.MaxValueSize {
+				err = errValueTooLarge
+			}
+			if err != nil {
+				valueError(w, err)
+				return
+			}
+		}
+
+		kvLock.Lock()
+
+		for _, entry := range req.Entries {
+			if v, ok := ns.KVs[entry.Key]; ok && !v.canMutate(sessionID) {
+				kvLock.Unlock()
+				json.NewEncoder(w).Encode(ret)
+				return
+			}
+		}
+
+		newKeys := map[string]bool{}
+		var grow int64
+		for idx, entry := range req.Entries {
+			if v, ok := ns.KVs[entry.Key]; ok && !newKeys[entry.Key] {
+				grow -= int64(v.size())
+			} else {
+				newKeys[entry.Key] = true
+			}
+			grow += int64(values[idx].size())
+		}
+
+		if err := ns.checkQuota(len(newKeys), grow); err != nil {
+			kvLock.Unlock()
+			quotaError(w, err)
+			return
+		}
+
+		// Existing keys keep their lock and counter settings, only the value
+		// changes.
+		for idx, entry := range req.Entries {
+			if v, ok := ns.KVs[entry.Key]; ok {
+				v.typedValue = values[idx]
+			} else {
+				ns.KVs[entry.Key] = &lockableValue{typedValue: values[idx], IsLocked: false}
 			}
-			currentValue, err := strconv.ParseInt(kvs[key].Value, 10, 64)
+			audit.recordRequest(r, types.AuditActionSet, primitiveKV, entry.Key, sessionID, "setm")
+		}
+
+		kvLock.Unlock()
+
+		ret.Success = true
+
+		json.NewEncoder(w).Encode(ret)
+		return
+	})
+
+	router.With(traceOperation(tracer, "batch", "")).Post("/batch", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		req := types.BatchRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Ops) > maxBatchOps {
+			http.Error(w, "a batch has at most "+strconv.Itoa(maxBatchOps)+" operations", http.StatusBadRequest)
+			return
+		}
+
+		var ret types.BatchReturn
+
+		if req.Atomic {
+			kvLock.Lock()
+
+			snapshot := snapshotBatch(ns, req.Ops)
+			ret = runBatch(router, r, req)
+
+			if !ret.Success {
+				snapshot.restore(ns, func(s *session, ttl time.Duration) {
+					startTimer(ttl, s, &kvLock, ns, audit, stats, tracer, log)
+				}, audit)
+				ret.RolledBack = true
+			}
+
+			kvLock.Unlock()
+		} else {
+			ret = runBatch(router, r, req)
+		}
+
+		logFields(r, "ops", len(req.Ops))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(authorize(primitiveQueue, "queue", rightWrite), traceOperation(tracer, "queue.push", "queue")).Post("/queue/push/{queue}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		name := chi.URLParam(r, "queue")
+		value, err := readValue(r, config.MaxValueSize)
+
+		if err != nil {
+			valueError(w, err)
+			return
+		}
+
+		ret := types.QueuePushReturn{
+			ID:      cuid.New(),
+			Success: true,
+		}
+
+		kvLock.Lock()
+
+		if err := ns.checkQuota(0, int64(value.size())); err != nil {
+			kvLock.Unlock()
+			quotaError(w, err)
+			return
+		}
+
+		if _, ok := ns.Queues[name]; !ok {
+			ns.Queues[name] = newQueue()
+		}
+
+		q := ns.Queues[name]
+		q.Pending = append(q.Pending, &queueItem{
+			ID:    ret.ID,
+			Value: value,
+		})
+		q.signal()
+
+		kvLock.Unlock()
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(authorize(primitiveQueue, "queue", rightWrite), traceOperation(tracer, "queue.pop", "queue")).Post("/queue/pop/{queue}/{duration}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		name := chi.URLParam(r, "queue")
+		duration := chi.URLParam(r, "duration")
+		sessionID := r.URL.Query().Get("sessionId")
+		timeoutStr := r.URL.Query().Get("timeout")
+
+		interval, err := parseTTL(duration, config)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var deadline <-chan time.Time
+		wait := true
+
+		if timeoutStr != "" {
+			timeout, err := parseDuration(timeoutStr)
+
 			if err != nil {
+				http.Error(w, "timeout: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if timeout < 0 {
+				http.Error(w, "timeout must be >= 0", http.StatusBadRequest)
+				return
+			}
+
+			if timeout == 0 {
+				wait = false
+			} else {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+		}
+
+		ret := types.QueuePopReturn{
+			Success: false,
+		}
+
+		waitStart := time.Now()
+		span := startSpan(tracer, r, "queue.wait")
+		defer span.End()
+
+		var stopWaiting func()
+
+		for {
+			kvLock.Lock()
+
+			if sessionID != "" {
+				if _, ok := ns.Sessions[sessionID]; !ok {
+					kvLock.Unlock()
+					json.NewEncoder(w).Encode(ret)
+					return
+				}
+			}
+
+			if _, ok := ns.Queues[name]; !ok {
+				ns.Queues[name] = newQueue()
+			}
+
+			q := ns.Queues[name]
+
+			if len(q.Pending) > 0 {
+				item := q.Pending[0]
+				q.Pending = q.Pending[1:]
+				q.Leased[item.ID] = item
+				item.Receipt = cuid.New()
+
+				if sessionID != "" {
+					item.SessionID = &sessionID
+				}
+
+				startLeaseTimer(interval, q, item, &kvLock)
+				expiresAt := time.Now().Add(interval).UTC()
+
+				stats.observe("distlock_lock_wait_seconds", time.Since(waitStart), "primitive", string(primitiveQueue))
+
+				ret.Success = true
+				ret.ID = item.ID
+				ret.Receipt = item.Receipt
+				ret.Value = item.Value.encode()
+				ret.Kind = string(item.Value.Kind)
+				ret.LeaseExpiresAt = &expiresAt
+
 				kvLock.Unlock()
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				json.NewEncoder(w).Encode(ret)
 				return
 			}
-			currentValue++
-			ret.Value = currentValue
-			ret.Success = true
-			kvs[key].Value = strconv.FormatInt(currentValue, 10)
-		case string(types.IntOpTypeDec):
-			if kvs[key].Value == "" {
-				kvs[key].Value = "0"
-			}
-			currentValue, err := strconv.ParseInt(kvs[key].Value, 10, 64)
-			if err != nil {
-				kvLock.Unlock()
-				http.Error(w, err.Error(), http.StatusBadRequest)
+
+			notify := q.Notify
+			kvLock.Unlock()
+
+			if !wait {
+				json.NewEncoder(w).Encode(ret)
 				return
 			}
-			currentValue--
-			ret.Success = true
-			ret.Value = currentValue
-			kvs[key].Value = strconv.FormatInt(currentValue, 10)
-		case string(types.IntOpTypeGet):
-			if kvs[key].Value == "" {
-				kvs[key].Value = "0"
+
+			if stopWaiting == nil {
+				stopWaiting = waiters.wait(nil)
+				defer stopWaiting()
 			}
-			currentValue, err := strconv.ParseInt(kvs[key].Value, 10, 64)
-			if err != nil {
-				kvLock.Unlock()
-				http.Error(w, err.Error(), http.StatusBadRequest)
+
+			select {
+			case <-notify:
+			case <-deadline:
+				stats.observe("distlock_lock_wait_seconds", time.Since(waitStart), "primitive", string(primitiveQueue))
+				json.NewEncoder(w).Encode(ret)
 				return
-			}
-			ret.Success = true
-			ret.Value = currentValue
-		case string(types.IntOpTypeSet):
-			currentValue, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				kvLock.Unlock()
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			case <-r.Context().Done():
+				return
+			case <-ns.Deleted:
+				http.Error(w, "namespace deleted", http.StatusGone)
+				return
+			case <-shuttingDown:
+				shuttingDownError(w)
 				return
 			}
-			ret.Value = currentValue
-			ret.Success = true
-			kvs[key].Value = strconv.FormatInt(currentValue, 10)
+		}
+	})
+
+	router.With(authorize(primitiveQueue, "queue", rightWrite), traceOperation(tracer, "queue.ack", "queue")).Post("/queue/ack/{queue}/{itemId}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		name := chi.URLParam(r, "queue")
+		itemID := chi.URLParam(r, "itemId")
+		receipt := r.URL.Query().Get("receipt")
+
+		if receipt == "" {
+			http.Error(w, "receipt is required", http.StatusBadRequest)
+			return
+		}
+
+		ret := types.QueueAckReturn{
+			Success: false,
+		}
+
+		kvLock.Lock()
+
+		if q, ok := ns.Queues[name]; ok {
+			if item, itemOk := q.leased(itemID, receipt); itemOk {
+				if item.Timer != nil {
+					item.Timer.Stop()
+				}
+				delete(q.Leased, itemID)
+				ret.Success = true
+			}
 		}
 
 		kvLock.Unlock()
 		json.NewEncoder(w).Encode(ret)
 	})
 
-	router.Post("/kv/set/{key}", func(w http.ResponseWriter, r *http.Request) {
+	router.With(authorize(primitiveQueue, "queue", rightWrite), traceOperation(tracer, "queue.nack", "queue")).Post("/queue/nack/{queue}/{itemId}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		w.Header().Set("Content-Type", "application/json")
 
-		key := chi.URLParam(r, "key")
-		sessionId := r.URL.Query().Get("sessionId")
-		value := r.URL.Query().Get("value")
+		name := chi.URLParam(r, "queue")
+		itemID := chi.URLParam(r, "itemId")
+		receipt := r.URL.Query().Get("receipt")
 
-		kvLock.Lock()
+		if receipt == "" {
+			http.Error(w, "receipt is required", http.StatusBadRequest)
+			return
+		}
 
-		ret := types.SetReturn{
+		ret := types.QueueAckReturn{
 			Success: false,
 		}
 
-		if sessionId != "" {
-			if session, sessionOk := sessions[sessionId]; sessionOk && session.Key == key {
-				kvs[key].Value = value
-				ret.Success = true
-			}
-		} else {
-			if _, ok := kvs[key]; !ok {
-				kvs[key] = &lockableValue{
-					Value:    value,
-					IsLocked: false,
-				}
+		kvLock.Lock()
+
+		if q, ok := ns.Queues[name]; ok {
+			if item, itemOk := q.leased(itemID, receipt); itemOk {
+				q.requeue(item)
 				ret.Success = true
 			}
 		}
 
 		kvLock.Unlock()
 		json.NewEncoder(w).Encode(ret)
-		return
 	})
 
-	router.Get("/kv/get/{key}", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	router.Get("/audit/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 
 		key := chi.URLParam(r, "key")
+		only := primitive(r.URL.Query().Get("primitive"))
+
+		limit := 100
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 {
+				http.Error(w, "limit must be > 0", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.AuditReturn{
+			Entries: audit.query(ns.Name, key, limit, func(p primitive) bool {
+				return (only == "" || p == only) && allowed(r, p, key, rightRead)
+			}),
+		})
+	})
+
+	router.With(requireAdmin).Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		gauges := map[string]map[string]float64{
+			"distlock_keys":         {},
+			"distlock_value_bytes":  {},
+			"distlock_sessions":     {},
+			"distlock_locks_held":   {},
+			"distlock_mutexes_held": {},
+			"distlock_queue_items":  {},
+			"distlock_queue_leased": {},
+		}
 
+		namespaces.lock.RLock()
 		kvLock.RLock()
+		locksLock.Lock()
 
-		ret := types.GetReturn{
+		for _, ns := range namespaces.namespaces {
+			nsLabels := labels("namespace", ns.Name)
+			counts := ns.counts()
+
+			gauges["distlock_keys"][nsLabels] = float64(len(ns.KVs))
+			gauges["distlock_value_bytes"][nsLabels] = float64(ns.valueBytes())
+			gauges["distlock_sessions"][nsLabels] = float64(len(ns.Sessions))
+			gauges["distlock_locks_held"][nsLabels] = float64(counts.locksHeld)
+			gauges["distlock_mutexes_held"][nsLabels] = float64(counts.mutexesHeld)
+			gauges["distlock_queue_items"][nsLabels] = float64(counts.queueItems)
+			gauges["distlock_queue_leased"][nsLabels] = float64(counts.queueLeased)
+		}
+
+		locksLock.Unlock()
+		kvLock.RUnlock()
+		namespaces.lock.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		stats.write(w, gauges, map[string]string{
+			"distlock_keys":         "Keys stored per namespace.",
+			"distlock_value_bytes":  "Bytes of stored values and queue items per namespace.",
+			"distlock_sessions":     "Live sessions per namespace.",
+			"distlock_locks_held":   "Keys currently locked per namespace.",
+			"distlock_mutexes_held": "Mutexes currently locked per namespace.",
+			"distlock_queue_items":  "Queue items waiting to be popped per namespace.",
+			"distlock_queue_leased": "Queue items popped but not yet acked per namespace.",
+		})
+	})
+
+	router.With(requireAdmin).Get("/admin/namespaces", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.NamespacesReturn{
+			Namespaces: []types.NamespaceInfo{},
+		}
+
+		namespaces.lock.RLock()
+		kvLock.RLock()
+
+		for _, ns := range namespaces.namespaces {
+			ret.Namespaces = append(ret.Namespaces, ns.info())
+		}
+
+		kvLock.RUnlock()
+		namespaces.lock.RUnlock()
+
+		sort.Slice(ret.Namespaces, func(i, j int) bool {
+			return ret.Namespaces[i].Name < ret.Namespaces[j].Name
+		})
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(requireAdmin).Post("/admin/namespaces/{namespace}", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "namespace")
+
+		quota := types.NamespaceQuota{}
+		if r.ContentLength != 0 {
+			err := json.NewDecoder(r.Body).Decode(&quota)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		namespaces.lock.Lock()
+		kvLock.Lock()
+
+		ns, ok := namespaces.namespaces[name]
+		if ok {
+			ns.Quota = quota
+		} else {
+			ns = newNamespace(name, quota)
+			namespaces.namespaces[name] = ns
+		}
+
+		ret := types.NamespaceReturn{
+			Success:   true,
+			Namespace: ns.info(),
+		}
+
+		kvLock.Unlock()
+		namespaces.lock.Unlock()
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(requireAdmin).Delete("/admin/namespaces/{namespace}", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "namespace")
+
+		if name == defaultNamespace {
+			http.Error(w, "the default namespace can't be deleted", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.NamespaceReturn{
 			Success: false,
 		}
 
-		if v, ok := kvs[key]; ok {
+		namespaces.lock.Lock()
+		kvLock.Lock()
+
+		if ns, ok := namespaces.namespaces[name]; ok {
+			delete(namespaces.namespaces, name)
+			ns.clear()
 			ret.Success = true
-			ret.Key = key
-			ret.Value = v.Value
+			ret.Namespace = ns.info()
+		}
+
+		kvLock.Unlock()
+		namespaces.lock.Unlock()
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(requireAdmin).Get("/admin/sessions", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.SessionsReturn{
+			Sessions: []types.SessionInfo{},
+		}
+
+		now := time.Now()
+
+		kvLock.RLock()
+
+		for _, s := range ns.Sessions {
+			remaining := s.ExpiresAt.Sub(now)
+			if remaining < 0 {
+				remaining = 0
+			}
+			ret.Sessions = append(ret.Sessions, types.SessionInfo{
+				ID:           s.ID,
+				Key:          s.Key,
+				Keys:         s.Keys,
+				Owner:        s.Owner,
+				CreatedAt:    s.CreatedAt.UTC(),
+				ExpiresAt:    s.ExpiresAt.UTC(),
+				TTLRemaining: remaining,
+			})
 		}
 
 		kvLock.RUnlock()
+
+		sort.Slice(ret.Sessions, func(i, j int) bool {
+			return ret.Sessions[i].CreatedAt.Before(ret.Sessions[j].CreatedAt)
+		})
+
 		json.NewEncoder(w).Encode(ret)
-		return
 	})
 
-	router.Get("/kv/getm", func(w http.ResponseWriter, r *http.Request) {
+	router.With(requireAdmin).Delete("/admin/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
+
+		sessionID := chi.URLParam(r, "sessionId")
 
-		req := &types.GetMRequest{}
-		err := json.NewDecoder(r.Body).Decode(&req)
+		ret := types.AdminReturn{
+			Success: false,
+		}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		kvLock.Lock()
+
+		if session, ok := ns.Sessions[sessionID]; ok {
+			expireSession(session, ns, audit, types.AuditActionForceExpire)
+			log.warn("session force-expired", "namespace", ns.Name, "key", session.Key, "session", session.ID, "owner", session.Owner, "admin", identity(r))
+			ret.Success = true
 		}
 
+		kvLock.Unlock()
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(requireAdmin).Get("/admin/locks", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		w.Header().Set("Content-Type", "application/json")
 
-		ret := types.GetMReturn{
-			Entries: make([]types.KeyValueSuccess, len(req.Keys)),
+		ret := types.LocksReturn{
+			Locks: []types.LockInfo{},
 		}
 
 		kvLock.RLock()
+		locksLock.Lock()
 
-		for idx, key := range req.Keys {
-			v, ok := kvs[key]
-			if ok {
-				ret.Entries[idx].Success = true
-				ret.Entries[idx].Value = v.Value
+		for key, v := range ns.KVs {
+			if !v.IsLocked {
+				continue
 			}
-			ret.Entries[idx].Key = key
+			info := types.LockInfo{
+				Primitive: string(primitiveKV),
+				Key:       key,
+				Reentrant: v.Reentrant,
+				Holds:     v.Holds,
+			}
+			if v.SessionID != nil {
+				info.SessionID = *v.SessionID
+				if s, ok := ns.Sessions[*v.SessionID]; ok {
+					info.Owner = s.Owner
+				}
+			}
+			ret.Locks = append(ret.Locks, info)
+		}
+
+		for key, m := range ns.Locks {
+			if len(m) == 0 && ns.MutexWaiters[key] == 0 {
+				continue
+			}
+			ret.Locks = append(ret.Locks, types.LockInfo{
+				Primitive: string(primitiveMutex),
+				Key:       key,
+				Owner:     ns.MutexOwners[key],
+				Waiters:   ns.MutexWaiters[key],
+			})
 		}
 
+		locksLock.Unlock()
 		kvLock.RUnlock()
 
+		sort.Slice(ret.Locks, func(i, j int) bool {
+			if ret.Locks[i].Primitive != ret.Locks[j].Primitive {
+				return ret.Locks[i].Primitive < ret.Locks[j].Primitive
+			}
+			return ret.Locks[i].Key < ret.Locks[j].Key
+		})
+
 		json.NewEncoder(w).Encode(ret)
-		return
 	})
 
-	router.Post("/kv/setm", func(w http.ResponseWriter, r *http.Request) {
-		req := &types.SetMRequest{}
-		err := json.NewDecoder(r.Body).Decode(&req)
+	router.With(requireAdmin).Delete("/admin/locks/kv/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+		w.Header().Set("Content-Type", "application/json")
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		key := chi.URLParam(r, "key")
+
+		ret := types.AdminReturn{
+			Success: false,
+		}
+
+		kvLock.Lock()
+
+		if v, ok := ns.KVs[key]; ok && v.IsLocked {
+			sessionID := ""
+			if v.SessionID != nil {
+				sessionID = *v.SessionID
+			}
+			v.unlock()
+			ns.signalReleased()
+			audit.recordRequest(r, types.AuditActionForceRelease, primitiveKV, key, sessionID, "")
+			log.warn("lock force-released", "namespace", ns.Name, "key", key, "session", sessionID, "admin", identity(r))
+			ret.Success = true
 		}
 
+		kvLock.Unlock()
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(requireAdmin).Delete("/admin/locks/mutex/{key}", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
 		w.Header().Set("Content-Type", "application/json")
 
-		sessionID := r.URL.Query().Get("sessionId")
+		key := chi.URLParam(r, "key")
 
-		ret := types.SetMReturn{
+		ret := types.AdminReturn{
 			Success: false,
 		}
 
+		locksLock.Lock()
+
+		if m, ok := ns.Locks[key]; ok && len(m) > 0 {
+			<-m
+			owner := ns.MutexOwners[key]
+			delete(ns.MutexOwners, key)
+			audit.recordRequest(r, types.AuditActionForceRelease, primitiveMutex, key, "", owner)
+			log.warn("mutex force-released", "namespace", ns.Name, "key", key, "owner", owner, "admin", identity(r))
+			ret.Success = true
+		}
+
+		locksLock.Unlock()
+
+		json.NewEncoder(w).Encode(ret)
+	})
+
+	router.With(requireAdmin).Delete("/admin/keys", func(w http.ResponseWriter, r *http.Request) {
+		ns := requestNamespace(r)
+
+		prefix := r.URL.Query().Get("prefix")
+		if prefix == "" {
+			http.Error(w, "prefix is required", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		ret := types.PurgeReturn{
+			Success: true,
+		}
+
 		kvLock.Lock()
 
-		for _, entry := range req.Entries {
-			if v, ok := kvs[entry.Key]; ok {
-				if v.IsLocked {
-					if sessionID == "" || (v.SessionID != nil && *v.SessionID != sessionID) {
-						kvLock.Unlock()
-						json.NewEncoder(w).Encode(ret)
-						return
-					}
-				}
+		for key, v := range ns.KVs {
+			if !strings.HasPrefix(key, prefix) {
+				continue
 			}
+			if v.Timer != nil {
+				v.Timer.Stop()
+			}
+			delete(ns.KVs, key)
+			audit.recordRequest(r, types.AuditActionDelete, primitiveKV, key, "", "purge "+prefix)
+			if v.IsLocked {
+				detachKey(v, key, ns, audit)
+			}
+			ret.Deleted++
 		}
 
-		for _, entry := range req.Entries {
-			kvs[entry.Key] = &lockableValue{Value: entry.Value, IsLocked: false}
+		if ret.Deleted > 0 {
+			ns.signalReleased()
 		}
 
 		kvLock.Unlock()
 
-		ret.Success = true
+		log.warn("keys purged", "namespace", ns.Name, "prefix", prefix, "deleted", ret.Deleted, "admin", identity(r))
 
 		json.NewEncoder(w).Encode(ret)
-		return
 	})
 
-	err := http.ListenAndServe(":9876", router)
+	mountV1(router)
+	root.Mount("/", router)
+
+	return &server{
+		handler:      root,
+		namespaces:   namespaces,
+		log:          log,
+		audit:        audit,
+		tracer:       tracer,
+		auth:         tokens != nil,
+		shuttingDown: shuttingDown,
+	}
+}
+
+func Start(config Config) {
+	s := newServer(config)
+	log := s.log
+
+	tlsConfig, err := serverTLSConfig(config)
 	if err != nil {
 		panic(err)
 	}
+
+	server := &http.Server{
+		Addr:      config.Address(),
+		Handler:   s.handler,
+		TLSConfig: tlsConfig,
+	}
+
+	if config.RESPListen != "" {
+		listener, err := net.Listen("tcp", config.RESPListen)
+		if err != nil {
+			panic(err)
+		}
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		log.info("serving redis protocol", "addr", config.RESPListen)
+		go serveRESP(listener, s.handler, config.MaxValueSize, s.shuttingDown, log)
+	}
+
+	shutdownTimeout := config.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+
+	var grpcStopped <-chan struct{}
+	if config.GRPCListen != "" {
+		listener, err := net.Listen("tcp", config.GRPCListen)
+		if err != nil {
+			panic(err)
+		}
+		log.info("serving grpc", "addr", config.GRPCListen)
+		grpcStopped = serveGRPC(newGRPCServer(s, tlsConfig), listener, s.shuttingDown, shutdownTimeout, log)
+	}
+
+	stopped := handleSignals(server, shutdownTimeout, s.shuttingDown, log)
+
+	log.info("listening", "addr", server.Addr, "tls", tlsConfig != nil, "auth", s.auth)
+
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.error("server failed", "error", err)
+		os.Exit(1)
+	}
+
+	<-stopped
+	if grpcStopped != nil {
+		<-grpcStopped
+	}
+
+	// All state is kept in memory, there is no persistence to flush. The
+	// audit log and trace exporter are flushed so no records are lost.
+	if err := s.audit.close(); err != nil {
+		log.error("closing audit log failed", "error", err)
+	}
+	s.tracer.Shutdown()
+
+	log.info("stopped")
 }
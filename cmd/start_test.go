@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func newTestServer(t *testing.T, config Config) *httptest.Server {
+	t.Helper()
+
+	config.LogLevel = "error"
+	ts := httptest.NewServer(newServer(config).handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// call sends a request and decodes the JSON response into out if it is
+// not nil. It returns the status code.
+func call(t *testing.T, ts *httptest.Server, method string, path string, body string, out interface{}) int {
+	t.Helper()
+	return callAs(t, ts, "", method, path, body, out)
+}
+
+// callAs is call authenticated with token.
+func callAs(t *testing.T, ts *httptest.Server, token string, method string, path string, body string, out interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, data)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+func acquire(t *testing.T, ts *httptest.Server, key string) string {
+	t.Helper()
+
+	ret := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/"+key+"/10s", "", &ret)
+	if !ret.Success {
+		t.Fatalf("acquiring %s failed", key)
+	}
+	return ret.SessionID
+}
+
+func TestSetAfterDeleteBySession(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	sessionID := acquire(t, ts, "k")
+
+	del := types.DeleteReturn{}
+	call(t, ts, http.MethodPost, "/kv/delete/k?sessionId="+sessionID, "", &del)
+	if !del.Success {
+		t.Fatal("holder could not delete its key")
+	}
+
+	set := types.SetReturn{}
+	if status := call(t, ts, http.MethodPost, "/kv/set/k?value=v&sessionId="+sessionID, "", &set); status != http.StatusOK || set.Success {
+		t.Fatalf("set of a deleted key succeeded: %d %+v", status, set)
+	}
+
+	sessions := types.SessionsReturn{}
+	call(t, ts, http.MethodGet, "/admin/sessions", "", &sessions)
+	if len(sessions.Sessions) != 0 {
+		t.Fatalf("session outlived its key: %+v", sessions.Sessions)
+	}
+
+	if status := call(t, ts, http.MethodGet, "/status", "", nil); status != http.StatusOK {
+		t.Fatalf("status returned %d", status)
+	}
+}
+
+func TestPurgeEndsSessions(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	sessionID := acquire(t, ts, "p-1")
+
+	call(t, ts, http.MethodDelete, "/admin/keys?prefix=p-", "", nil)
+
+	set := types.SetReturn{}
+	call(t, ts, http.MethodPost, "/kv/set/p-1?value=v&sessionId="+sessionID, "", &set)
+	if set.Success {
+		t.Fatal("set of a purged key succeeded")
+	}
+
+	renew := types.RenewReturn{}
+	call(t, ts, http.MethodPost, "/session/renew/"+sessionID+"/10s", "", &renew)
+	if renew.Success {
+		t.Fatal("session of a purged key is still alive")
+	}
+}
+
+func TestSetRequiresCurrentHolder(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	first := acquire(t, ts, "k")
+	call(t, ts, http.MethodPost, "/kv/release/k/"+first, "", nil)
+	second := acquire(t, ts, "k")
+
+	set := types.SetReturn{}
+	call(t, ts, http.MethodPost, "/kv/set/k?value=old&sessionId="+first, "", &set)
+	if set.Success {
+		t.Fatal("released session overwrote the value")
+	}
+
+	call(t, ts, http.MethodPost, "/kv/set/k?value=new&sessionId="+second, "", &set)
+	if !set.Success {
+		t.Fatal("holder could not set the value")
+	}
+}
+
+func TestSetMKeepsLocks(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	sessionID := acquire(t, ts, "k")
+
+	setm := types.SetMReturn{}
+	call(t, ts, http.MethodPost, "/kv/setm?sessionId="+sessionID, `{"entries":[{"key":"k","value":"v"}]}`, &setm)
+	if !setm.Success {
+		t.Fatal("holder could not set the value")
+	}
+
+	other := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquire/k/10s", "", &other)
+	if other.Success {
+		t.Fatal("setm released the lock")
+	}
+
+	create := types.IntReturn{}
+	call(t, ts, http.MethodPost, "/int/c?op=create&mode=lock", "", &create)
+	counterSession := acquire(t, ts, "c")
+	call(t, ts, http.MethodPost, "/kv/setm?sessionId="+counterSession, `{"entries":[{"key":"c","value":"5","kind":"int"}]}`, &setm)
+
+	inc := types.IntReturn{}
+	call(t, ts, http.MethodPost, "/int/c?op=inc", "", &inc)
+	if inc.Success || inc.Mode != string(types.IntModeLock) {
+		t.Fatalf("setm changed the counter mode: %+v", inc)
+	}
+}
+
+func TestAcquireAllRefusesCounters(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	call(t, ts, http.MethodPost, "/int/c?op=create&mode=public", "", nil)
+
+	ret := types.AcquireAllReturn{}
+	if status := call(t, ts, http.MethodPost, "/kv/acquireall/10s", `{"keys":["a","c"],"wait":true}`, &ret); status != http.StatusConflict {
+		t.Fatalf("acquireall of a public counter returned %d", status)
+	}
+
+	sessions := types.SessionsReturn{}
+	call(t, ts, http.MethodGet, "/admin/sessions", "", &sessions)
+	if len(sessions.Sessions) != 0 {
+		t.Fatalf("failed acquireall left a session: %+v", sessions.Sessions)
+	}
+}
+
+func TestIntBounds(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	ret := types.IntReturn{}
+	call(t, ts, http.MethodPost, "/int/c?op=create&max=1", "", &ret)
+
+	// a looser limit on inc does not widen the stored bounds
+	call(t, ts, http.MethodPost, "/int/c?op=inc&max=5", "", &ret)
+	call(t, ts, http.MethodPost, "/int/c?op=inc&max=5", "", &ret)
+	if ret.Success || ret.Value != 1 {
+		t.Fatalf("inc passed the stored max: %+v", ret)
+	}
+
+	call(t, ts, http.MethodPost, "/int/c?op=add&delta=-1&min=5", "", &ret)
+	if ret.Success {
+		t.Fatalf("add ignored its own min: %+v", ret)
+	}
+	call(t, ts, http.MethodPost, "/int/c?op=dec", "", &ret)
+	if !ret.Success || ret.Value != 0 {
+		t.Fatalf("add stored its min: %+v", ret)
+	}
+
+	call(t, ts, http.MethodPost, "/int/c?op=bounds&min=1", "", &ret)
+	if ret.Success {
+		t.Fatal("bounds accepted a min above the current value")
+	}
+	call(t, ts, http.MethodPost, "/int/c?op=bounds&min=0&max=3", "", &ret)
+	if !ret.Success {
+		t.Fatal("bounds failed")
+	}
+	call(t, ts, http.MethodPost, "/int/c?op=set&value=3", "", &ret)
+	if !ret.Success {
+		t.Fatalf("bounds did not replace the max: %+v", ret)
+	}
+
+	call(t, ts, http.MethodPost, "/int/l?op=create&mode=lock", "", &ret)
+	lockSession := acquire(t, ts, "l")
+	call(t, ts, http.MethodPost, "/int/l?op=bounds&max=0", "", &ret)
+	if ret.Success {
+		t.Fatal("bounds changed a locked counter without its session")
+	}
+	call(t, ts, http.MethodPost, "/int/l?op=bounds&max=0&sessionId="+lockSession, "", &ret)
+	if !ret.Success {
+		t.Fatal("holder could not set the bounds")
+	}
+	if status := call(t, ts, http.MethodPost, "/int/l?op=bounds&min=2&max=1&sessionId="+lockSession, "", &ret); status != http.StatusBadRequest {
+		t.Fatalf("min above max returned %d", status)
+	}
+}
+
+func TestRenewReportsHeldKeys(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	ret := types.AcquireAllReturn{}
+	call(t, ts, http.MethodPost, "/kv/acquireall/10s", `{"keys":["a","b","c"]}`, &ret)
+	if !ret.Success {
+		t.Fatal("acquireall failed")
+	}
+
+	call(t, ts, http.MethodDelete, "/admin/locks/kv/a", "", nil)
+	call(t, ts, http.MethodPost, "/kv/delete/b?sessionId="+ret.SessionID, "", nil)
+
+	renew := types.RenewReturn{}
+	call(t, ts, http.MethodPost, "/session/renew/"+ret.SessionID+"/10s", "", &renew)
+	if !renew.Success || len(renew.Keys) != 1 || renew.Keys[0] != "c" {
+		t.Fatalf("renew reported the wrong keys: %+v", renew)
+	}
+}
+
+// waitForWaiters polls the status until n requests are blocked.
+func waitForWaiters(t *testing.T, ts *httptest.Server, n int64) {
+	t.Helper()
+
+	status := types.StatusReturn{}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		call(t, ts, http.MethodGet, "/status", "", &status)
+		if status.BlockedWaiters == n {
+			return
+		}
+	}
+	t.Fatalf("%d waiters blocked, want %d", status.BlockedWaiters, n)
+}
+
+func TestMutexLockStopsWhenClientLeaves(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	lock := types.MutexReturn{}
+	call(t, ts, http.MethodPost, "/mutex/lock/m", "", &lock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/mutex/lock/m", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := ts.Client().Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	waitForWaiters(t, ts, 1)
+	cancel()
+	<-done
+	waitForWaiters(t, ts, 0)
+
+	// the abandoned request must not have taken the mutex
+	call(t, ts, http.MethodPost, "/mutex/unlock/m", "", &lock)
+	call(t, ts, http.MethodPost, "/mutex/lock/m?timeout=1s", "", &lock)
+	if !lock.Success {
+		t.Fatal("mutex is still held by the abandoned request")
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// Version is reported by /status, it is set at build time with
+// -ldflags "-X github.com/DENKweit/distlock/cmd.Version=...".
+var Version = "dev"
+
+// probePaths are served without authentication so that orchestrators can
+// probe the server.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// waiterCount counts requests blocked on a mutex or an empty queue.
+type waiterCount struct {
+	n int64
+}
+
+// wait registers a waiter. The returned function unregisters it and calls
+// release if not nil, calling it more than once has no effect.
+func (c *waiterCount) wait(release func()) func() {
+	atomic.AddInt64(&c.n, 1)
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&c.n, -1)
+			if release != nil {
+				release()
+			}
+		})
+	}
+}
+
+func (c *waiterCount) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+func memoryStatus() types.MemoryStatus {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+
+	return types.MemoryStatus{
+		Alloc:      stats.Alloc,
+		Sys:        stats.Sys,
+		NumGC:      stats.NumGC,
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/types"
+)
+
+func TestStatus(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	createNamespace(t, ts, "team", "")
+
+	call(t, ts, http.MethodPost, "/kv/set/a?value=v", "", nil)
+	acquire(t, ts, "b")
+	call(t, ts, http.MethodPost, "/ns/team/kv/acquire/c/10s", "", nil)
+	call(t, ts, http.MethodPost, "/mutex/lock/m", "", nil)
+	call(t, ts, http.MethodPost, "/queue/push/q?value=1", "", nil)
+	call(t, ts, http.MethodPost, "/queue/push/q?value=2", "", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/mutex/lock/m", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if resp, err := ts.Client().Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	waitForWaiters(t, ts, 1)
+
+	client, err := api.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := types.StatusReturn{
+		Running:        true,
+		Ready:          true,
+		Version:        Version,
+		Namespaces:     2,
+		Keys:           3,
+		Sessions:       2,
+		LocksHeld:      2,
+		MutexesHeld:    1,
+		QueueItems:     2,
+		BlockedWaiters: 1,
+		Persistence:    types.PersistenceStatus{Enabled: false},
+		Replication:    types.ReplicationStatus{Enabled: false, Mode: "standalone"},
+	}
+	got := status
+	got.StartedAt, got.Uptime, got.Memory = time.Time{}, 0, types.MemoryStatus{}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if status.Uptime <= 0 || time.Since(status.StartedAt) < status.Uptime || status.StartedAt.Location() != time.UTC {
+		t.Errorf("started at %v, up for %v", status.StartedAt, status.Uptime)
+	}
+	if status.Memory.Alloc == 0 || status.Memory.Sys < status.Memory.Alloc || status.Memory.Goroutines == 0 {
+		t.Errorf("memory %+v", status.Memory)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	config := DefaultConfig()
+	config.LogLevel = "error"
+	config.AuthFile = writeACL(t, testACL)
+	s := newServer(config)
+	ts := httptest.NewServer(s.handler)
+	t.Cleanup(ts.Close)
+
+	// the probes need no token, the status does
+	for path, want := range map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusOK, "/status": http.StatusUnauthorized} {
+		health := types.HealthReturn{}
+		if code := call(t, ts, http.MethodGet, path, "", &health); code != want {
+			t.Errorf("%s: got %d, want %d", path, code, want)
+		}
+		if want == http.StatusOK && health.Status != "ok" {
+			t.Errorf("%s: got %+v", path, health)
+		}
+	}
+
+	client, err := api.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready, err := client.Ready(); err != nil || !ready {
+		t.Fatalf("server is not ready: %v", err)
+	}
+
+	close(s.shuttingDown)
+
+	// shutting down the server is alive but no longer ready
+	if code := call(t, ts, http.MethodGet, "/healthz", "", nil); code != http.StatusOK {
+		t.Errorf("healthz while shutting down got %d", code)
+	}
+	if ready, err := client.Ready(); err != nil || ready {
+		t.Fatalf("shutting down server is ready: %v", err)
+	}
+
+	status := types.StatusReturn{}
+	callAs(t, ts, "t-alice", http.MethodGet, "/status", "", &status)
+	if !status.Running || status.Ready {
+		t.Fatalf("status while shutting down: %+v", status)
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves the certificate from certFile and keyFile and loads
+// it again whenever one of the files changes, so certificates can be
+// rotated without restarting the server.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	ret := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := ret.reload(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *certReloader) reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if modTime, err := c.latestModTime(); err == nil && modTime.After(c.modTime) {
+		// while the files are being replaced they may not match, keep
+		// serving the old certificate until they do
+		c.reload()
+	}
+
+	return c.cert, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", path)
+	}
+
+	return pool, nil
+}
+
+// serverTLSConfig returns nil if TLS is not configured.
+func serverTLSConfig(config Config) (*tls.Config, error) {
+	if config.TLSCertFile == "" && config.TLSKeyFile == "" {
+		if config.TLSClientCAFile != "" {
+			return nil, errors.New("client CA requires a server certificate and key")
+		}
+		return nil, nil
+	}
+
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		return nil, errors.New("both server certificate and key are required for TLS")
+	}
+
+	reloader, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if config.TLSClientCAFile != "" {
+		pool, err := loadCertPool(config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		ret.ClientCAs = pool
+		ret.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return ret, nil
+}
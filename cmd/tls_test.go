@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// testCA issues certificates for the tests, all valid for an hour.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	ca := &testCA{}
+	ca.cert, ca.key = ca.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "distlock test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return ca
+}
+
+// issue signs template with the CA, or self-signs it if the CA has no
+// certificate yet.
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca.serial++
+	template.SerialNumber = big.NewInt(ca.serial)
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parent, signer := template, key
+	if ca.cert != nil {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func (ca *testCA) server(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	return ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+func (ca *testCA) client(t *testing.T, name string) tls.Certificate {
+	cert, key := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func writePEM(t *testing.T, path string, blockType string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKeyPair(t *testing.T, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writePEM(t, certFile, "CERTIFICATE", cert.Raw)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+// newTLSTestServer serves over TLS with a server certificate issued by ca
+// and requires client certificates of ca if mutual is set. It returns the
+// URL of the server.
+func newTLSTestServer(t *testing.T, ca *testCA, config Config, mutual bool) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	cert, key := ca.server(t)
+	config.TLSCertFile, config.TLSKeyFile = writeKeyPair(t, dir, cert, key)
+
+	if mutual {
+		config.TLSClientCAFile = filepath.Join(dir, "ca.crt")
+		writePEM(t, config.TLSClientCAFile, "CERTIFICATE", ca.cert.Raw)
+	}
+
+	tlsConfig, err := serverTLSConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// httptest.Server.StartTLS would add its own certificate, which takes
+	// precedence over GetCertificate
+	config.LogLevel = "error"
+	server := &http.Server{
+		Handler:   newServer(config).handler,
+		TLSConfig: tlsConfig,
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	return "https://" + listener.Addr().String()
+}
+
+// tlsClient trusts ca and presents certs to the server. Every request uses
+// a new connection.
+func tlsClient(ca *testCA, certs ...tls.Certificate) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: ca.pool(), Certificates: certs},
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+// post sends a POST to the server at url with client and decodes the JSON response into
+// out. It returns the status code, or 0 if the request failed.
+func post(t *testing.T, client *http.Client, url string, path string, out interface{}) int {
+	t.Helper()
+
+	resp, err := client.Post(url+path, "", nil)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTLSTestServer(t, ca, DefaultConfig(), false)
+
+	ret := types.AcquireReturn{}
+	if status := post(t, tlsClient(ca), ts, "/kv/acquire/k/10s", &ret); status != http.StatusOK || !ret.Success {
+		t.Fatalf("acquire over TLS failed: %d %+v", status, ret)
+	}
+
+	if status := post(t, tlsClient(newTestCA(t)), ts, "/kv/acquire/k/10s", nil); status != 0 {
+		t.Fatalf("client trusting another CA got %d", status)
+	}
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTLSTestServer(t, ca, DefaultConfig(), true)
+
+	alice := tlsClient(ca, ca.client(t, "alice"))
+	bob := tlsClient(ca, ca.client(t, "bob"))
+
+	if status := post(t, tlsClient(ca), ts, "/kv/acquire/k/10s", nil); status != 0 {
+		t.Fatalf("client without a certificate got %d", status)
+	}
+	if status := post(t, tlsClient(ca, newTestCA(t).client(t, "alice")), ts, "/kv/acquire/k/10s", nil); status != 0 {
+		t.Fatalf("certificate of another CA got %d", status)
+	}
+
+	first := types.AcquireReturn{}
+	post(t, alice, ts, "/kv/acquire/k/10s?reentrant=true", &first)
+	if !first.Success {
+		t.Fatal("acquire with a client certificate failed")
+	}
+
+	// the certificate's common name identifies the holder
+	again := types.AcquireReturn{}
+	post(t, alice, ts, "/kv/acquire/k/10s?reentrant=true", &again)
+	if !again.Success || again.SessionID != first.SessionID || again.Holds != 2 {
+		t.Fatalf("alice could not acquire her lock again: %+v", again)
+	}
+
+	other := types.AcquireReturn{}
+	post(t, bob, ts, "/kv/acquire/k/10s?reentrant=true", &other)
+	if other.Success {
+		t.Fatal("bob acquired alice's lock")
+	}
+	if status := post(t, bob, ts, "/session/renew/"+first.SessionID+"/10s", nil); status != http.StatusForbidden {
+		t.Fatalf("bob renewing alice's session got %d", status)
+	}
+}
+
+func TestMutualTLSWithACL(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	acl := `{"tokens":[{"token":"t1","name":"alice","policies":[{"primitive":"kv","prefix":"a-","rights":["read","write","lock"]}]}]}`
+	if err := os.WriteFile(authFile, []byte(acl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.AuthFile = authFile
+
+	ca := newTestCA(t)
+	ts := newTLSTestServer(t, ca, config, true)
+
+	alice := tlsClient(ca, ca.client(t, "alice"))
+
+	ret := types.AcquireReturn{}
+	if status := post(t, alice, ts, "/kv/acquire/a-1/10s", &ret); status != http.StatusOK || !ret.Success {
+		t.Fatalf("certificate did not grant alice's rights: %d %+v", status, ret)
+	}
+	if status := post(t, alice, ts, "/kv/acquire/b-1/10s", nil); status != http.StatusForbidden {
+		t.Fatalf("alice acquired a key outside her prefix: %d", status)
+	}
+	if status := post(t, tlsClient(ca, ca.client(t, "carol")), ts, "/kv/acquire/a-1/10s", nil); status != http.StatusUnauthorized {
+		t.Fatalf("unknown certificate name got %d", status)
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	cert, key := ca.server(t)
+	certFile, keyFile := writeKeyPair(t, dir, cert, key)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := func() *big.Int {
+		t.Helper()
+		current, err := reloader.getCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(current.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber
+	}
+
+	if served().Cmp(cert.SerialNumber) != 0 {
+		t.Fatal("reloader does not serve the initial certificate")
+	}
+
+	next, nextKey := ca.server(t)
+	writeKeyPair(t, dir, next, nextKey)
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if served().Cmp(next.SerialNumber) != 0 {
+		t.Fatal("rotated certificate was not loaded")
+	}
+}
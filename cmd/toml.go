@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by configuration files: tables,
+// key/value pairs with string, integer, boolean and single-line array
+// values, and comments. It returns the values by their dotted key, arrays
+// joined with commas.
+func parseTOML(data []byte) (map[string]string, error) {
+	ret := map[string]string{}
+	table := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		if text[0] == '[' {
+			end := strings.IndexByte(text, ']')
+			if end == -1 || !isTOMLComment(text[end+1:]) {
+				return nil, fmt.Errorf("line %d: invalid table header", line)
+			}
+			table = strings.TrimSpace(text[1:end])
+			if !isTOMLKey(table) {
+				return nil, fmt.Errorf("line %d: invalid table name %q", line, table)
+			}
+			continue
+		}
+
+		eq := strings.IndexByte(text, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+
+		key := strings.TrimSpace(text[:eq])
+		if !isTOMLKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", line, key)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		if _, ok := ret[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line, key)
+		}
+
+		value, rest, err := parseTOMLValue(strings.TrimSpace(text[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, key, err)
+		}
+		if !isTOMLComment(rest) {
+			return nil, fmt.Errorf("line %d: %s: unexpected %q after value", line, key, rest)
+		}
+
+		ret[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func isTOMLKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, part := range strings.Split(key, ".") {
+		if part == "" {
+			return false
+		}
+		for _, r := range part {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isTOMLComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || rest[0] == '#'
+}
+
+// parseTOMLValue parses the value at the start of text and returns it
+// together with the remaining text.
+func parseTOMLValue(text string) (string, string, error) {
+	if text == "" {
+		return "", "", fmt.Errorf("missing value")
+	}
+
+	switch text[0] {
+	case '"':
+		for idx := 1; idx < len(text); idx++ {
+			if text[idx] == '\\' {
+				idx++
+				continue
+			}
+			if text[idx] == '"' {
+				value, err := strconv.Unquote(text[:idx+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", text[:idx+1])
+				}
+				return value, text[idx+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	case '\'':
+		end := strings.IndexByte(text[1:], '\'')
+		if end == -1 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return text[1 : end+1], text[end+2:], nil
+	case '[':
+		values := []string{}
+		rest := strings.TrimSpace(text[1:])
+		for {
+			if rest == "" {
+				return "", "", fmt.Errorf("unterminated array")
+			}
+			if rest[0] == ']' {
+				return strings.Join(values, ","), rest[1:], nil
+			}
+			value, next, err := parseTOMLValue(rest)
+			if err != nil {
+				return "", "", err
+			}
+			values = append(values, value)
+			rest = strings.TrimSpace(next)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return "", "", fmt.Errorf("expected , or ] in array")
+			}
+		}
+	}
+
+	end := strings.IndexAny(text, " \t#,]")
+	if end == -1 {
+		end = len(text)
+	}
+	value := text[:end]
+
+	if value != "true" && value != "false" {
+		n, err := parseTOMLInt(value, 64)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid value %s", value)
+		}
+		value = strconv.FormatInt(n, 10)
+	}
+
+	return value, text[end:], nil
+}
+
+// parseTOMLInt parses an integer written as TOML does: decimal without
+// leading zeros, or hexadecimal, octal or binary with a 0x, 0o or 0b
+// prefix. Digits may be separated by single underscores.
+func parseTOMLInt(value string, bitSize int) (int64, error) {
+	digits, base := value, 10
+	if len(value) > 2 && value[0] == '0' {
+		switch value[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 10 {
+			digits = value[2:]
+		}
+	}
+
+	sign := ""
+	if base == 10 && digits != "" && (digits[0] == '+' || digits[0] == '-') {
+		sign, digits = digits[:1], digits[1:]
+	}
+
+	if digits == "" || digits[0] == '_' || digits[len(digits)-1] == '_' || strings.Contains(digits, "__") ||
+		base == 10 && len(digits) > 1 && digits[0] == '0' {
+		return 0, fmt.Errorf("invalid integer %s", value)
+	}
+
+	n, err := strconv.ParseInt(sign+strings.ReplaceAll(digits, "_", ""), base, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %s", value)
+	}
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/DENKweit/distlock/trace"
+	"github.com/go-chi/chi"
+)
+
+const traceServiceName = "distlock"
+
+// newTracer exports spans to an OTLP/HTTP collector if exporter is an
+// http(s) URL, writes them as JSON lines to stdout if it is "-" or appends
+// them to the file at exporter otherwise. Tracing is disabled if exporter
+// is empty.
+func newTracer(exporter string) (*trace.Tracer, error) {
+	if exporter == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(exporter, "http://") || strings.HasPrefix(exporter, "https://") {
+		return trace.NewTracer(traceServiceName, trace.NewOTLPExporter(exporter, traceServiceName)), nil
+	}
+
+	var out io.Writer = os.Stdout
+	if exporter != "-" {
+		f, err := os.OpenFile(exporter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+
+	return trace.NewTracer(traceServiceName, trace.NewWriterExporter(out)), nil
+}
+
+// traceRequests continues the trace of the request's traceparent header in
+// a server span named after the route pattern.
+func traceRequests(tracer *trace.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tracer == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, span := tracer.Start(trace.Extract(r.Context(), r.Header), r.Method, trace.SpanKindServer)
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			route := "unmatched"
+			if pattern := routePattern(r); pattern != "" {
+				route = pattern
+			}
+
+			span.SetName(r.Method + " " + route)
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("http.status_code", strconv.Itoa(recorder.status))
+		})
+	}
+}
+
+// traceOperation wraps a handler in an internal span carrying the
+// namespace and the key taken from the URL parameter keyParam, if any.
+func traceOperation(tracer *trace.Tracer, name string, keyParam string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tracer == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, span := tracer.Start(r.Context(), name, trace.SpanKindInternal)
+			defer span.End()
+
+			span.SetAttribute("distlock.namespace", requestNamespace(r).Name)
+			if keyParam != "" {
+				span.SetAttribute("distlock.key", chi.URLParam(r, keyParam))
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// startSpan starts a child span of the request's current span.
+func startSpan(tracer *trace.Tracer, r *http.Request, name string) *trace.Span {
+	_, span := tracer.Start(r.Context(), name, trace.SpanKindInternal)
+	return span
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DENKweit/distlock/api"
+	"github.com/DENKweit/distlock/trace"
+)
+
+type spanRecorder struct {
+	lock  sync.Mutex
+	spans []trace.SpanData
+}
+
+func (r *spanRecorder) Export(span trace.SpanData) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.spans = append(r.spans, span)
+}
+
+// readSpans polls the span file of the server until it holds a span for
+// which match returns true, and returns all spans.
+func readSpans(t *testing.T, path string, match func(span trace.SpanData) bool) []trace.SpanData {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		spans := []trace.SpanData{}
+		found := false
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			span := trace.SpanData{}
+			if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+				t.Fatalf("%s: %v", scanner.Bytes(), err)
+			}
+			spans = append(spans, span)
+			found = found || match(span)
+		}
+		file.Close()
+
+		if found {
+			return spans
+		}
+	}
+	t.Fatal("span not exported")
+	return nil
+}
+
+func findSpan(spans []trace.SpanData, name string, parentSpanID string) *trace.SpanData {
+	for idx := range spans {
+		if spans[idx].Name == name && (parentSpanID == "" || spans[idx].ParentSpanID == parentSpanID) {
+			return &spans[idx]
+		}
+	}
+	return nil
+}
+
+func TestTracePropagation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	config := DefaultConfig()
+	config.TraceExporter = path
+	ts := newTestServer(t, config)
+
+	spans := &spanRecorder{}
+	client, err := api.NewClient(ts.URL, api.WithTracer(trace.NewTracer("test", spans)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _, err := client.Acquire("k", "", 100*time.Millisecond); err != nil || !ok {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	if len(spans.spans) != 1 {
+		t.Fatalf("client exported %d spans, want 1", len(spans.spans))
+	}
+	clientSpan := spans.spans[0]
+	if clientSpan.Name != "distlock kv.acquire" || clientSpan.Kind != trace.SpanKindClient || clientSpan.Attributes["http.status_code"] != "200" {
+		t.Fatalf("client span %+v", clientSpan)
+	}
+
+	// the session timer continues the trace of the acquire
+	server := readSpans(t, path, func(span trace.SpanData) bool { return span.Name == "session.expire" })
+
+	request := findSpan(server, "POST /kv/acquire/{key}/{duration}", clientSpan.SpanID)
+	if request == nil || request.TraceID != clientSpan.TraceID || request.Kind != trace.SpanKindServer || request.Attributes["http.route"] != "/kv/acquire/{key}/{duration}" {
+		t.Fatalf("no server span below the client span in %+v", server)
+	}
+	operation := findSpan(server, "kv.acquire", request.SpanID)
+	if operation == nil || operation.Attributes["distlock.key"] != "k" || operation.Attributes["distlock.namespace"] != defaultNamespace {
+		t.Fatalf("no operation span below the server span in %+v", server)
+	}
+	expire := findSpan(server, "session.expire", "")
+	if expire.TraceID != clientSpan.TraceID || expire.Attributes["distlock.key"] != "k" {
+		t.Fatalf("expiry %+v is not in the trace of the acquire", expire)
+	}
+}
+
+func TestTraceLockWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	config := DefaultConfig()
+	config.TraceExporter = path
+	ts := newTestServer(t, config)
+
+	client, err := api.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := 10 * time.Millisecond
+	client.LockMutex("m", &timeout)
+	if ok, _ := client.LockMutex("m", &timeout); ok {
+		t.Fatal("locked mutex was locked again")
+	}
+
+	server := readSpans(t, path, func(span trace.SpanData) bool {
+		return span.Name == "mutex.wait" && span.Attributes["distlock.timed_out"] == "true"
+	})
+	for _, span := range server {
+		if span.Name == "mutex.wait" && span.Attributes["distlock.timed_out"] == "true" {
+			if span.End.Sub(span.Start) < timeout || findSpan(server, "mutex.lock", "") == nil {
+				t.Fatalf("wait span %+v", span)
+			}
+			return
+		}
+	}
+}
+
+func TestTraceparentFromCaller(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	config := DefaultConfig()
+	config.TraceExporter = path
+	ts := newTestServer(t, config)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/kv/get/k", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(trace.TraceparentHeader, traceparent)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	server := readSpans(t, path, func(span trace.SpanData) bool { return span.Kind == trace.SpanKindServer })
+	request := findSpan(server, "GET /kv/get/{key}", "00f067aa0ba902b7")
+	if request == nil || request.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("request did not continue the caller's trace: %+v", server)
+	}
+}
@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/DENKweit/distlock/types"
+	"github.com/go-chi/chi"
+)
+
+// v1Route is a route of the versioned API. It is served by the legacy
+// route its legacy function maps the request to, so that both APIs share
+// one implementation. The routes also make up the OpenAPI document.
+type v1Route struct {
+	method  string
+	pattern string
+	summary string
+	// params are the query parameters the route accepts, they are passed
+	// on to the legacy route.
+	params []string
+	// request and response are the types of the JSON request and response
+	// bodies, nil if there is none.
+	request  interface{}
+	response interface{}
+	// passBody passes the request body on as is instead of decoding it,
+	// contentTypes lists the content types it may have.
+	passBody     bool
+	contentTypes []string
+	legacy       func(r *http.Request, body interface{}) (legacyRequest, error)
+}
+
+// legacyRequest is the request to the legacy route serving a /v1 route.
+// The query parameters of the original request are kept. body is sent as
+// JSON if set, for legacy routes taking part of a decoded body.
+type legacyRequest struct {
+	method string
+	path   []string
+	query  url.Values
+	body   interface{}
+}
+
+// url returns the URL of the legacy request with query. Path segments are
+// only escaped if they contain a slash, as the routes take URL parameters
+// from the escaped path then.
+func (l legacyRequest) url(query url.Values) *url.URL {
+	u := &url.URL{
+		Path:     "/" + strings.Join(l.path, "/"),
+		RawQuery: query.Encode(),
+	}
+	for _, segment := range l.path {
+		if strings.Contains(segment, "/") {
+			escaped := make([]string, len(l.path))
+			for idx, segment := range l.path {
+				escaped[idx] = url.PathEscape(segment)
+			}
+			u.RawPath = "/" + strings.Join(escaped, "/")
+			break
+		}
+	}
+	return u
+}
+
+// request returns a copy of r with ctx for the legacy request. It is
+// routed with a route context of its own, the one of r keeps the route r
+// was received on for logs and metrics.
+func (l legacyRequest) request(ctx context.Context, r *http.Request, query url.Values) *http.Request {
+	u := l.url(query)
+	req := r.Clone(context.WithValue(ctx, chi.RouteCtxKey, chi.NewRouteContext()))
+	req.Method = l.method
+	req.URL = u
+	req.RequestURI = u.RequestURI()
+	return req
+}
+
+// responseBuffer records the response to a legacy request served in
+// process.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// samePath serves a route whose path only differs by the /v1 prefix.
+func samePath(method string) func(r *http.Request, body interface{}) (legacyRequest, error) {
+	return func(r *http.Request, body interface{}) (legacyRequest, error) {
+		path := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/v1/"), "/")
+		for idx, segment := range path {
+			path[idx], _ = url.PathUnescape(segment)
+		}
+		return legacyRequest{method: method, path: path}, nil
+	}
+}
+
+// v1Param returns the unescaped URL parameter name.
+func v1Param(r *http.Request, name string) string {
+	value := chi.URLParam(r, name)
+	if r.URL.RawPath != "" {
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			return unescaped
+		}
+	}
+	return value
+}
+
+func required(name string, value string) error {
+	if value == "" {
+		return errors.New(name + " is required")
+	}
+	return nil
+}
+
+var v1Routes = []v1Route{
+	{
+		method: http.MethodPost, pattern: "/v1/sessions/{sessionId}/renew",
+		summary: "Renew a session", request: types.RenewRequest{}, response: types.RenewReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.RenewRequest)
+			return legacyRequest{method: http.MethodPost, path: []string{"session", "renew", v1Param(r, "sessionId"), req.TTL}}, required("ttl", req.TTL)
+		},
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/sessions/{sessionId}",
+		summary: "Destroy a session, releasing its locks",
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"session", "destroy", v1Param(r, "sessionId")}}, nil
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/kv",
+		summary: "List the keys, optionally only those starting with prefix", params: []string{"prefix"}, response: []string{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodGet, path: []string{"kv", "keys"}}, nil
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/kv/{key}",
+		summary: "Get the value of a key, or the value at a JSON path, raw=true returns the value as the response body",
+		params:  []string{"path", "raw"}, response: types.GetReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodGet, path: []string{"kv", "get", v1Param(r, "key")}}, nil
+		},
+	},
+	{
+		method: http.MethodPut, pattern: "/v1/kv/{key}",
+		summary: "Set the value of a key", request: types.SetRequest{}, response: types.SetReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.SetRequest)
+			query := url.Values{"value": {req.Value}, "kind": {req.Kind}, "sessionId": {req.SessionID}}
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "set", v1Param(r, "key")}, query: query}, nil
+		},
+	},
+	{
+		method: http.MethodPatch, pattern: "/v1/kv/{key}",
+		summary: "Patch a JSON value with a JSON merge patch or JSON patch", params: []string{"sessionId"},
+		request: []types.JSONPatchOp{}, response: types.PatchReturn{},
+		passBody: true, contentTypes: []string{contentTypeMergePatch, contentTypeJSONPatch},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "patch", v1Param(r, "key")}}, nil
+		},
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/kv/{key}",
+		summary: "Delete a key", params: []string{"sessionId"}, response: types.DeleteReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "delete", v1Param(r, "key")}}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/kv/_getm",
+		summary: "Get the values of several keys", request: types.GetMRequest{}, response: types.GetMReturn{},
+		passBody: true,
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodGet, path: []string{"kv", "getm"}}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/kv/_setm",
+		summary: "Set the values of several keys, all or none", params: []string{"sessionId"},
+		request: types.SetMRequest{}, response: types.SetMReturn{}, passBody: true,
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "setm"}}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/locks/_all",
+		summary: "Acquire the locks on several keys under a new session, all or none", request: types.LockAllRequest{}, response: types.AcquireAllReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.LockAllRequest)
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "acquireall", req.TTL}, body: req.AcquireAllRequest}, required("ttl", req.TTL)
+		},
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/sessions/{sessionId}/locks",
+		summary: "Release all locks of a session and destroy it", response: types.ReleaseAllReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "releaseall", v1Param(r, "sessionId")}}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/locks/{key}",
+		summary: "Acquire the lock on a key under a new session", request: types.LockRequest{}, response: types.AcquireReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.LockRequest)
+			query := url.Values{"value": {req.Value}, "kind": {req.Kind}, "sessionId": {req.SessionID}}
+			if req.Reentrant {
+				query.Set("reentrant", "true")
+			}
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "acquire", v1Param(r, "key"), req.TTL}, query: query}, required("ttl", req.TTL)
+		},
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/locks/{key}",
+		summary: "Release the lock on a key", params: []string{"sessionId"}, response: types.ReleaseReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			sessionID := r.URL.Query().Get("sessionId")
+			return legacyRequest{method: http.MethodPost, path: []string{"kv", "release", v1Param(r, "key"), sessionID}}, required("sessionId", sessionID)
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/mutexes/{key}/lock",
+		summary: "Lock a mutex, waiting until it is free or the timeout has passed", request: types.MutexLockRequest{}, response: types.MutexReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.MutexLockRequest)
+			return legacyRequest{method: http.MethodPost, path: []string{"mutex", "lock", v1Param(r, "key")}, query: url.Values{"timeout": {req.Timeout}}}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/mutexes/{key}/unlock",
+		summary: "Unlock a mutex", response: types.MutexReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"mutex", "unlock", v1Param(r, "key")}}, nil
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/ints/{key}",
+		summary: "Get the value of a counter", params: []string{"sessionId"}, response: types.IntReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			return legacyRequest{method: http.MethodPost, path: []string{"int", v1Param(r, "key")}, query: url.Values{"op": {string(types.IntOpTypeGet)}}}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/ints/{key}/{op}",
+		summary: "Apply an operation to a counter: inc, dec, add, set, getset, cas, reset, create or bounds", request: types.IntRequest{}, response: types.IntReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.IntRequest)
+			query := url.Values{"op": {chi.URLParam(r, "op")}, "ttl": {req.TTL}, "mode": {string(req.Mode)}, "sessionId": {req.SessionID}}
+			for name, value := range map[string]*int64{"value": req.Value, "delta": req.Delta, "expected": req.Expected, "min": req.Min, "max": req.Max} {
+				if value != nil {
+					query.Set(name, strconv.FormatInt(*value, 10))
+				}
+			}
+			return legacyRequest{method: http.MethodPost, path: []string{"int", v1Param(r, "key")}, query: query}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/queues/{queue}/items",
+		summary: "Append a value to a queue", request: types.PushRequest{}, response: types.QueuePushReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.PushRequest)
+			query := url.Values{"value": {req.Value}, "kind": {req.Kind}}
+			return legacyRequest{method: http.MethodPost, path: []string{"queue", "push", v1Param(r, "queue")}, query: query}, nil
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/queues/{queue}/pop",
+		summary: "Lease the first item of a queue", request: types.PopRequest{}, response: types.QueuePopReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			req := body.(*types.PopRequest)
+			query := url.Values{"timeout": {req.Timeout}, "sessionId": {req.SessionID}}
+			return legacyRequest{method: http.MethodPost, path: []string{"queue", "pop", v1Param(r, "queue"), req.Lease}, query: query}, required("lease", req.Lease)
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/queues/{queue}/items/{itemId}/ack",
+		summary: "Acknowledge a leased item, removing it from the queue", params: []string{"receipt"}, response: types.QueueAckReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			receipt := r.URL.Query().Get("receipt")
+			return legacyRequest{method: http.MethodPost, path: []string{"queue", "ack", v1Param(r, "queue"), v1Param(r, "itemId")}, query: url.Values{"receipt": {receipt}}}, required("receipt", receipt)
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/queues/{queue}/items/{itemId}/nack",
+		summary: "Return a leased item to the queue", params: []string{"receipt"}, response: types.QueueAckReturn{},
+		legacy: func(r *http.Request, body interface{}) (legacyRequest, error) {
+			receipt := r.URL.Query().Get("receipt")
+			return legacyRequest{method: http.MethodPost, path: []string{"queue", "nack", v1Param(r, "queue"), v1Param(r, "itemId")}, query: url.Values{"receipt": {receipt}}}, required("receipt", receipt)
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/status",
+		summary: "Report the state of the server", response: types.StatusReturn{},
+		legacy: samePath(http.MethodGet),
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/batch",
+		summary: "Run several operations in order, optionally all or none", request: types.BatchRequest{}, response: types.BatchReturn{},
+		passBody: true, legacy: samePath(http.MethodPost),
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/audit/{key}",
+		summary: "Get the audit log of a key", params: []string{"primitive", "limit"}, response: types.AuditReturn{},
+		legacy: samePath(http.MethodGet),
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/admin/namespaces",
+		summary: "List the namespaces", response: types.NamespacesReturn{},
+		legacy: samePath(http.MethodGet),
+	},
+	{
+		method: http.MethodPost, pattern: "/v1/admin/namespaces/{namespace}",
+		summary: "Create a namespace or change its quota", request: types.NamespaceQuota{}, response: types.NamespaceReturn{},
+		passBody: true, legacy: samePath(http.MethodPost),
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/admin/namespaces/{namespace}",
+		summary: "Delete a namespace", response: types.NamespaceReturn{},
+		legacy: samePath(http.MethodDelete),
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/admin/sessions",
+		summary: "List the sessions", response: types.SessionsReturn{},
+		legacy: samePath(http.MethodGet),
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/admin/sessions/{sessionId}",
+		summary: "Expire a session", response: types.AdminReturn{},
+		legacy: samePath(http.MethodDelete),
+	},
+	{
+		method: http.MethodGet, pattern: "/v1/admin/locks",
+		summary: "List the held locks and mutexes", response: types.LocksReturn{},
+		legacy: samePath(http.MethodGet),
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/admin/locks/kv/{key}",
+		summary: "Force release the lock on a key", response: types.AdminReturn{},
+		legacy: samePath(http.MethodDelete),
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/admin/locks/mutex/{key}",
+		summary: "Force unlock a mutex", response: types.AdminReturn{},
+		legacy: samePath(http.MethodDelete),
+	},
+	{
+		method: http.MethodDelete, pattern: "/v1/admin/keys",
+		summary: "Delete all keys starting with prefix", params: []string{"prefix"}, response: types.PurgeReturn{},
+		legacy: samePath(http.MethodDelete),
+	},
+}
+
+// routePattern returns the pattern of the route that served r, or "" if
+// no route matched. Unmatched requests end at the /* route everything is
+// mounted on.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.RoutePattern() == "/*" {
+		return ""
+	}
+	return rctx.RoutePattern()
+}
+
+// mountV1 adds the /v1 routes and the OpenAPI document describing them to
+// router, which also serves the legacy routes.
+func mountV1(router chi.Router) {
+	for _, route := range v1Routes {
+		router.Method(route.method, route.pattern, route.handler(router))
+	}
+
+	spec, err := json.MarshalIndent(openAPIDocument(v1Routes), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	router.Get("/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+}
+
+// handler maps a request to the legacy route and lets router serve it.
+func (route v1Route) handler(router http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body interface{}
+		if route.request != nil && !route.passBody {
+			body = reflect.New(reflect.TypeOf(route.request)).Interface()
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		legacy, err := route.legacy(r, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		for name, values := range legacy.query {
+			if values[0] != "" {
+				query[name] = values
+			}
+		}
+
+		req := legacy.request(r.Context(), r, query)
+		if legacy.body != nil {
+			data, err := json.Marshal(legacy.body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(data))
+			req.ContentLength = int64(len(data))
+			req.Header.Set("Content-Type", "application/json")
+		} else if body != nil {
+			req.Body = http.NoBody
+			req.ContentLength = 0
+			req.Header.Del("Content-Type")
+		}
+
+		router.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+func TestV1Routes(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	set := types.SetReturn{}
+	if code := call(t, ts, http.MethodPut, "/v1/kv/a", `{"value":"1"}`, &set); code != http.StatusOK || !set.Success {
+		t.Fatalf("put got %d %+v", code, set)
+	}
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/v1/kv/a", "", &get)
+	if !get.Success || get.Value != "1" || get.Locked {
+		t.Fatalf("get %+v", get)
+	}
+
+	// both APIs share one store
+	call(t, ts, http.MethodPost, "/kv/set/b?value=2", "", nil)
+	getm := types.GetMReturn{}
+	call(t, ts, http.MethodPost, "/v1/kv/_getm", `{"keys":["a","b"]}`, &getm)
+	if len(getm.Entries) != 2 || getm.Entries[0].Value != "1" || getm.Entries[1].Value != "2" {
+		t.Fatalf("getm %+v", getm)
+	}
+	keys := []string{}
+	call(t, ts, http.MethodGet, "/v1/kv?prefix=b", "", &keys)
+	if !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Fatalf("keys %v", keys)
+	}
+
+	acquired := types.AcquireReturn{}
+	call(t, ts, http.MethodPost, "/v1/locks/c", `{"ttl":"10s","value":"v"}`, &acquired)
+	if !acquired.Success || acquired.SessionID == "" {
+		t.Fatalf("lock %+v", acquired)
+	}
+	call(t, ts, http.MethodGet, "/kv/get/c", "", &get)
+	if !get.Locked || get.Value != "v" {
+		t.Fatalf("locked key %+v", get)
+	}
+	released := types.ReleaseReturn{}
+	call(t, ts, http.MethodDelete, "/v1/locks/c?sessionId="+acquired.SessionID, "", &released)
+	if !released.Success {
+		t.Fatal("release failed")
+	}
+
+	all := types.AcquireAllReturn{}
+	call(t, ts, http.MethodPost, "/v1/locks/_all", `{"ttl":"10s","keys":["d","e"]}`, &all)
+	if !all.Success {
+		t.Fatalf("lock all %+v", all)
+	}
+	releasedAll := types.ReleaseAllReturn{}
+	call(t, ts, http.MethodDelete, "/v1/sessions/"+all.SessionID+"/locks", "", &releasedAll)
+	if !releasedAll.Success || !reflect.DeepEqual(releasedAll.Released, []string{"d", "e"}) {
+		t.Fatalf("release all %+v", releasedAll)
+	}
+
+	counter := types.IntReturn{}
+	call(t, ts, http.MethodPost, "/v1/ints/n/add", `{"delta":5}`, &counter)
+	call(t, ts, http.MethodPost, "/v1/ints/n/inc", `{}`, &counter)
+	if !counter.Success || counter.Value != 6 || counter.Previous != 5 {
+		t.Fatalf("counter %+v", counter)
+	}
+	call(t, ts, http.MethodGet, "/v1/ints/n", "", &counter)
+	if counter.Value != 6 {
+		t.Fatalf("counter got %d", counter.Value)
+	}
+
+	mutex := types.MutexReturn{}
+	call(t, ts, http.MethodPost, "/v1/mutexes/m/lock", `{"timeout":"10ms"}`, &mutex)
+	if !mutex.Success {
+		t.Fatal("mutex lock failed")
+	}
+	call(t, ts, http.MethodPost, "/v1/mutexes/m/lock", `{"timeout":"10ms"}`, &mutex)
+	if mutex.Success {
+		t.Fatal("locked mutex was locked again")
+	}
+	call(t, ts, http.MethodPost, "/v1/mutexes/m/unlock", "", &mutex)
+	if !mutex.Success {
+		t.Fatal("mutex unlock failed")
+	}
+
+	pushed := types.QueuePushReturn{}
+	call(t, ts, http.MethodPost, "/v1/queues/q/items", `{"value":"x"}`, &pushed)
+	popped := types.QueuePopReturn{}
+	call(t, ts, http.MethodPost, "/v1/queues/q/pop", `{"lease":"10s"}`, &popped)
+	if !popped.Success || popped.ID != pushed.ID || popped.Value != "x" {
+		t.Fatalf("popped %+v after pushing %+v", popped, pushed)
+	}
+	acked := types.QueueAckReturn{}
+	call(t, ts, http.MethodPost, "/v1/queues/q/items/"+popped.ID+"/ack?receipt="+popped.Receipt, "", &acked)
+	if !acked.Success {
+		t.Fatal("ack failed")
+	}
+}
+
+func TestV1Patch(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	call(t, ts, http.MethodPut, "/v1/kv/doc", `{"value":"{\"a\":1}","kind":"json"}`, nil)
+
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/v1/kv/doc", strings.NewReader(`{"b":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentTypeMergePatch)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := types.PatchReturn{}
+	json.NewDecoder(resp.Body).Decode(&patched)
+	resp.Body.Close()
+	if !patched.Success || patched.Value != `{"a":1,"b":2}` {
+		t.Fatalf("patched %+v", patched)
+	}
+}
+
+func TestV1EscapedKeys(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	// escaped keys address the same key on both APIs
+	for _, key := range []string{"a b", "a/b c"} {
+		escaped := url.PathEscape(key)
+		call(t, ts, http.MethodPut, "/v1/kv/"+escaped, `{"value":"`+key+`"}`, nil)
+
+		get := types.GetReturn{}
+		call(t, ts, http.MethodGet, "/kv/get/"+escaped, "", &get)
+		if !get.Success || get.Value != key {
+			t.Fatalf("%s: got %+v", key, get)
+		}
+
+		acquired := types.AcquireReturn{}
+		call(t, ts, http.MethodPost, "/kv/acquire/"+escaped+"/10s", "", &acquired)
+		released := types.ReleaseReturn{}
+		call(t, ts, http.MethodDelete, "/v1/locks/"+escaped+"?sessionId="+acquired.SessionID, "", &released)
+		if !acquired.Success || !released.Success {
+			t.Fatalf("%s: lock taken on one API was not released on the other", key)
+		}
+	}
+}
+
+func TestV1InvalidRequests(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/v1/locks/k", `{}`},
+		{http.MethodPost, "/v1/locks/k", `{"ttl":`},
+		{http.MethodPost, "/v1/locks/_all", `{"keys":["k"]}`},
+		{http.MethodDelete, "/v1/locks/k", ""},
+		{http.MethodPost, "/v1/sessions/s/renew", `{}`},
+		{http.MethodPost, "/v1/queues/q/pop", `{}`},
+		{http.MethodPost, "/v1/queues/q/items/i/ack", ""},
+		{http.MethodPost, "/v1/queues/q/items/i/nack", ""},
+	} {
+		if code := call(t, ts, tc.method, tc.path, tc.body, nil); code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: got %d", tc.method, tc.path, tc.body, code)
+		}
+	}
+}
+
+func TestV1RouteLogged(t *testing.T) {
+	ts, out := newLoggingTestServer(t, DefaultConfig())
+
+	call(t, ts, http.MethodPut, "/v1/kv/a", `{"value":"1"}`, nil)
+
+	// the legacy route serving the request is not logged on its own
+	lines := out.lines(t)
+	if len(lines) != 1 || lines[0]["route"] != "/v1/kv/{key}" || lines[0]["path"] != "/v1/kv/a" {
+		t.Fatalf("logged %v", lines)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	doc := struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+		Schemas struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+				Required   []string               `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}{}
+	if code := call(t, ts, http.MethodGet, "/v1/openapi.json", "", &doc); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi version %q", doc.OpenAPI)
+	}
+
+	for _, route := range v1Routes {
+		operation := doc.Paths[route.pattern][strings.ToLower(route.method)]
+		if operation == nil {
+			t.Errorf("%s %s is not documented", route.method, route.pattern)
+			continue
+		}
+		if operation["summary"] != route.summary {
+			t.Errorf("%s %s: summary %v", route.method, route.pattern, operation["summary"])
+		}
+		if _, ok := operation["requestBody"]; ok != (route.request != nil) {
+			t.Errorf("%s %s: request body documented %v", route.method, route.pattern, ok)
+		}
+	}
+
+	// the schemas have the names encoding/json uses
+	for _, value := range []interface{}{types.GetReturn{}, types.LockRequest{}, types.LockAllRequest{}, types.QueuePopReturn{}, types.IntRequest{}} {
+		typ := reflect.TypeOf(value)
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded := map[string]interface{}{}
+		json.Unmarshal(data, &encoded)
+
+		schema, ok := doc.Schemas.Schemas[typ.Name()]
+		if !ok {
+			t.Errorf("no schema for %s", typ.Name())
+			continue
+		}
+		for name := range encoded {
+			if _, ok := schema.Properties[name]; !ok {
+				t.Errorf("%s: %s is not in the schema", typ.Name(), name)
+			}
+		}
+		for _, name := range schema.Required {
+			if _, ok := encoded[name]; !ok {
+				t.Errorf("%s: %s is required but omitted when empty", typ.Name(), name)
+			}
+		}
+	}
+
+	required := doc.Schemas.Schemas["LockAllRequest"].Required
+	sort.Strings(required)
+	if !reflect.DeepEqual(required, []string{"keys", "ttl"}) {
+		t.Errorf("embedded fields were not inlined: %v", required)
+	}
+}
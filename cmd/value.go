@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+const DefaultMaxValueSize = 1 << 20
+
+var errValueTooLarge = errors.New("value too large")
+
+type typedValue struct {
+	Kind types.ValueKind
+	Data []byte
+	Int  int64
+}
+
+func stringValue(value string) typedValue {
+	return typedValue{Kind: types.ValueKindString, Data: []byte(value)}
+}
+
+func intValue(value int64) typedValue {
+	return typedValue{Kind: types.ValueKindInt, Int: value}
+}
+
+// parseValue validates data as a value of the given kind.
+func parseValue(kind types.ValueKind, data []byte) (typedValue, error) {
+	switch kind {
+	case types.ValueKindString, types.ValueKindBytes:
+		return typedValue{Kind: kind, Data: data}, nil
+	case types.ValueKindJSON:
+		if !json.Valid(data) {
+			return typedValue{}, errors.New("invalid json value")
+		}
+		return typedValue{Kind: kind, Data: data}, nil
+	case types.ValueKindInt:
+		i, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return typedValue{}, err
+		}
+		return intValue(i), nil
+	}
+	return typedValue{}, fmt.Errorf("unknown value kind: %s", kind)
+}
+
+// decodeValue is the inverse of encode and is used for values embedded in
+// JSON documents, where bytes travel base64 encoded.
+func decodeValue(kind types.ValueKind, value string) (typedValue, error) {
+	if kind == "" {
+		kind = types.ValueKindString
+	}
+	if kind == types.ValueKindBytes {
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return typedValue{}, err
+		}
+		return typedValue{Kind: kind, Data: data}, nil
+	}
+	return parseValue(kind, []byte(value))
+}
+
+// encode returns the value as it is reported in JSON responses.
+func (v typedValue) encode() string {
+	switch v.Kind {
+	case types.ValueKindInt:
+		return strconv.FormatInt(v.Int, 10)
+	case types.ValueKindBytes:
+		return base64.StdEncoding.EncodeToString(v.Data)
+	}
+	return string(v.Data)
+}
+
+// raw returns the value as it is sent in request and response bodies.
+func (v typedValue) raw() []byte {
+	if v.Kind == types.ValueKindInt {
+		return []byte(strconv.FormatInt(v.Int, 10))
+	}
+	return v.Data
+}
+
+func (v typedValue) size() int {
+	if v.Kind == types.ValueKindInt {
+		return 8
+	}
+	return len(v.Data)
+}
+
+// asInt interprets the value as a counter. Empty values count as zero so
+// that keys created without a value can be used as counters.
+func (v typedValue) asInt() (int64, error) {
+	if v.Kind == types.ValueKindInt {
+		return v.Int, nil
+	}
+	if len(v.Data) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(v.Data), 10, 64)
+}
+
+func kindFromContentType(contentType string) (types.ValueKind, error) {
+	if contentType == "" {
+		return types.ValueKindString, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return types.ValueKindString, nil
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		// what curl -d sends by default, the body is kept as is
+		return types.ValueKindString, nil
+	case "application/json":
+		return types.ValueKindJSON, nil
+	case "application/octet-stream":
+		return types.ValueKindBytes, nil
+	case types.ContentTypeInt:
+		return types.ValueKindInt, nil
+	}
+
+	return "", fmt.Errorf("unsupported content type: %s", mediaType)
+}
+
+func contentTypeOfKind(kind types.ValueKind) string {
+	switch kind {
+	case types.ValueKindJSON:
+		return "application/json"
+	case types.ValueKindBytes:
+		return "application/octet-stream"
+	case types.ValueKindInt:
+		return types.ContentTypeInt
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// readValue reads the value of a write request. The value is taken from the
+// request body, typed by its Content-Type or the kind query parameter, or
+// from the legacy value query parameter, which is a string unless kind says
+// otherwise.
+func readValue(r *http.Request, maxSize int64) (typedValue, error) {
+	query := r.URL.Query()
+	kind := types.ValueKind(query.Get("kind"))
+
+	if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+		value := query.Get("value")
+		if int64(len(value)) > maxSize {
+			return typedValue{}, errValueTooLarge
+		}
+		return decodeValue(kind, value)
+	}
+
+	if kind == "" {
+		var err error
+		kind, err = kindFromContentType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return typedValue{}, err
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		return typedValue{}, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return typedValue{}, errValueTooLarge
+	}
+
+	return parseValue(kind, data)
+}
+
+// valueError writes err with the status code matching it.
+func valueError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errValueTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DENKweit/distlock/types"
+)
+
+// send posts body with the given content type and returns the status code.
+func send(t *testing.T, ts *httptest.Server, path string, contentType string, body []byte) int {
+	t.Helper()
+
+	resp, err := ts.Client().Post(ts.URL+path, contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTypedValues(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	blob := []byte{0, 1, 0xfe, 0xff, '\n'}
+	for _, tc := range []struct {
+		key, contentType string
+		body             []byte
+		kind             types.ValueKind
+		value            string
+	}{
+		{"text", "text/plain", []byte("hello"), types.ValueKindString, "hello"},
+		{"form", "application/x-www-form-urlencoded", []byte("a=1&b=2"), types.ValueKindString, "a=1&b=2"},
+		{"doc", "application/json; charset=utf-8", []byte(`{"a":[1,2]}`), types.ValueKindJSON, `{"a":[1,2]}`},
+		{"blob", "application/octet-stream", blob, types.ValueKindBytes, base64.StdEncoding.EncodeToString(blob)},
+		{"counter", types.ContentTypeInt, []byte("-42"), types.ValueKindInt, "-42"},
+	} {
+		if code := send(t, ts, "/kv/set/"+tc.key, tc.contentType, tc.body); code != http.StatusOK {
+			t.Fatalf("%s: set got %d", tc.key, code)
+		}
+
+		get := types.GetReturn{}
+		call(t, ts, http.MethodGet, "/kv/get/"+tc.key, "", &get)
+		if !get.Success || get.Kind != string(tc.kind) || get.Value != tc.value {
+			t.Errorf("%s: got %+v, want %s %q", tc.key, get, tc.kind, tc.value)
+		}
+
+		resp, err := ts.Client().Get(ts.URL + "/kv/get/" + tc.key + "?raw=true")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, tc.body) || resp.Header.Get(types.HeaderValueKind) != string(tc.kind) || resp.Header.Get("Content-Type") != contentTypeOfKind(tc.kind) {
+			t.Errorf("%s: raw get returned %q as %s %s", tc.key, data, resp.Header.Get("Content-Type"), resp.Header.Get(types.HeaderValueKind))
+		}
+	}
+
+	// the kind parameter types query values and overrides the content type
+	call(t, ts, http.MethodPost, "/kv/set/q?kind=int&value=7", "", nil)
+	send(t, ts, "/kv/set/b?kind=bytes", "text/plain", []byte("raw"))
+	for key, kind := range map[string]types.ValueKind{"q": types.ValueKindInt, "b": types.ValueKindBytes} {
+		get := types.GetReturn{}
+		call(t, ts, http.MethodGet, "/kv/get/"+key, "", &get)
+		if get.Kind != string(kind) {
+			t.Errorf("%s: got kind %s, want %s", key, get.Kind, kind)
+		}
+	}
+
+	// counters operate on int values without reparsing strings
+	ret := types.IntReturn{}
+	call(t, ts, http.MethodPost, "/int/counter?op=inc", "", &ret)
+	if !ret.Success || ret.Value != -41 {
+		t.Fatalf("increment of an int value: %+v", ret)
+	}
+}
+
+func TestInvalidTypedValues(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+
+	for _, tc := range []struct {
+		name, path, contentType string
+		body                    string
+	}{
+		{"invalid json", "/kv/set/k", "application/json", `{"a":`},
+		{"invalid int", "/kv/set/k", types.ContentTypeInt, "12x"},
+		{"unsupported content type", "/kv/set/k", "image/png", "png"},
+		{"malformed content type", "/kv/set/k", "text/", "x"},
+		{"invalid base64", "/kv/set/k?kind=bytes&value=" + url.QueryEscape("not base64!"), "", ""},
+		{"unknown kind", "/kv/set/k?kind=float&value=1.5", "", ""},
+	} {
+		if code := send(t, ts, tc.path, tc.contentType, []byte(tc.body)); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", tc.name, code, http.StatusBadRequest)
+		}
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/k", "", &get)
+	if get.Success {
+		t.Fatalf("invalid value was stored: %+v", get)
+	}
+}
+
+func TestValueSizeLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxValueSize = 8
+	ts := newTestServer(t, config)
+
+	if code := send(t, ts, "/kv/set/k", "application/octet-stream", make([]byte, 8)); code != http.StatusOK {
+		t.Fatalf("value of the maximum size got %d", code)
+	}
+
+	for _, tc := range []struct {
+		name, path, contentType string
+		body                    string
+	}{
+		{"body", "/kv/set/k", "text/plain", "123456789"},
+		{"query value", "/kv/set/k?value=123456789", "", ""},
+		{"acquire value", "/kv/acquire/l/10s?value=123456789", "", ""},
+		{"queue item", "/queue/push/q", "text/plain", "123456789"},
+	} {
+		if code := send(t, ts, tc.path, tc.contentType, []byte(tc.body)); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: got %d, want %d", tc.name, code, http.StatusRequestEntityTooLarge)
+		}
+	}
+
+	get := types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/k", "", &get)
+	if get.Value != base64.StdEncoding.EncodeToString(make([]byte, 8)) {
+		t.Fatalf("refused value replaced the stored one: %+v", get)
+	}
+	get = types.GetReturn{}
+	call(t, ts, http.MethodGet, "/kv/get/l", "", &get)
+	if get.Success {
+		t.Fatalf("acquire with a refused value created the key: %+v", get)
+	}
+}
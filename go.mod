@@ -1,8 +1,17 @@
 module github.com/DENKweit/distlock
 
-go 1.16
+go 1.19
 
 require (
-	github.com/go-chi/chi v1.5.4 // indirect
-	github.com/lucsky/cuid v1.0.2 // indirect
+	github.com/go-chi/chi v1.5.4
+	github.com/lucsky/cuid v1.0.2
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
 )
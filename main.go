@@ -2,13 +2,118 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"strings"
 
+	"github.com/DENKweit/distlock/cli"
 	"github.com/DENKweit/distlock/cmd"
 )
 
 func main() {
-	var port int
-	flag.IntVar(&port, "port", 9876, "set port")
-	flag.Parse()
-	cmd.Start(port)
+	args := os.Args[1:]
+
+	// without a subcommand the server is started, as before subcommands
+	// existed
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		server(args)
+		return
+	}
+
+	switch args[0] {
+	case "server":
+		server(args[1:])
+	case "config":
+		if len(args) < 2 || args[1] != "check" {
+			fmt.Fprintln(os.Stderr, "usage: distlock config check [-config FILE] [server flags]")
+			os.Exit(2)
+		}
+		configCheck(args[2:])
+	default:
+		os.Exit(cli.Run(args))
+	}
+}
+
+// configPath finds the -config flag before the other flags are parsed, as
+// the file provides their defaults.
+func configPath(args []string) string {
+	for idx, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "config" && idx+1 < len(args) {
+			return args[idx+1]
+		}
+		if strings.HasPrefix(name, "config=") && arg != name {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+	return os.Getenv(cmd.EnvConfigFile)
+}
+
+// loadConfig loads the configuration file and environment and applies the
+// server flags on top. It exits on invalid flags.
+func loadConfig(name string, args []string) (cmd.Config, error) {
+	path := configPath(args)
+	config, loadErr := cmd.LoadConfig(path)
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.String("config", path, "TOML configuration file, also read from $"+cmd.EnvConfigFile)
+	flags.IntVar(&config.Port, "port", config.Port, "set port")
+	flags.StringVar(&config.Listen, "listen", config.Listen, "address to listen on, overrides -port")
+	flags.Int64Var(&config.MaxValueSize, "max-value-size", config.MaxValueSize, "maximum size of a single value in bytes")
+	flags.StringVar(&config.AuthFile, "auth-file", config.AuthFile, "JSON file with API tokens and their ACLs, enables authentication")
+	flags.StringVar(&config.TLSCertFile, "tls-cert", config.TLSCertFile, "server certificate file (PEM), enables TLS")
+	flags.StringVar(&config.TLSKeyFile, "tls-key", config.TLSKeyFile, "server private key file (PEM)")
+	flags.StringVar(&config.TLSClientCAFile, "tls-client-ca", config.TLSClientCAFile, "CA bundle (PEM) for verifying client certificates, enables mutual TLS")
+	flags.StringVar(&config.AuditLog, "audit-log", config.AuditLog, "file to append the audit log to as JSON lines, - for stdout")
+	flags.StringVar(&config.TraceExporter, "trace-exporter", config.TraceExporter, "export trace spans to an OTLP/HTTP collector URL, a file or - for stdout")
+	flags.StringVar(&config.LogFormat, "log-format", config.LogFormat, "log format, json or logfmt")
+	flags.StringVar(&config.LogLevel, "log-level", config.LogLevel, "minimum log level: debug, info, warn or error")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "how long in-flight requests may take to finish on SIGTERM")
+	flags.DurationVar(&config.MinTTL, "min-ttl", config.MinTTL, "minimum session and lease TTL")
+	flags.DurationVar(&config.MaxTTL, "max-ttl", config.MaxTTL, "maximum session and lease TTL, 0 for no limit")
+	flags.StringVar(&config.RESPListen, "resp-listen", config.RESPListen, "address to serve the Redis protocol on, e.g. :6379")
+	flags.StringVar(&config.GRPCListen, "grpc-listen", config.GRPCListen, "address to serve gRPC on, e.g. :9877")
+	flags.Parse(args)
+
+	errs := cmd.ConfigErrors{}
+	if loadErr != nil {
+		if list, ok := loadErr.(cmd.ConfigErrors); ok {
+			errs = append(errs, list...)
+		} else {
+			return config, loadErr
+		}
+	}
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err.(cmd.ConfigErrors)...)
+	}
+
+	if len(errs) > 0 {
+		return config, errs
+	}
+	return config, nil
+}
+
+func server(args []string) {
+	config, err := loadConfig("server", args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		os.Exit(2)
+	}
+
+	cmd.Start(config)
+}
+
+// configCheck validates the configuration the server would start with and
+// prints it.
+func configCheck(args []string) {
+	config, err := loadConfig("config check", args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		os.Exit(1)
+	}
+
+	config.WriteTOML(os.Stdout)
 }
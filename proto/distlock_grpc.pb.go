@@ -0,0 +1,654 @@
+// Service definition of the gRPC interface to distlock, mirroring the /v1
+// HTTP API. The server serves it on grpc.listen over the same state as the
+// HTTP API, the api package uses it when created with WithGRPC.
+//
+// Requests select the namespace with the x-distlock-namespace metadata and
+// authenticate with "authorization: Bearer <token>" or a client
+// certificate, like HTTP requests.
+//
+// Regenerate the Go code with go generate in this directory.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: distlock.proto
+
+package distlockpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Distlock_Get_FullMethodName            = "/distlock.v1.Distlock/Get"
+	Distlock_Set_FullMethodName            = "/distlock.v1.Distlock/Set"
+	Distlock_Delete_FullMethodName         = "/distlock.v1.Distlock/Delete"
+	Distlock_ListKeys_FullMethodName       = "/distlock.v1.Distlock/ListKeys"
+	Distlock_Watch_FullMethodName          = "/distlock.v1.Distlock/Watch"
+	Distlock_Acquire_FullMethodName        = "/distlock.v1.Distlock/Acquire"
+	Distlock_Release_FullMethodName        = "/distlock.v1.Distlock/Release"
+	Distlock_Renew_FullMethodName          = "/distlock.v1.Distlock/Renew"
+	Distlock_DestroySession_FullMethodName = "/distlock.v1.Distlock/DestroySession"
+	Distlock_KeepAlive_FullMethodName      = "/distlock.v1.Distlock/KeepAlive"
+	Distlock_Lock_FullMethodName           = "/distlock.v1.Distlock/Lock"
+	Distlock_Unlock_FullMethodName         = "/distlock.v1.Distlock/Unlock"
+	Distlock_Int_FullMethodName            = "/distlock.v1.Distlock/Int"
+)
+
+// DistlockClient is the client API for Distlock service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DistlockClient interface {
+	// kv
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SuccessResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*SuccessResponse, error)
+	ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error)
+	// Watch streams the value of a key whenever it changes, starting with
+	// the current value.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Distlock_WatchClient, error)
+	// locks and sessions
+	Acquire(ctx context.Context, in *AcquireRequest, opts ...grpc.CallOption) (*AcquireResponse, error)
+	Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*SuccessResponse, error)
+	Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*RenewResponse, error)
+	DestroySession(ctx context.Context, in *DestroySessionRequest, opts ...grpc.CallOption) (*SuccessResponse, error)
+	// KeepAlive renews the session on every request sent. The server answers
+	// each renewal and ends the stream once the session is gone, closing the
+	// stream from the client does not release the session.
+	KeepAlive(ctx context.Context, opts ...grpc.CallOption) (Distlock_KeepAliveClient, error)
+	// mutexes, Lock blocks until the mutex is locked or the timeout passed
+	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*SuccessResponse, error)
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*SuccessResponse, error)
+	// counters
+	Int(ctx context.Context, in *IntRequest, opts ...grpc.CallOption) (*IntResponse, error)
+}
+
+type distlockClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDistlockClient(cc grpc.ClientConnInterface) DistlockClient {
+	return &distlockClient{cc}
+}
+
+func (c *distlockClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, Distlock_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SuccessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SuccessResponse)
+	err := c.cc.Invoke(ctx, Distlock_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*SuccessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SuccessResponse)
+	err := c.cc.Invoke(ctx, Distlock_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListKeysResponse)
+	err := c.cc.Invoke(ctx, Distlock_ListKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Distlock_WatchClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Distlock_ServiceDesc.Streams[0], Distlock_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &distlockWatchClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Distlock_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type distlockWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *distlockWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *distlockClient) Acquire(ctx context.Context, in *AcquireRequest, opts ...grpc.CallOption) (*AcquireResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AcquireResponse)
+	err := c.cc.Invoke(ctx, Distlock_Acquire_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*SuccessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SuccessResponse)
+	err := c.cc.Invoke(ctx, Distlock_Release_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*RenewResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenewResponse)
+	err := c.cc.Invoke(ctx, Distlock_Renew_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) DestroySession(ctx context.Context, in *DestroySessionRequest, opts ...grpc.CallOption) (*SuccessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SuccessResponse)
+	err := c.cc.Invoke(ctx, Distlock_DestroySession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) KeepAlive(ctx context.Context, opts ...grpc.CallOption) (Distlock_KeepAliveClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Distlock_ServiceDesc.Streams[1], Distlock_KeepAlive_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &distlockKeepAliveClient{ClientStream: stream}
+	return x, nil
+}
+
+type Distlock_KeepAliveClient interface {
+	Send(*KeepAliveRequest) error
+	Recv() (*KeepAliveResponse, error)
+	grpc.ClientStream
+}
+
+type distlockKeepAliveClient struct {
+	grpc.ClientStream
+}
+
+func (x *distlockKeepAliveClient) Send(m *KeepAliveRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *distlockKeepAliveClient) Recv() (*KeepAliveResponse, error) {
+	m := new(KeepAliveResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *distlockClient) Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*SuccessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SuccessResponse)
+	err := c.cc.Invoke(ctx, Distlock_Lock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*SuccessResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SuccessResponse)
+	err := c.cc.Invoke(ctx, Distlock_Unlock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distlockClient) Int(ctx context.Context, in *IntRequest, opts ...grpc.CallOption) (*IntResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IntResponse)
+	err := c.cc.Invoke(ctx, Distlock_Int_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DistlockServer is the server API for Distlock service.
+// All implementations must embed UnimplementedDistlockServer
+// for forward compatibility
+type DistlockServer interface {
+	// kv
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Set(context.Context, *SetRequest) (*SuccessResponse, error)
+	Delete(context.Context, *DeleteRequest) (*SuccessResponse, error)
+	ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error)
+	// Watch streams the value of a key whenever it changes, starting with
+	// the current value.
+	Watch(*WatchRequest, Distlock_WatchServer) error
+	// locks and sessions
+	Acquire(context.Context, *AcquireRequest) (*AcquireResponse, error)
+	Release(context.Context, *ReleaseRequest) (*SuccessResponse, error)
+	Renew(context.Context, *RenewRequest) (*RenewResponse, error)
+	DestroySession(context.Context, *DestroySessionRequest) (*SuccessResponse, error)
+	// KeepAlive renews the session on every request sent. The server answers
+	// each renewal and ends the stream once the session is gone, closing the
+	// stream from the client does not release the session.
+	KeepAlive(Distlock_KeepAliveServer) error
+	// mutexes, Lock blocks until the mutex is locked or the timeout passed
+	Lock(context.Context, *LockRequest) (*SuccessResponse, error)
+	Unlock(context.Context, *UnlockRequest) (*SuccessResponse, error)
+	// counters
+	Int(context.Context, *IntRequest) (*IntResponse, error)
+	mustEmbedUnimplementedDistlockServer()
+}
+
+// UnimplementedDistlockServer must be embedded to have forward compatible implementations.
+type UnimplementedDistlockServer struct {
+}
+
+func (UnimplementedDistlockServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedDistlockServer) Set(context.Context, *SetRequest) (*SuccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedDistlockServer) Delete(context.Context, *DeleteRequest) (*SuccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedDistlockServer) ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKeys not implemented")
+}
+func (UnimplementedDistlockServer) Watch(*WatchRequest, Distlock_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedDistlockServer) Acquire(context.Context, *AcquireRequest) (*AcquireResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Acquire not implemented")
+}
+func (UnimplementedDistlockServer) Release(context.Context, *ReleaseRequest) (*SuccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Release not implemented")
+}
+func (UnimplementedDistlockServer) Renew(context.Context, *RenewRequest) (*RenewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Renew not implemented")
+}
+func (UnimplementedDistlockServer) DestroySession(context.Context, *DestroySessionRequest) (*SuccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DestroySession not implemented")
+}
+func (UnimplementedDistlockServer) KeepAlive(Distlock_KeepAliveServer) error {
+	return status.Errorf(codes.Unimplemented, "method KeepAlive not implemented")
+}
+func (UnimplementedDistlockServer) Lock(context.Context, *LockRequest) (*SuccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lock not implemented")
+}
+func (UnimplementedDistlockServer) Unlock(context.Context, *UnlockRequest) (*SuccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unlock not implemented")
+}
+func (UnimplementedDistlockServer) Int(context.Context, *IntRequest) (*IntResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Int not implemented")
+}
+func (UnimplementedDistlockServer) mustEmbedUnimplementedDistlockServer() {}
+
+// UnsafeDistlockServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DistlockServer will
+// result in compilation errors.
+type UnsafeDistlockServer interface {
+	mustEmbedUnimplementedDistlockServer()
+}
+
+func RegisterDistlockServer(s grpc.ServiceRegistrar, srv DistlockServer) {
+	s.RegisterService(&Distlock_ServiceDesc, srv)
+}
+
+func _Distlock_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_ListKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).ListKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_ListKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).ListKeys(ctx, req.(*ListKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DistlockServer).Watch(m, &distlockWatchServer{ServerStream: stream})
+}
+
+type Distlock_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type distlockWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *distlockWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Distlock_Acquire_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcquireRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Acquire(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Acquire_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Acquire(ctx, req.(*AcquireRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Release_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Release(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Release_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Release(ctx, req.(*ReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Renew_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Renew(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Renew_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Renew(ctx, req.(*RenewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_DestroySession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DestroySessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).DestroySession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_DestroySession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).DestroySession(ctx, req.(*DestroySessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_KeepAlive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DistlockServer).KeepAlive(&distlockKeepAliveServer{ServerStream: stream})
+}
+
+type Distlock_KeepAliveServer interface {
+	Send(*KeepAliveResponse) error
+	Recv() (*KeepAliveRequest, error)
+	grpc.ServerStream
+}
+
+type distlockKeepAliveServer struct {
+	grpc.ServerStream
+}
+
+func (x *distlockKeepAliveServer) Send(m *KeepAliveResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *distlockKeepAliveServer) Recv() (*KeepAliveRequest, error) {
+	m := new(KeepAliveRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Distlock_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Lock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Lock(ctx, req.(*LockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Unlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Unlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Unlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Unlock(ctx, req.(*UnlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Distlock_Int_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IntRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistlockServer).Int(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Distlock_Int_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistlockServer).Int(ctx, req.(*IntRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Distlock_ServiceDesc is the grpc.ServiceDesc for Distlock service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Distlock_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "distlock.v1.Distlock",
+	HandlerType: (*DistlockServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Distlock_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _Distlock_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Distlock_Delete_Handler,
+		},
+		{
+			MethodName: "ListKeys",
+			Handler:    _Distlock_ListKeys_Handler,
+		},
+		{
+			MethodName: "Acquire",
+			Handler:    _Distlock_Acquire_Handler,
+		},
+		{
+			MethodName: "Release",
+			Handler:    _Distlock_Release_Handler,
+		},
+		{
+			MethodName: "Renew",
+			Handler:    _Distlock_Renew_Handler,
+		},
+		{
+			MethodName: "DestroySession",
+			Handler:    _Distlock_DestroySession_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _Distlock_Lock_Handler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    _Distlock_Unlock_Handler,
+		},
+		{
+			MethodName: "Int",
+			Handler:    _Distlock_Int_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Distlock_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "KeepAlive",
+			Handler:       _Distlock_KeepAlive_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "distlock.proto",
+}
@@ -0,0 +1,5 @@
+// Package distlockpb contains the generated code of the distlock gRPC
+// service.
+package distlockpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative distlock.proto
@@ -0,0 +1,189 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WriterExporter writes every span as a line of JSON.
+type WriterExporter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+func (e *WriterExporter) Export(span SpanData) {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.w.Write(append(data, '\n'))
+}
+
+// OTLPExporter sends spans in batches to an OTLP/HTTP collector using the
+// JSON encoding, e.g. http://localhost:4318/v1/traces.
+type OTLPExporter struct {
+	Endpoint   string
+	Service    string
+	HTTPClient *http.Client
+
+	lock    sync.Mutex
+	pending []SpanData
+	flush   chan struct{}
+	done    chan struct{}
+}
+
+const otlpBatchSize = 128
+
+func NewOTLPExporter(endpoint string, service string) *OTLPExporter {
+	e := &OTLPExporter{
+		Endpoint:   endpoint,
+		Service:    service,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *OTLPExporter) Export(span SpanData) {
+	e.lock.Lock()
+	e.pending = append(e.pending, span)
+	full := len(e.pending) >= otlpBatchSize
+	e.lock.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown sends the remaining spans and stops the exporter.
+func (e *OTLPExporter) Shutdown() {
+	close(e.done)
+	e.send()
+}
+
+func (e *OTLPExporter) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.done:
+			return
+		}
+		e.send()
+	}
+}
+
+func (e *OTLPExporter) send() {
+	e.lock.Lock()
+	spans := e.pending
+	e.pending = nil
+	e.lock.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(otlpRequest(e.Service, spans))
+	if err != nil {
+		return
+	}
+
+	resp, err := e.HTTPClient.Post(e.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+var otlpKinds = map[SpanKind]int{
+	SpanKindInternal: 1,
+	SpanKindServer:   2,
+	SpanKindClient:   3,
+}
+
+func otlpRequest(service string, spans []SpanData) interface{} {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpKinds[span.Kind],
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		for k, v := range span.Attributes {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		converted = append(converted, s)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{
+						{Key: "service.name", Value: otlpValue{StringValue: service}},
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/DENKweit/distlock/trace"},
+						"spans": converted,
+					},
+				},
+			},
+		},
+	}
+}
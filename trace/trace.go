@@ -0,0 +1,266 @@
+// Package trace implements the small subset of distributed tracing needed by
+// distlock: W3C trace-context propagation, spans and exporters writing JSON
+// lines or OTLP/HTTP JSON to a collector.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C trace-context header.
+const TraceparentHeader = "traceparent"
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a version 00 traceparent header value.
+func ParseTraceparent(value string) (SpanContext, error) {
+	sc := SpanContext{}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errors.New("invalid traceparent")
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errors.New("invalid traceparent")
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, errors.New("invalid trace id")
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, errors.New("invalid span id")
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, errors.New("invalid trace flags")
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return sc, errors.New("invalid traceparent")
+	}
+
+	return sc, nil
+}
+
+type SpanKind string
+
+const (
+	SpanKindInternal SpanKind = "internal"
+	SpanKindServer   SpanKind = "server"
+	SpanKindClient   SpanKind = "client"
+)
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	TraceID      string            `json:"traceId"`
+	SpanID       string            `json:"spanId"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer creates spans and hands them to its exporter when they end. A nil
+// *Tracer is valid and creates spans that are never exported.
+type Tracer struct {
+	Service  string
+	exporter Exporter
+}
+
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{
+		Service:  service,
+		exporter: exporter,
+	}
+}
+
+// Shutdown flushes the spans the exporter has buffered, if it buffers any.
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+	if exporter, ok := t.exporter.(interface{ Shutdown() }); ok {
+		exporter.Shutdown()
+	}
+}
+
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+
+	lock sync.Mutex
+	data SpanData
+	done bool
+}
+
+type spanContextKey struct{}
+
+type remoteContextKey struct{}
+
+// Start starts a span as a child of the span or remote span context in ctx.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Start:      time.Now(),
+			Attributes: map[string]string{},
+		},
+	}
+
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = true
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+func (s *Span) SetName(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data.Name = name
+}
+
+func (s *Span) SetAttribute(key string, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span as failed. A nil error is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and exports it. Calling End more than once has no
+// effect.
+func (s *Span) End() {
+	s.lock.Lock()
+	if s.done {
+		s.lock.Unlock()
+		return
+	}
+	s.done = true
+	s.data.End = time.Now()
+	s.data.TraceID = s.context.TraceID.String()
+	s.data.SpanID = s.context.SpanID.String()
+	if s.parent != (SpanID{}) {
+		s.data.ParentSpanID = s.parent.String()
+	}
+	data := s.data
+	s.lock.Unlock()
+
+	if s.tracer != nil && s.tracer.exporter != nil && s.context.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// SpanFromContext returns the current span, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the span context of the current span, or
+// of the remote parent extracted from an incoming request.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.context
+	}
+	sc, _ := ctx.Value(remoteContextKey{}).(SpanContext)
+	return sc
+}
+
+// Inject writes the current span context to the traceparent header.
+func Inject(ctx context.Context, header http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		header.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
+
+// ContextWithSpanContext returns ctx with sc as remote parent, e.g. to
+// continue a trace in a timer that outlives the request that started it.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// Extract returns ctx with the span context of the traceparent header as
+// remote parent. Invalid headers are ignored.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
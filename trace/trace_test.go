@@ -0,0 +1,185 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type recorder struct {
+	lock  sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(span SpanData) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.spans = append(r.spans, span)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("parsed %+v", sc)
+	}
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("formatted as %s", got)
+	}
+
+	// later versions may add fields
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Fatalf("future version: %v", err)
+	}
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		if sc, err := ParseTraceparent(value); err == nil {
+			t.Errorf("%q: got %+v, want an error", value, sc)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	exporter := &recorder{}
+	tracer := NewTracer("test", exporter)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	child.SetAttribute("k", "v")
+	child.SetError(errors.New("failed"))
+	child.SetError(nil)
+	child.End()
+	child.End()
+	parent.SetName("renamed")
+	parent.End()
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exporter.spans))
+	}
+	c, p := exporter.spans[0], exporter.spans[1]
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID || p.ParentSpanID != "" {
+		t.Fatalf("child %+v is not in the trace of %+v", c, p)
+	}
+	if c.Attributes["k"] != "v" || c.Error != "failed" || c.End.Before(c.Start) {
+		t.Fatalf("child %+v", c)
+	}
+	if p.Name != "renamed" || p.Kind != SpanKindServer {
+		t.Fatalf("parent %+v", p)
+	}
+
+	// an unsampled remote parent is propagated but not exported
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(ContextWithSpanContext(context.Background(), remote), "unsampled", SpanKindServer)
+	span.End()
+	if len(exporter.spans) != 2 || span.Context().TraceID != remote.TraceID {
+		t.Fatal("unsampled span was exported")
+	}
+
+	// a nil tracer creates spans that go nowhere
+	var none *Tracer
+	_, span = none.Start(context.Background(), "nowhere", SpanKindInternal)
+	span.End()
+	none.Shutdown()
+}
+
+func TestPropagation(t *testing.T) {
+	tracer := NewTracer("test", &recorder{})
+	ctx, span := tracer.Start(context.Background(), "client", SpanKindClient)
+
+	header := http.Header{}
+	Inject(ctx, header)
+	if header.Get(TraceparentHeader) != span.Context().Traceparent() {
+		t.Fatalf("injected %q", header.Get(TraceparentHeader))
+	}
+
+	remote := Extract(context.Background(), header)
+	if SpanContextFromContext(remote) != span.Context() {
+		t.Fatal("extracted span context differs")
+	}
+
+	header.Set(TraceparentHeader, "garbage")
+	if sc := SpanContextFromContext(Extract(context.Background(), header)); sc.IsValid() {
+		t.Fatalf("invalid header extracted %+v", sc)
+	}
+
+	header = http.Header{}
+	Inject(context.Background(), header)
+	if len(header) != 0 {
+		t.Fatalf("nothing to inject wrote %v", header)
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	buf := bytes.Buffer{}
+	tracer := NewTracer("test", NewWriterExporter(&buf))
+
+	_, span := tracer.Start(context.Background(), "op", SpanKindInternal)
+	span.End()
+
+	data := SpanData{}
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		t.Fatalf("%s: %v", buf.Bytes(), err)
+	}
+	if data.Name != "op" || data.SpanID != span.Context().SpanID.String() || buf.Bytes()[buf.Len()-1] != '\n' {
+		t.Fatalf("wrote %s", buf.Bytes())
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan map[string]interface{}, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- body
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer("svc", NewOTLPExporter(collector.URL+"/v1/traces", "svc"))
+	_, span := tracer.Start(context.Background(), "op", SpanKindClient)
+	span.SetAttribute("k", "v")
+	span.SetError(errors.New("failed"))
+	span.End()
+	tracer.Shutdown()
+
+	body := <-requests
+	data, _ := json.Marshal(body)
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := resourceSpans["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "svc" {
+		t.Fatalf("no service name in %s", data)
+	}
+
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans in %s", len(spans), data)
+	}
+	got := spans[0].(map[string]interface{})
+	if got["name"] != "op" || got["kind"] != float64(3) || got["spanId"] != span.Context().SpanID.String() {
+		t.Fatalf("span %s", data)
+	}
+	if status := got["status"].(map[string]interface{}); status["code"] != float64(2) || status["message"] != "failed" {
+		t.Fatalf("status %s", data)
+	}
+}
@@ -1,22 +1,104 @@
 package types
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type AcquireReturn struct {
 	SessionID string `json:"sessionId"`
 	Success   bool   `json:"success"`
+	// Holds counts the acquisitions of a reentrant lock by its holder.
+	Holds int64 `json:"holds,omitempty"`
+	// ExpiresAt is when the session expires unless it is renewed, it is
+	// only set on success.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
+// ReleaseReturn reports the acquisitions of a reentrant lock still held,
+// the lock is free once Holds is zero.
 type ReleaseReturn struct {
-	Success bool `json:"success"`
+	Success bool  `json:"success"`
+	Holds   int64 `json:"holds"`
+}
+
+// AcquireAllRequest locks all Keys under one session or none of them.
+// Missing keys are created with Value. With Wait set the request blocks
+// until all keys are free, at most for Timeout if it is set. Counters that
+// are not in lock mode can never be acquired and fail the request.
+type AcquireAllRequest struct {
+	Keys    []string `json:"keys"`
+	Value   string   `json:"value,omitempty"`
+	Kind    string   `json:"kind,omitempty"`
+	Wait    bool     `json:"wait,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+// AcquireAllReturn lists the keys held by others if the keys could not be
+// acquired.
+type AcquireAllReturn struct {
+	SessionID string     `json:"sessionId"`
+	Success   bool       `json:"success"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Locked    []string   `json:"locked,omitempty"`
+}
+
+// ReleaseAllReturn reports the keys released together with the session.
+type ReleaseAllReturn struct {
+	Success  bool     `json:"success"`
+	Released []string `json:"released"`
 }
 
 type SetReturn struct {
 	Success bool `json:"success"`
 }
 
+type DeleteReturn struct {
+	Success bool `json:"success"`
+}
+
+// RenewReturn reports whether the session still existed and was renewed.
+type RenewReturn struct {
+	Success bool `json:"success"`
+	// ExpiresAt is the new expiry of the session, it is only set on
+	// success.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Keys lists the keys the session still holds locked. Keys that were
+	// deleted or force-released since they were acquired are missing.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// ValueKind tells how a value is stored and encoded. In JSON responses
+// bytes values are base64 encoded, all other kinds are sent as is.
+type ValueKind string
+
+const (
+	ValueKindString ValueKind = "string"
+	ValueKindInt    ValueKind = "int"
+	ValueKindJSON   ValueKind = "json"
+	ValueKindBytes  ValueKind = "bytes"
+)
+
+// ContentTypeInt is the content type of int values sent in request bodies.
+const ContentTypeInt = "application/x-distlock-int"
+
+// HeaderValueKind carries the kind of raw values returned by /kv/get.
+const HeaderValueKind = "X-Distlock-Kind"
+
+// HeaderError carries a machine readable reason for error responses.
+const HeaderError = "X-Distlock-Error"
+
+// ErrorShuttingDown is sent in HeaderError when a request was aborted
+// because the server is shutting down. Such requests can be retried.
+const ErrorShuttingDown = "shutting-down"
+
 type GetReturn struct {
 	Success bool   `json:"success"`
 	Key     string `json:"key"`
 	Value   string `json:"value"`
+	Kind    string `json:"kind"`
+	// Locked is true while a session holds the key.
+	Locked bool `json:"locked"`
 }
 
 type GetMRequest struct {
@@ -26,6 +108,7 @@ type GetMRequest struct {
 type KeyValue struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	Kind  string `json:"kind,omitempty"`
 }
 
 type KeyValueSuccess struct {
@@ -47,12 +130,58 @@ type SetMReturn struct {
 
 type StatusReturn struct {
 	Running bool `json:"running"`
+	// Ready is false once the server is shutting down.
+	Ready     bool      `json:"ready"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"startedAt"`
+	// Uptime, like all durations in responses, is in nanoseconds.
+	Uptime time.Duration `json:"uptime"`
+
+	Namespaces  int64 `json:"namespaces"`
+	Keys        int64 `json:"keys"`
+	Sessions    int64 `json:"sessions"`
+	LocksHeld   int64 `json:"locksHeld"`
+	MutexesHeld int64 `json:"mutexesHeld"`
+	QueueItems  int64 `json:"queueItems"`
+	// BlockedWaiters counts requests blocked on a mutex or an empty queue.
+	BlockedWaiters int64 `json:"blockedWaiters"`
+
+	Memory      MemoryStatus      `json:"memory"`
+	Persistence PersistenceStatus `json:"persistence"`
+	Replication ReplicationStatus `json:"replication"`
+}
+
+type MemoryStatus struct {
+	// Alloc is the number of bytes of allocated heap objects.
+	Alloc uint64 `json:"alloc"`
+	// Sys is the number of bytes obtained from the operating system.
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"numGC"`
+	Goroutines int    `json:"goroutines"`
+}
+
+type PersistenceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+type ReplicationStatus struct {
+	Enabled bool `json:"enabled"`
+	// Mode is standalone unless the server runs in a cluster.
+	Mode   string `json:"mode"`
+	Leader string `json:"leader,omitempty"`
+}
+
+// HealthReturn is returned by the /healthz and /readyz probes.
+type HealthReturn struct {
+	Status string `json:"status"`
 }
 
 type IntReturn struct {
-	Value   int64  `json:"value"`
-	Success bool   `json:"success"`
-	Op      string `json:"op"`
+	Value    int64  `json:"value"`
+	Previous int64  `json:"previous"`
+	Success  bool   `json:"success"`
+	Op       string `json:"op"`
+	Mode     string `json:"mode"`
 }
 
 type IntOpType string
@@ -62,8 +191,239 @@ const (
 	IntOpTypeDec IntOpType = "dec"
 	IntOpTypeSet IntOpType = "set"
 	IntOpTypeGet IntOpType = "get"
+
+	IntOpTypeAdd    IntOpType = "add"
+	IntOpTypeCAS    IntOpType = "cas"
+	IntOpTypeGetSet IntOpType = "getset"
+	IntOpTypeReset  IntOpType = "reset"
+	IntOpTypeCreate IntOpType = "create"
+	// IntOpTypeBounds replaces the min and max of a counter, a missing
+	// limit removes it. Other operations never change the bounds.
+	IntOpTypeBounds IntOpType = "bounds"
+)
+
+// IntMode decides who may change a counter. It is chosen when the counter
+// is created and cannot be changed afterwards.
+type IntMode string
+
+const (
+	// IntModePublic counters can be changed by anyone.
+	IntModePublic IntMode = "public"
+	// IntModeLock counters can only be changed by the session holding the
+	// lock on the counter's key. The value survives the lock being
+	// released or expiring.
+	IntModeLock IntMode = "lock"
+	// IntModeSession counters can only be changed by the session that
+	// created them and are removed when that session ends.
+	IntModeSession IntMode = "session"
 )
 
 type MutexReturn struct {
 	Success bool `json:"success"`
 }
+
+type QueuePushReturn struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+}
+
+type QueuePopReturn struct {
+	ID string `json:"id"`
+	// Receipt identifies this lease, it is required to ack or nack the item.
+	Receipt string `json:"receipt"`
+	Value   string `json:"value"`
+	Kind    string `json:"kind"`
+	Success bool   `json:"success"`
+	// LeaseExpiresAt is when the item is requeued unless acknowledged.
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+}
+
+type QueueAckReturn struct {
+	Success bool `json:"success"`
+}
+
+// JSONPatchOp is a single operation of a RFC 6902 JSON patch.
+type JSONPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type PatchReturn struct {
+	Success bool   `json:"success"`
+	Value   string `json:"value"`
+}
+
+// NamespaceQuota limits the resources of a namespace. Zero means unlimited.
+type NamespaceQuota struct {
+	MaxKeys       int64 `json:"maxKeys"`
+	MaxValueBytes int64 `json:"maxValueBytes"`
+	MaxSessions   int64 `json:"maxSessions"`
+}
+
+type NamespaceInfo struct {
+	Name       string         `json:"name"`
+	Quota      NamespaceQuota `json:"quota"`
+	Keys       int64          `json:"keys"`
+	ValueBytes int64          `json:"valueBytes"`
+	Sessions   int64          `json:"sessions"`
+}
+
+type NamespaceReturn struct {
+	Success   bool          `json:"success"`
+	Namespace NamespaceInfo `json:"namespace"`
+}
+
+type NamespacesReturn struct {
+	Namespaces []NamespaceInfo `json:"namespaces"`
+}
+
+type AuditAction string
+
+const (
+	AuditActionAcquire AuditAction = "acquire"
+	AuditActionRelease AuditAction = "release"
+	AuditActionRenew   AuditAction = "renew"
+	AuditActionExpire  AuditAction = "expire"
+	AuditActionDestroy AuditAction = "destroy"
+	AuditActionSet     AuditAction = "set"
+	AuditActionDelete  AuditAction = "delete"
+	// AuditActionForceRelease and AuditActionForceExpire are recorded
+	// when an admin releases a lock or expires a session of someone else.
+	AuditActionForceRelease AuditAction = "force-release"
+	AuditActionForceExpire  AuditAction = "force-expire"
+	// AuditActionRollback is recorded for keys restored because an
+	// atomic batch failed.
+	AuditActionRollback AuditAction = "rollback"
+)
+
+// AuditEntry records a change of ownership or value. Identity is the name
+// of the token or client certificate used for the request. For expiring
+// sessions it is the identity that created the session.
+type AuditEntry struct {
+	Time       time.Time   `json:"time"`
+	Action     AuditAction `json:"action"`
+	Namespace  string      `json:"namespace"`
+	Primitive  string      `json:"primitive"`
+	Key        string      `json:"key"`
+	SessionID  string      `json:"sessionId,omitempty"`
+	Identity   string      `json:"identity,omitempty"`
+	RemoteAddr string      `json:"remoteAddr,omitempty"`
+	Detail     string      `json:"detail,omitempty"`
+}
+
+type AuditReturn struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+type SessionInfo struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	// Keys lists all keys of a session locking several keys.
+	Keys      []string  `json:"keys,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// TTLRemaining is the time in nanoseconds left until the session
+	// expires unless it is renewed.
+	TTLRemaining time.Duration `json:"ttlRemaining"`
+}
+
+type SessionsReturn struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+type LockInfo struct {
+	// Primitive is kv for keys acquired with a session and mutex for
+	// mutexes.
+	Primitive string `json:"primitive"`
+	Key       string `json:"key"`
+	Owner     string `json:"owner,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	// Reentrant locks count their acquisitions by the holder in Holds.
+	Reentrant bool  `json:"reentrant,omitempty"`
+	Holds     int64 `json:"holds,omitempty"`
+	// Waiters counts requests blocked on the mutex.
+	Waiters int64 `json:"waiters"`
+}
+
+type LocksReturn struct {
+	Locks []LockInfo `json:"locks"`
+}
+
+type AdminReturn struct {
+	Success bool `json:"success"`
+}
+
+type PurgeReturn struct {
+	Success bool  `json:"success"`
+	Deleted int64 `json:"deleted"`
+}
+
+type BatchOpType string
+
+const (
+	BatchOpAcquire BatchOpType = "acquire"
+	BatchOpRelease BatchOpType = "release"
+	BatchOpRenew   BatchOpType = "renew"
+	BatchOpGet     BatchOpType = "get"
+	BatchOpSet     BatchOpType = "set"
+	BatchOpDelete  BatchOpType = "delete"
+	BatchOpInt     BatchOpType = "int"
+)
+
+// BatchOp is an operation of a batch. The fields used depend on Op:
+//
+//	acquire  key, ttl, value, kind
+//	release  key, sessionId
+//	renew    sessionId, ttl
+//	get      key
+//	set      key, value, kind, sessionId
+//	delete   key, sessionId
+//	int      key, intOp, int
+//
+// A sessionId of the form $N refers to the session acquired by the N-th
+// operation of the batch, counting from zero.
+type BatchOp struct {
+	Op        BatchOpType `json:"op"`
+	Key       string      `json:"key,omitempty"`
+	Value     string      `json:"value,omitempty"`
+	Kind      string      `json:"kind,omitempty"`
+	SessionID string      `json:"sessionId,omitempty"`
+	TTL       string      `json:"ttl,omitempty"`
+	IntOp     IntOpType   `json:"intOp,omitempty"`
+	// Int holds the operands, mode and ttl of an int operation, its
+	// sessionId defaults to the one of the operation.
+	Int *IntRequest `json:"int,omitempty"`
+}
+
+// BatchRequest runs Ops in order. An operation fails if its request fails
+// or it changes state and reports no success, like an acquire of a held
+// key. Reads never fail the batch, a get of a missing key only reports no
+// success in its result. An atomic batch stops at the first failed
+// operation and undoes the ones before it, no other request sees its
+// intermediate state. Locked keys cannot be deleted in an atomic batch.
+type BatchRequest struct {
+	Ops    []BatchOp `json:"ops"`
+	Atomic bool      `json:"atomic,omitempty"`
+}
+
+// BatchResult is the outcome of an operation. Result is the response the
+// operation's own route would have sent, Error the message of a failed
+// request.
+type BatchResult struct {
+	Status  int             `json:"status"`
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// BatchReturn reports whether no operation failed. Results only
+// cover the operations run, an atomic batch stops at the first failure and
+// reports RolledBack.
+type BatchReturn struct {
+	Success    bool          `json:"success"`
+	RolledBack bool          `json:"rolledBack,omitempty"`
+	Results    []BatchResult `json:"results"`
+}
@@ -0,0 +1,73 @@
+package types
+
+// Request bodies of the /v1 API. Durations are strings like 30s, 1m30s or
+// PT30S, integers are taken as nanoseconds.
+
+// LockRequest acquires the lock on a key.
+type LockRequest struct {
+	TTL string `json:"ttl"`
+	// Value is stored if the key does not exist yet, typed by Kind.
+	Value string `json:"value,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	// Reentrant locks can be acquired again by their holder, passing its
+	// SessionID or, without one, by the same identity.
+	Reentrant bool   `json:"reentrant,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// LockAllRequest acquires the locks on several keys under one session,
+// all or none.
+type LockAllRequest struct {
+	TTL string `json:"ttl"`
+	AcquireAllRequest
+}
+
+// RenewRequest renews a session.
+type RenewRequest struct {
+	TTL string `json:"ttl"`
+}
+
+// SetRequest sets the value of a key. Bytes values are base64 encoded.
+type SetRequest struct {
+	Value string `json:"value"`
+	Kind  string `json:"kind,omitempty"`
+	// SessionID must be the session holding the lock on the key if it
+	// exists.
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// MutexLockRequest locks a mutex, waiting at most Timeout if it is set.
+type MutexLockRequest struct {
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// IntRequest carries the operands of a counter operation, which of them
+// are required depends on the operation.
+type IntRequest struct {
+	Value    *int64 `json:"value,omitempty"`
+	Delta    *int64 `json:"delta,omitempty"`
+	Expected *int64 `json:"expected,omitempty"`
+	// Min and Max are the bounds of create and bounds, other operations
+	// only check them for their own result.
+	Min *int64 `json:"min,omitempty"`
+	Max *int64 `json:"max,omitempty"`
+	// TTL removes the counter after it has passed, only used by reset.
+	TTL string `json:"ttl,omitempty"`
+	// Mode is only used when the counter is created.
+	Mode      IntMode `json:"mode,omitempty"`
+	SessionID string  `json:"sessionId,omitempty"`
+}
+
+// PushRequest appends a value to a queue.
+type PushRequest struct {
+	Value string `json:"value"`
+	Kind  string `json:"kind,omitempty"`
+}
+
+// PopRequest leases the first item of a queue for Lease. Without Timeout
+// it waits until an item is available, a zero Timeout does not wait.
+type PopRequest struct {
+	Lease     string `json:"lease"`
+	Timeout   string `json:"timeout,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+}